@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/iwot/erdh-go/erdh/graph"
+)
+
+// runAnalyze はテーブルとリレーションをグラフとして分析し、孤立したテーブル、循環、参照元の多いテーブル、
+// 強連結成分、データを投入する順を出力する
+func runAnalyze(fs *flag.FlagSet, args []string) error {
+	cf := newConfigFlags(fs)
+	o := fs.String("out", "", "output file path (default stdout)")
+	format := fs.String("format", "text", "output format (text or json)")
+	hubs := fs.Int("hubs", 5, "number of most referenced tables to show (0 for all)")
+	maxCycles := fs.Int("max-cycles", 100, "maximum number of cycles to show (0 for all)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	conf, err := cf.load()
+	if err != nil {
+		return err
+	}
+	if *format != "text" && *format != "json" {
+		return usageError{fmt.Sprintf("invalid format %q", *format)}
+	}
+	if *hubs < 0 {
+		return usageError{fmt.Sprintf("invalid hubs %d", *hubs)}
+	}
+	if *maxCycles < 0 {
+		return usageError{fmt.Sprintf("invalid max-cycles %d", *maxCycles)}
+	}
+	password, err := cf.password()
+	if err != nil {
+		return err
+	}
+
+	cons, err := buildConstruction(context.Background(), conf, password)
+	if err != nil {
+		return err
+	}
+	analysis := graph.Analyze(cons.Graph(), graph.AnalyzeOptions{Hubs: *hubs, MaxCycles: *maxCycles})
+
+	out, err := createOutput(*o)
+	if err != nil {
+		return err
+	}
+	if *format == "json" {
+		err = analysis.WriteJSON(out)
+	} else {
+		err = analysis.WriteText(out)
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/iwot/erdh-go/db"
+	"github.com/iwot/erdh-go/erdh"
+)
+
+// runCheck は ex_info で定義したリレーションについて、参照先のない行を最初の読み込み元（mysql または sqlite）のデータから探して出力する
+// 参照先のない行があれば終了コード1を返す
+func runCheck(fs *flag.FlagSet, args []string) error {
+	cf := newConfigFlags(fs)
+	o := fs.String("out", "", "output file path (default stdout)")
+	format := fs.String("format", "text", "output format (text or json)")
+	samples := fs.Int("samples", 10, "maximum number of offending keys listed per relation")
+	includeFK := fs.Bool("include-fk", false, "also check relations from foreign keys")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	conf, err := cf.load()
+	if err != nil {
+		return err
+	}
+	if *format != "text" && *format != "json" {
+		return usageError{fmt.Sprintf("invalid format %q", *format)}
+	}
+	password, err := cf.password()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	cons, err := buildConstruction(ctx, conf, password)
+	if err != nil {
+		return err
+	}
+	src := conf.GetSources()[0]
+	if len(password) > 0 {
+		src.Password = password
+	}
+	results, err := db.CheckSourceIntegrity(ctx, src, cons, db.IntegrityOptions{SampleSize: *samples, IncludeForeignKeys: *includeFK})
+	if err != nil {
+		return err
+	}
+	report := erdh.NewIntegrityReport(cons.DBName, results)
+
+	out, err := createOutput(*o)
+	if err != nil {
+		return err
+	}
+	if *format == "json" {
+		err = report.WriteJSON(out)
+	} else {
+		err = report.WriteText(out)
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d relations checked, %d have rows without a referenced row\n", report.Checked, report.Violations)
+
+	if report.Violations > 0 {
+		return exitStatus(exitError)
+	}
+	return nil
+}
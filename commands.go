@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/iwot/erdh-go/config"
+	"github.com/iwot/erdh-go/erdh"
+)
+
+// loadOptions は設定ファイルの内容で erdh.Load を行うためのオプションを返す
+func loadOptions(conf *config.Config, password string) []erdh.Option {
+	return []erdh.Option{erdh.WithConfig(conf), erdh.WithPassword(password), erdh.WithLog(os.Stderr)}
+}
+
+// buildConstruction は読み込み元を読み、ex_info を検証して適用したConstructionを返す
+// ex_info が未指定の場合は読み込み元の内容をそのまま返す
+func buildConstruction(ctx context.Context, conf *config.Config, password string) (*erdh.Construction, error) {
+	return erdh.Load(ctx, conf.GetSources()[0], loadOptions(conf, password)...)
+}
+
+// readSources は読み込み元をすべて読み、マージしたConstructionを ex_info を適用せずに返す
+func readSources(ctx context.Context, conf *config.Config, password string) (*erdh.Construction, error) {
+	opts := append(loadOptions(conf, password), erdh.WithExInfo(&config.ExtraConfig{}))
+	return erdh.Load(ctx, conf.GetSources()[0], opts...)
+}
+
+// runGenerate は読み込み元から -format（設定ファイルでは format）の形式で図などを出力する
+// 形式を省略した場合、出力先を指定すればグループごとのPlantUMLの図を、省略すれば全体の図を出力する
+// 出力先のファイルは読み込みと出力が成功した後に書き込み、失敗した場合は既存のファイルを残す
+func runGenerate(fs *flag.FlagSet, args []string) error {
+	cf := newConfigFlags(fs)
+	out := fs.String("out", "", "output file path (default stdout); overrides out in config")
+	format := fs.String("format", "", "output format ("+strings.Join(erdh.Writers(), ", ")+"); overrides format in config (default puml, or puml-by-group with -out)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	conf, err := cf.load()
+	if err != nil {
+		return err
+	}
+	if isFlagSet(fs, "out") {
+		conf.Out = *out
+	}
+	if isFlagSet(fs, "format") {
+		conf.Format = *format
+	}
+	if len(conf.Format) == 0 {
+		conf.Format = erdh.FormatPuml
+		if len(conf.Out) > 0 {
+			conf.Format = erdh.FormatPumlByGroup
+		}
+	}
+	if _, ok := erdh.LookupWriter(conf.Format); !ok {
+		return usageError{fmt.Sprintf("unknown format %q", conf.Format)}
+	}
+	password, err := cf.password()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	var output io.Writer = os.Stdout
+	if len(conf.Out) > 0 {
+		output = &buf
+	}
+
+	opts := append(loadOptions(conf, password), erdh.WithFormat(conf.Format), erdh.WithOutput(output))
+	cons, err := erdh.Generate(context.Background(), conf.GetSources()[0], opts...)
+	if err != nil {
+		return err
+	}
+
+	if len(conf.Out) > 0 {
+		fmt.Fprintln(os.Stderr, "output to", conf.Out)
+		if err := ioutil.WriteFile(conf.Out, buf.Bytes(), 0666); err != nil {
+			return err
+		}
+	}
+
+	// 中間形式ファイルを保存
+	if len(conf.Im.SaveTo) > 0 {
+		fmt.Fprintln(os.Stderr, "intermediate saving to", conf.Im.SaveTo)
+		err := cons.SaveToFile(conf.Im.SaveTo)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runSnapshot は読み込み元を読み、ex_info を適用した中間形式ファイルを出力する
+// 出力先は -out、intermediate.save_to の順に採用し、どちらもなければ標準出力に出力する
+func runSnapshot(fs *flag.FlagSet, args []string) error {
+	cf := newConfigFlags(fs)
+	o := fs.String("out", "", "output intermediate file path (.json for JSON); defaults to intermediate.save_to in config, then stdout")
+	format := fs.String("format", "yaml", "output format when writing to stdout (yaml or json)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	conf, err := cf.load()
+	if err != nil {
+		return err
+	}
+	if *format != "yaml" && *format != "json" {
+		return usageError{fmt.Sprintf("invalid format %q", *format)}
+	}
+	password, err := cf.password()
+	if err != nil {
+		return err
+	}
+
+	cons, err := buildConstruction(context.Background(), conf, password)
+	if err != nil {
+		return err
+	}
+
+	out := *o
+	if len(out) == 0 {
+		out = conf.Im.SaveTo
+	}
+	if len(out) > 0 {
+		fmt.Fprintln(os.Stderr, "snapshot saving to", out)
+		return cons.SaveToFile(out)
+	}
+	if *format == "json" {
+		return cons.WriteJSON(os.Stdout)
+	}
+	return cons.WriteYaml(os.Stdout)
+}
+
+// runDiff は2つの中間形式ファイル、または中間形式ファイルと現在の読み込み元の差分を出力する
+// 差分があれば終了コード1を返す（統計情報の行数とサイズの変化は出力するが、差分に含めない）
+func runDiff(fs *flag.FlagSet, args []string) error {
+	cf := newConfigFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return usageError{"OLD is required and at most two files can be compared"}
+	}
+	oldCons, err := erdh.NewConstructionFromFile(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("read %s: %w", fs.Arg(0), err)
+	}
+
+	var newCons *erdh.Construction
+	if fs.NArg() == 2 {
+		newCons, err = erdh.NewConstructionFromFile(fs.Arg(1))
+		if err != nil {
+			return fmt.Errorf("read %s: %w", fs.Arg(1), err)
+		}
+	} else {
+		conf, err := cf.load()
+		if err != nil {
+			return err
+		}
+		password, err := cf.password()
+		if err != nil {
+			return err
+		}
+		newCons, err = buildConstruction(context.Background(), conf, password)
+		if err != nil {
+			return err
+		}
+	}
+
+	// 統計情報の変化は表示するが、終了コードには影響しない
+	changed := false
+	for _, d := range erdh.Diff(oldCons, newCons) {
+		fmt.Println(d)
+		if !d.IsStats() {
+			changed = true
+		}
+	}
+	if changed {
+		return exitStatus(exitError)
+	}
+	return nil
+}
+
+// runLint はスキーマの設計上の問題を出力する
+// 問題があれば終了コード1を返す
+func runLint(fs *flag.FlagSet, args []string) error {
+	cf := newConfigFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	conf, err := cf.load()
+	if err != nil {
+		return err
+	}
+	password, err := cf.password()
+	if err != nil {
+		return err
+	}
+
+	cons, err := buildConstruction(context.Background(), conf, password)
+	if err != nil {
+		return err
+	}
+
+	issues := cons.Lint()
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+	if len(issues) > 0 {
+		return exitStatus(exitError)
+	}
+	return nil
+}
+
+// runValidate は設定ファイルと ex_info を検証する
+// ex_info_validation の指定にかかわらず、問題があれば終了コード1を返す
+func runValidate(fs *flag.FlagSet, args []string) error {
+	cf := newConfigFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	conf, err := cf.load()
+	if err != nil {
+		return err
+	}
+	password, err := cf.password()
+	if err != nil {
+		return err
+	}
+
+	problems := []string{}
+	if !erdh.IsValidValidationMode(conf.ExInfoValidation) {
+		problems = append(problems, fmt.Sprintf("config: invalid ex_info_validation %s", conf.ExInfoValidation))
+	}
+	if _, err := conf.Theme.Resolve(); err != nil {
+		problems = append(problems, fmt.Sprintf("config: theme: %s", err))
+	}
+
+	cons, err := readSources(context.Background(), conf, password)
+	if err != nil {
+		return err
+	}
+	exInfo, err := config.NewExtraConfigFromYamlFiles(conf.ExInfo)
+	if err != nil {
+		return fmt.Errorf("read ex_info: %w", err)
+	}
+	for _, issue := range cons.ValidateExInfo(*exInfo, conf.Group) {
+		problems = append(problems, issue.String())
+	}
+
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		return exitStatus(exitError)
+	}
+	fmt.Fprintln(os.Stderr, "ok")
+	return nil
+}
+
+// runVersion はバージョンを出力する
+func runVersion(fs *flag.FlagSet, args []string) error {
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usageError{"unexpected arguments"}
+	}
+	fmt.Println("erdh-go", version)
+	return nil
+}
@@ -2,7 +2,6 @@ package config
 
 import (
 	"io/ioutil"
-	"strings"
 
 	"gopkg.in/yaml.v2"
 )
@@ -15,29 +14,44 @@ import (
 // )
 
 type Config struct {
-	Source     string       `yaml:"source"`
-	SourceFrom string       `yaml:"source_from"`
-	Group      []string     `yaml:"group"`
-	Im         Intermediate `yaml:"intermediate,omitempty"`
-	ExInfo     string       `yaml:"ex_info"`
+	Source     string `yaml:"source"`
+	SourceFrom string `yaml:"source_from"`
+	// Prefix, Strict は source, source_from で指定した読み込み元の prefix, strict
+	Prefix      string         `yaml:"prefix,omitempty"`
+	Strict      bool           `yaml:"strict,omitempty"`
+	Sources     []SourceConfig `yaml:"sources,omitempty"`
+	MergePolicy string         `yaml:"merge_policy,omitempty"`
+	Group       []string       `yaml:"group"`
+	Im          Intermediate   `yaml:"intermediate,omitempty"`
+	ExInfo      PathList       `yaml:"ex_info"`
+	// ExInfoValidation は ex_info の検証で問題が見つかった場合の扱い（warn または fail）
+	ExInfoValidation string `yaml:"ex_info_validation,omitempty"`
+	Theme            Theme  `yaml:"theme,omitempty"`
+	// Out は出力先のパス。省略時は標準出力に出力する
+	Out string `yaml:"out,omitempty"`
+	// Format は出力形式（puml, puml-by-group, yaml, json など登録された Writer の名前）
+	Format string `yaml:"format,omitempty"`
 }
 
-// IsDBSource はソースがDBであればtrueを返す
-func (c Config) IsDBSource() bool {
-	test := strings.ToLower(c.Source)
-	if test == "mysql" || test == "sqlite" {
-		return true
-	}
-	return false
+// SourceConfig は読み込み元ひとつ分の定義
+type SourceConfig struct {
+	Source     string `yaml:"source"`
+	SourceFrom string `yaml:"source_from"`
+	// Prefix は merge_policy が prefix のとき、衝突したテーブル名に付ける接頭辞
+	Prefix string `yaml:"prefix,omitempty"`
+	// Strict がtrueであれば、中間形式ファイルに未知のフィールドがある場合にエラーとする
+	Strict bool `yaml:"strict,omitempty"`
+	// Password は DBConfig のパスワードより優先されるパスワード（-password-stdin 用）
+	Password string `yaml:"-"`
 }
 
-// IsYAMLSource はソースがYAML（中間形式ファイル）であればtrueを返す
-func (c Config) IsYAMLSource() bool {
-	test := strings.ToLower(c.Source)
-	if test == "yaml" {
-		return true
+// GetSources は読み込み元の一覧を返す
+// sources が未指定の場合は source, source_from, prefix, strict をひとつの読み込み元として扱う
+func (c Config) GetSources() []SourceConfig {
+	if len(c.Sources) > 0 {
+		return c.Sources
 	}
-	return false
+	return []SourceConfig{{Source: c.Source, SourceFrom: c.SourceFrom, Prefix: c.Prefix, Strict: c.Strict}}
 }
 
 // Intermediate は出力する中間形式ファイルのパスの定義
@@ -1,9 +1,16 @@
 package config
 
-import "testing"
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
 
 func TestDbDsnMySQL(t *testing.T) {
-	var dbconf = DBConfig{"mysql", "localhost", "3306", "testdb", "user", "password"}
+	var dbconf = DBConfig{DBType: "mysql", Host: "localhost", Port: "3306", DBName: "testdb", User: "user", Password: "password"}
 	dsn, err := dbconf.ToDSN()
 
 	if err != nil {
@@ -14,3 +21,250 @@ func TestDbDsnMySQL(t *testing.T) {
 		t.Fatalf("failed test dsn %#v", dsn)
 	}
 }
+
+func TestDbDsnMySQLOptions(t *testing.T) {
+	var base = DBConfig{DBType: "mysql", Host: "localhost", Port: "3306", DBName: "testdb", User: "user", Password: "password"}
+
+	socket := base
+	socket.Socket = "/var/run/mysqld/mysqld.sock"
+
+	skipVerify := base
+	skipVerify.TLS = "skip-verify"
+
+	preferred := base
+	preferred.TLS = "preferred"
+
+	required := base
+	required.TLS = "required"
+
+	customTLS := base
+	customTLS.TLS = "required"
+	customTLS.TLSCA = "/path/to/ca.pem"
+	customTLS.TLSCert = "/path/to/client-cert.pem"
+	customTLS.TLSKey = "/path/to/client-key.pem"
+
+	charset := base
+	charset.Charset = "utf8mb4"
+	charset.Collation = "utf8mb4_general_ci"
+
+	params := socket
+	params.TLS = "skip-verify"
+	params.Charset = "utf8mb4"
+	params.Params = map[string]string{"timeout": "5s", "parseTime": "true"}
+
+	tests := []struct {
+		dbconf DBConfig
+		dsn    string
+	}{
+		{socket, "user:password@unix(/var/run/mysqld/mysqld.sock)/testdb"},
+		{skipVerify, "user:password@tcp(localhost:3306)/testdb?tls=skip-verify"},
+		{preferred, "user:password@tcp(localhost:3306)/testdb?tls=preferred"},
+		{required, "user:password@tcp(localhost:3306)/testdb?tls=true"},
+		{customTLS, "user:password@tcp(localhost:3306)/testdb?tls=" + customTLS.TLSConfigName()},
+		{charset, "user:password@tcp(localhost:3306)/testdb?charset=utf8mb4&collation=utf8mb4_general_ci"},
+		{params, "user:password@unix(/var/run/mysqld/mysqld.sock)/testdb?charset=utf8mb4&parseTime=true&timeout=5s&tls=skip-verify"},
+	}
+
+	for _, test := range tests {
+		dsn, err := test.dbconf.ToDSN()
+		if err != nil {
+			t.Fatalf("failed test dbconf.ToDSN() %#v", err)
+		}
+		if dsn != test.dsn {
+			t.Fatalf("failed test dsn %#v", dsn)
+		}
+	}
+
+	invalid := base
+	invalid.TLS = "sometimes"
+	if _, err := invalid.ToDSN(); err == nil {
+		t.Fatalf("failed test invalid tls mode")
+	}
+
+	if customTLS.TLSConfigName() == base.TLSConfigName() {
+		t.Fatalf("failed test TLSConfigName")
+	}
+	if _, err := customTLS.BuildTLSConfig(); err == nil {
+		t.Fatalf("failed test BuildTLSConfig with missing files")
+	}
+}
+
+func TestDbConfigEnvInterpolation(t *testing.T) {
+	os.Setenv("ERDH_TEST_PASSWORD", "secret$1")
+	defer os.Unsetenv("ERDH_TEST_PASSWORD")
+
+	dbconf, err := NewDBConfigFromYaml([]byte("dbtype: mysql\nuser: user\npassword: ${ERDH_TEST_PASSWORD}\n"))
+	if err != nil {
+		t.Fatalf("failed test NewDBConfigFromYaml %#v", err)
+	}
+	if dbconf.Password != "secret$1" {
+		t.Fatalf("failed test password %#v", dbconf.Password)
+	}
+
+	_, err = NewDBConfigFromYaml([]byte("dbtype: mysql\npassword: ${ERDH_TEST_UNDEFINED}\n"))
+	if err == nil {
+		t.Fatalf("failed test undefined environment variable")
+	}
+}
+
+func TestDbConfigResolveCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "erdh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	passwordFile := filepath.Join(dir, "password")
+	ioutil.WriteFile(passwordFile, []byte("from_file\n"), 0600)
+	optionFile := filepath.Join(dir, "my.cnf")
+	ioutil.WriteFile(optionFile, []byte("[client]\nuser=client_user\npassword=\"from_client\"\n\n[replica]\nhost = replica.local\npassword = from_replica\n"), 0600)
+
+	var dbconf = DBConfig{DBType: "mysql", Password: "from_yaml", PasswordFile: passwordFile, OptionFile: optionFile}
+	if err := dbconf.ResolveCredentials(); err != nil || dbconf.Password != "from_yaml" || dbconf.User != "client_user" {
+		t.Fatalf("failed test password precedence %#v %#v", dbconf.Password, err)
+	}
+
+	dbconf = DBConfig{DBType: "mysql", PasswordFile: passwordFile, OptionFile: optionFile}
+	if err := dbconf.ResolveCredentials(); err != nil || dbconf.Password != "from_file" {
+		t.Fatalf("failed test password_file %#v %#v", dbconf.Password, err)
+	}
+
+	dbconf = DBConfig{DBType: "mysql", OptionFile: optionFile, LoginPath: "replica"}
+	if err := dbconf.ResolveCredentials(); err != nil || dbconf.Password != "from_replica" || dbconf.Host != "replica.local" {
+		t.Fatalf("failed test login_path %#v %#v", dbconf, err)
+	}
+
+	if strings.Contains(dbconf.String(), "from_replica") {
+		t.Fatalf("failed test password is logged %#v", dbconf.String())
+	}
+}
+
+func TestExtraConfigFromYamlFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "erdh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Mkdir(filepath.Join(dir, "exinfo"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "base.yaml"), []byte("tables:\n- table: items\n  group: MASTER\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "exinfo", "data.yaml"), []byte(`tables:
+- table: members
+  group: DATA
+- table: items
+  is_master: true
+  relations:
+  - referenced_table_name: item_types
+`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "exinfo", "master.yaml"), []byte(`tables:
+- table: item_types
+  group: MASTER
+`), 0644)
+
+	conf, err := NewConfigFromYaml([]byte("ex_info:\n- " + filepath.Join(dir, "base.yaml") + "\n- " + filepath.Join(dir, "exinfo", "*.yaml") + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exInfo, err := NewExtraConfigFromYamlFiles(conf.ExInfo)
+	if err != nil {
+		t.Fatalf("failed test NewExtraConfigFromYamlFiles %#v", err)
+	}
+	if len(exInfo.Tables) != 3 || exInfo.Tables[0].Name != "items" || exInfo.Tables[2].Name != "item_types" {
+		t.Fatalf("failed test merged tables %#v", exInfo.Tables)
+	}
+	if items := exInfo.Tables[0]; items.Group != "MASTER" || !items.IsMaster || len(items.Relations) != 1 {
+		t.Fatalf("failed test merged table %#v", items)
+	}
+
+	// 単一のパスも従来通り指定できる
+	conf, err = NewConfigFromYaml([]byte("ex_info: " + filepath.Join(dir, "base.yaml") + "\n"))
+	if err != nil || len(conf.ExInfo) != 1 {
+		t.Fatalf("failed test single ex_info path %#v", conf.ExInfo)
+	}
+
+	conflict := filepath.Join(dir, "exinfo", "zz_conflict.yaml")
+	ioutil.WriteFile(conflict, []byte("# conflicting group\ntables:\n- table: items\n  group: DATA\n"), 0644)
+	_, err = NewExtraConfigFromYamlFiles(PathList{filepath.Join(dir, "base.yaml"), filepath.Join(dir, "exinfo", "*.yaml")})
+	if err == nil || !strings.Contains(err.Error(), conflict+":3") || !strings.Contains(err.Error(), "base.yaml:2") {
+		t.Fatalf("failed test conflict error %#v", err)
+	}
+}
+
+func TestConfigSet(t *testing.T) {
+	conf, err := NewConfigFromYaml([]byte("source: mysql\nsource_from: db.yaml\ngroup: [A]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key   string
+		value string
+	}{
+		{"source", "sqlite"},
+		{"group", "DATA, MASTER"},
+		{"ex_info", "a.yaml,exinfo/*.yaml"},
+		{"out", "result.puml"},
+		{"intermediate.save_to", "im.json"},
+		{"theme.legend", "true"},
+		{"theme.skinparams.shadowing", "false"},
+		{"sources", "[{source: yaml, source_from: a.yaml, prefix: a_}]"},
+	}
+	for _, test := range tests {
+		if err := conf.Set(test.key, test.value); err != nil {
+			t.Fatalf("failed test Set %s %#v", test.key, err)
+		}
+	}
+
+	if conf.Source != "sqlite" || conf.SourceFrom != "db.yaml" || conf.Out != "result.puml" || conf.Im.SaveTo != "im.json" {
+		t.Fatalf("failed test Set string %#v", conf)
+	}
+	if len(conf.Group) != 2 || conf.Group[1] != "MASTER" {
+		t.Fatalf("failed test Set list %#v", conf.Group)
+	}
+	if len(conf.ExInfo) != 2 || conf.ExInfo[1] != "exinfo/*.yaml" {
+		t.Fatalf("failed test Set path list %#v", conf.ExInfo)
+	}
+	if !conf.Theme.Legend || conf.Theme.Skinparams["shadowing"] != "false" {
+		t.Fatalf("failed test Set theme %#v", conf.Theme)
+	}
+	if len(conf.Sources) != 1 || conf.Sources[0].Prefix != "a_" {
+		t.Fatalf("failed test Set yaml %#v", conf.Sources)
+	}
+
+	for _, key := range []string{"nope", "theme.nope", "source.x", "theme.table_kinds.master"} {
+		if err := conf.Set(key, "x"); err == nil {
+			t.Fatalf("failed test Set unknown key %s", key)
+		}
+	}
+	if err := conf.Set("theme.legend", "maybe?"); err == nil {
+		t.Fatalf("failed test Set invalid value")
+	}
+}
+
+func TestExtraConfigOptional(t *testing.T) {
+	conf, err := NewConfigFromYaml([]byte("source: mysql\nsource_from: db.yaml\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exInfo, err := NewExtraConfigFromYamlFiles(conf.ExInfo)
+	if err != nil || len(exInfo.Tables) != 0 {
+		t.Fatalf("failed test optional ex_info %#v %#v", exInfo, err)
+	}
+}
+
+func TestConfigGetSources(t *testing.T) {
+	conf, err := NewConfigFromYaml([]byte("source: yaml\nsource_from: im.yaml\nprefix: a_\nstrict: true\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// source, source_from の形式でも prefix, strict を読み込み元に渡す
+	expected := []SourceConfig{{Source: "yaml", SourceFrom: "im.yaml", Prefix: "a_", Strict: true}}
+	if sources := conf.GetSources(); !reflect.DeepEqual(sources, expected) {
+		t.Fatalf("failed test GetSources %#v", sources)
+	}
+
+	conf.Sources = []SourceConfig{{Source: "json", SourceFrom: "im.json"}}
+	if sources := conf.GetSources(); len(sources) != 1 || sources[0].Strict {
+		t.Fatalf("failed test GetSources with sources %#v", sources)
+	}
+}
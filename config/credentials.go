@@ -0,0 +1,181 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+var envVarReg = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv は文字列中の ${ENV_VAR} を環境変数の値に置き換える
+// $VAR 形式はパスワードに含まれうるため置き換えない
+func expandEnv(s string) (string, error) {
+	var missing []string
+	result := envVarReg.ReplaceAllStringFunc(s, func(m string) string {
+		name := envVarReg.FindStringSubmatch(m)[1]
+		val, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return val
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	return result, nil
+}
+
+// interpolateEnv は構造体中の文字列フィールドすべてに expandEnv を適用する
+func interpolateEnv(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return interpolateEnv(v.Elem())
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath != "" {
+				continue
+			}
+			if err := interpolateEnv(v.Field(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := interpolateEnv(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			elem := v.MapIndex(key)
+			if elem.Kind() != reflect.String {
+				continue
+			}
+			expanded, err := expandEnv(elem.String())
+			if err != nil {
+				return err
+			}
+			v.SetMapIndex(key, reflect.ValueOf(expanded).Convert(elem.Type()))
+		}
+	case reflect.String:
+		expanded, err := expandEnv(v.String())
+		if err != nil {
+			return err
+		}
+		v.SetString(expanded)
+	}
+	return nil
+}
+
+// ResolveCredentials は未指定の接続情報を password_file や MySQL のオプションファイルから補う
+//
+// パスワードの優先順位は以下の通り（-password-stdin は呼び出し側で Password に設定する）
+//  1. password（${ENV_VAR} 展開後）
+//  2. password_file
+//  3. option_file（省略時は ~/.my.cnf）の login_path セクション、なければ [client] セクション
+func (c *DBConfig) ResolveCredentials() error {
+	if len(c.Password) == 0 && len(c.PasswordFile) > 0 {
+		buf, err := ioutil.ReadFile(c.PasswordFile)
+		if err != nil {
+			return err
+		}
+		c.Password = strings.TrimRight(string(buf), "\r\n")
+	}
+
+	if c.DBType != "mysql" {
+		return nil
+	}
+
+	optionFile := c.OptionFile
+	if len(optionFile) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		optionFile = filepath.Join(home, ".my.cnf")
+		if _, err := os.Stat(optionFile); err != nil {
+			return nil
+		}
+	}
+
+	sections, err := readOptionFile(optionFile)
+	if err != nil {
+		return err
+	}
+
+	options, ok := sections["client"]
+	if len(c.LoginPath) > 0 {
+		if options, ok = sections[c.LoginPath]; !ok {
+			return errors.New("login path " + c.LoginPath + " is not found in " + optionFile)
+		}
+	}
+	if !ok {
+		return nil
+	}
+
+	if len(c.User) == 0 {
+		c.User = options["user"]
+	}
+	if len(c.Host) == 0 {
+		c.Host = options["host"]
+	}
+	if len(c.Port) == 0 {
+		c.Port = options["port"]
+	}
+	if len(c.Password) == 0 {
+		c.Password = options["password"]
+	}
+
+	return nil
+}
+
+// readOptionFile は MySQL のオプションファイル（my.cnf 形式）をセクションごとに読む
+func readOptionFile(path string) (map[string]map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	result := map[string]map[string]string{}
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if _, ok := result[section]; !ok {
+				result[section] = map[string]string{}
+			}
+			continue
+		}
+		if len(section) == 0 {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		key := strings.Replace(strings.TrimSpace(kv[0]), "_", "-", -1)
+		value := ""
+		if len(kv) == 2 {
+			value = strings.TrimSpace(kv[1])
+			if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+				value = value[1 : len(value)-1]
+			}
+		}
+		result[section][key] = value
+	}
+
+	return result, scanner.Err()
+}
@@ -1,8 +1,13 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
+	"net/url"
+	"reflect"
+	"sort"
 	"strings"
 
 	"gopkg.in/yaml.v2"
@@ -15,9 +20,117 @@ type DBConfig struct {
 	DBName   string `yaml:"dbname"`
 	User     string `yaml:"user,omitempty"`
 	Password string `yaml:"password,omitempty"`
+	// PasswordFile はパスワードを記述したファイルのパス
+	PasswordFile string `yaml:"password_file,omitempty"`
+	// OptionFile は MySQL のオプションファイルのパス。省略時は ~/.my.cnf
+	OptionFile string `yaml:"option_file,omitempty"`
+	// LoginPath はオプションファイル中で参照するセクション名。省略時は [client]
+	LoginPath string `yaml:"login_path,omitempty"`
+	// Schemas は読み込むスキーマの一覧（MySQL）。省略時は DBName のみを読む
+	Schemas []string `yaml:"schemas,omitempty"`
+	// SchemaPattern は読み込むスキーマ名のLIKEパターン（MySQL）。Schemas が優先される
+	SchemaPattern string `yaml:"schema_pattern,omitempty"`
+	// Socket は Unix ソケットのパス。指定した場合は Host,Port より優先される
+	Socket string `yaml:"socket,omitempty"`
+	// TLS は TLS の利用方法（skip-verify, preferred, required, false）
+	TLS string `yaml:"tls,omitempty"`
+	// TLSCA, TLSCert, TLSKey は TLS で用いる CA 証明書、クライアント証明書、秘密鍵のパス
+	TLSCA   string `yaml:"tls_ca,omitempty"`
+	TLSCert string `yaml:"tls_cert,omitempty"`
+	TLSKey  string `yaml:"tls_key,omitempty"`
+	// Charset, Collation は接続時の文字セットと照合順序
+	Charset   string `yaml:"charset,omitempty"`
+	Collation string `yaml:"collation,omitempty"`
+	// Params は DSN に追加する任意のパラメータ
+	Params map[string]string `yaml:"params,omitempty"`
+	// SQLiteReader はSQLiteのテーブル構造の読み方（pragma または parser）。省略時は pragma
+	SQLiteReader string `yaml:"sqlite_reader,omitempty"`
+	// Attach はSQLiteでアタッチするデータベースの名前とファイルのパス
+	Attach map[string]string `yaml:"attach,omitempty"`
+	// IncludeInternalTables がtrueであれば、SQLiteの内部テーブルと仮想テーブルのシャドウテーブルも読む
+	IncludeInternalTables bool `yaml:"include_internal_tables,omitempty"`
+	// CollectStats がtrueであれば、テーブルの行数やサイズなどの統計情報も読む
+	CollectStats bool `yaml:"collect_stats,omitempty"`
+	// SSH は踏み台ホストを経由して接続する場合の設定
+	SSH *SSHConfig `yaml:"ssh,omitempty"`
+}
+
+// SSHConfig は踏み台ホストへのSSH接続の定義
+type SSHConfig struct {
+	Host string `yaml:"host"`
+	Port string `yaml:"port,omitempty"`
+	User string `yaml:"user"`
+	// KeyFile は秘密鍵のパス。KeyPassphrase はその鍵のパスフレーズ
+	KeyFile       string `yaml:"key_file,omitempty"`
+	KeyPassphrase string `yaml:"key_passphrase,omitempty"`
+	// UseAgent がtrueであれば SSH_AUTH_SOCK のエージェントの鍵を用いる
+	UseAgent bool `yaml:"use_agent,omitempty"`
+	// KnownHosts は known_hosts ファイルのパス。省略時は ~/.ssh/known_hosts
+	KnownHosts string `yaml:"known_hosts,omitempty"`
+	// InsecureIgnoreHostKey がtrueであればホスト鍵を検証しない
+	InsecureIgnoreHostKey bool `yaml:"insecure_ignore_host_key,omitempty"`
+}
+
+// Address は踏み台ホストの host:port を返す
+func (c SSHConfig) Address() string {
+	port := c.Port
+	if len(port) == 0 {
+		port = "22"
+	}
+	return net.JoinHostPort(c.Host, port)
+}
+
+// AttachNames はアタッチするデータベースの名前を名前順に返す
+func (c DBConfig) AttachNames() []string {
+	names := []string{}
+	for name := range c.Attach {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsMultiSchema は複数スキーマを読む設定であればtrueを返す
+func (c DBConfig) IsMultiSchema() bool {
+	return len(c.Schemas) > 1 || len(c.SchemaPattern) > 0
+}
+
+// String はパスワードを含まない接続情報を返す（ログ出力用）
+func (c DBConfig) String() string {
+	return fmt.Sprintf("%s://%s@%s:%s/%s", c.DBType, c.User, c.Host, c.Port, c.DBName)
+}
+
+// Network は接続先への接続方法（unix または tcp）を返す
+func (c DBConfig) Network() string {
+	if len(c.Socket) > 0 {
+		return "unix"
+	}
+	return "tcp"
+}
+
+// Address は接続先のソケットパスまたは host:port を返す
+// host を省略した場合は 127.0.0.1、port を省略した場合は 3306 とする
+func (c DBConfig) Address() string {
+	if len(c.Socket) > 0 {
+		return c.Socket
+	}
+	host, port := c.Host, c.Port
+	if len(host) == 0 {
+		host = "127.0.0.1"
+	}
+	if len(port) == 0 {
+		port = "3306"
+	}
+	return net.JoinHostPort(host, port)
 }
 
 func (c DBConfig) ToDSN() (string, error) {
+	return c.ToDSNVia(c.Network())
+}
+
+// ToDSNVia はドライバに登録したダイアラ名 network を用いたDSNを返す
+// ssh を指定した場合は host を省略してもトンネルを経由するよう、常に network(address) を含める
+func (c DBConfig) ToDSNVia(network string) (string, error) {
 	var b strings.Builder
 
 	if c.DBType == "mysql" {
@@ -27,22 +140,58 @@ func (c DBConfig) ToDSN() (string, error) {
 			fmt.Fprint(&b, c.Password)
 		}
 		fmt.Fprint(&b, "@")
-		if len(c.Host) > 0 {
-			fmt.Fprint(&b, "tcp(")
-			fmt.Fprint(&b, c.Host)
-			if len(c.Port) > 0 {
-				fmt.Fprint(&b, ":")
-				fmt.Fprint(&b, c.Port)
-			}
+		if len(c.Socket) > 0 || len(c.Host) > 0 || c.SSH != nil {
+			fmt.Fprint(&b, network)
+			fmt.Fprint(&b, "(")
+			fmt.Fprint(&b, c.Address())
 			fmt.Fprint(&b, ")")
 		}
 		fmt.Fprint(&b, "/")
 		fmt.Fprint(&b, c.DBName)
+
+		params, err := c.dsnParams()
+		if err != nil {
+			return "", err
+		}
+		if len(params) > 0 {
+			fmt.Fprint(&b, "?")
+			fmt.Fprint(&b, params.Encode())
+		}
 	}
 
 	return b.String(), nil
 }
 
+// dsnParams は DSN の ? 以降に付けるパラメータを返す
+func (c DBConfig) dsnParams() (url.Values, error) {
+	params := url.Values{}
+	for k, v := range c.Params {
+		params.Set(k, v)
+	}
+	if len(c.Charset) > 0 {
+		params.Set("charset", c.Charset)
+	}
+	if len(c.Collation) > 0 {
+		params.Set("collation", c.Collation)
+	}
+
+	if c.HasCustomTLS() {
+		params.Set("tls", c.TLSConfigName())
+	} else {
+		switch strings.ToLower(c.TLS) {
+		case "":
+		case "skip-verify", "preferred", "false":
+			params.Set("tls", strings.ToLower(c.TLS))
+		case "required", "true":
+			params.Set("tls", "true")
+		default:
+			return nil, errors.New("invalid tls mode " + c.TLS)
+		}
+	}
+
+	return params, nil
+}
+
 func NewDBConfigFromYamlFile(path string) (*DBConfig, error) {
 	buf, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -60,5 +209,10 @@ func NewDBConfigFromYaml(buf []byte) (*DBConfig, error) {
 		return nil, err
 	}
 
+	err = interpolateEnv(reflect.ValueOf(result))
+	if err != nil {
+		return nil, err
+	}
+
 	return result, nil
 }
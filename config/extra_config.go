@@ -13,6 +13,7 @@ type ExtraConfig struct {
 type Table struct {
 	Name      string       `yaml:"table"`
 	IsMaster  bool         `yaml:"is_master"`
+	Kind      string       `yaml:"kind,omitempty"`
 	Group     string       `yaml:"group"`
 	Relations []ExRelation `yaml:"relations"`
 }
@@ -22,6 +23,13 @@ type ExRelation struct {
 	Columns             []ColumnRelation `yaml:"columns"`
 	ThisConnection      string           `yaml:"this_conn"`
 	ThatConnection      string           `yaml:"that_conn"`
+	// Label はリレーションの名前（owns, is typed by など）
+	Label string `yaml:"label,omitempty"`
+	// ThisRole, ThatRole はそれぞれのテーブル側の役割名
+	ThisRole string `yaml:"this_role,omitempty"`
+	ThatRole string `yaml:"that_role,omitempty"`
+	// Style は線の種類（solid, dashed）。省略時は solid
+	Style string `yaml:"style,omitempty"`
 }
 
 type ColumnRelation struct {
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// PathList はひとつのパスまたはパスのリストとして記述できる設定値
+type PathList []string
+
+// UnmarshalYAML は文字列とリストのどちらも受け付ける
+func (p *PathList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		if len(single) > 0 {
+			*p = PathList{single}
+		} else {
+			*p = PathList{}
+		}
+		return nil
+	}
+
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*p = PathList(list)
+	return nil
+}
+
+// Expand はグロブパターンを展開したパスの一覧を返す
+// パターンごとに一致したパスは名前順に並べ、指定した順に連結する
+func (p PathList) Expand() ([]string, error) {
+	result := []string{}
+	seen := map[string]bool{}
+	for _, pattern := range p {
+		matches := []string{pattern}
+		if strings.ContainsAny(pattern, "*?[") {
+			var err error
+			matches, err = filepath.Glob(pattern)
+			if err != nil {
+				return nil, err
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no file matches %s", pattern)
+			}
+			sort.Strings(matches)
+		}
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				result = append(result, m)
+			}
+		}
+	}
+	return result, nil
+}
+
+// NewExtraConfigFromYamlFiles は複数の ex_info ファイルを読み、テーブルごとにマージする
+//
+// 同じテーブルが複数のファイルにある場合は以下のようにマージする
+//   - group, kind は空でない値を採用し、異なる値が指定されていればエラーとする
+//   - is_master はいずれかのファイルで true であれば true とする
+//   - relations は連結し、同じ参照先テーブルへのリレーションが複数のファイルにあればエラーとする
+func NewExtraConfigFromYamlFiles(patterns PathList) (*ExtraConfig, error) {
+	paths, err := patterns.Expand()
+	if err != nil {
+		return nil, err
+	}
+
+	type location struct {
+		path string
+		line int
+	}
+	var result = new(ExtraConfig)
+	tableIndex := map[string]int{}
+	tableLocations := map[string][]location{}
+	relationLocations := map[string]location{}
+	groupLocations := map[string]location{}
+	kindLocations := map[string]location{}
+	locate := func(loc location) string {
+		return fmt.Sprintf("%s:%d", loc.path, loc.line)
+	}
+
+	for _, path := range paths {
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		exInfo, err := NewExtraConfigFromYaml(buf)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+
+		lines := findTableLines(buf)
+		occurrence := map[string]int{}
+		for _, t := range exInfo.Tables {
+			loc := location{path, 0}
+			if n := occurrence[t.Name]; n < len(lines[t.Name]) {
+				loc.line = lines[t.Name][n]
+			}
+			occurrence[t.Name]++
+
+			idx, ok := tableIndex[t.Name]
+			if !ok || tableLocations[t.Name][len(tableLocations[t.Name])-1].path == path {
+				// 同じファイル内の重複はそのまま残す（ex_info の検証で報告する）
+				if !ok {
+					tableIndex[t.Name] = len(result.Tables)
+				}
+				tableLocations[t.Name] = append(tableLocations[t.Name], loc)
+				if len(t.Group) > 0 {
+					groupLocations[t.Name] = loc
+				}
+				if len(t.Kind) > 0 {
+					kindLocations[t.Name] = loc
+				}
+				for _, r := range t.Relations {
+					relationLocations[t.Name+"\x00"+r.ReferencedTableName] = loc
+				}
+				result.Tables = append(result.Tables, t)
+				continue
+			}
+
+			merged := &result.Tables[idx]
+			if len(merged.Group) > 0 && len(t.Group) > 0 && merged.Group != t.Group {
+				return nil, fmt.Errorf("table %s: group %q in %s conflicts with %q in %s", t.Name, t.Group, locate(loc), merged.Group, locate(groupLocations[t.Name]))
+			}
+			if len(merged.Kind) > 0 && len(t.Kind) > 0 && merged.Kind != t.Kind {
+				return nil, fmt.Errorf("table %s: kind %q in %s conflicts with %q in %s", t.Name, t.Kind, locate(loc), merged.Kind, locate(kindLocations[t.Name]))
+			}
+			if len(merged.Group) == 0 && len(t.Group) > 0 {
+				merged.Group = t.Group
+				groupLocations[t.Name] = loc
+			}
+			if len(merged.Kind) == 0 && len(t.Kind) > 0 {
+				merged.Kind = t.Kind
+				kindLocations[t.Name] = loc
+			}
+			merged.IsMaster = merged.IsMaster || t.IsMaster
+			for _, r := range t.Relations {
+				key := t.Name + "\x00" + r.ReferencedTableName
+				if other, ok := relationLocations[key]; ok {
+					return nil, fmt.Errorf("table %s: relation to %s in %s conflicts with %s", t.Name, r.ReferencedTableName, locate(loc), locate(other))
+				}
+				relationLocations[key] = loc
+				merged.Relations = append(merged.Relations, r)
+			}
+			tableLocations[t.Name] = append(tableLocations[t.Name], loc)
+		}
+	}
+
+	return result, nil
+}
+
+var tableLineReg = regexp.MustCompile(`^\s*-?\s*table:\s*(.*?)\s*(#.*)?$`)
+
+// findTableLines はテーブル名ごとに table: を記述した行番号を返す
+func findTableLines(buf []byte) map[string][]int {
+	result := map[string][]int{}
+	for i, line := range strings.Split(string(buf), "\n") {
+		m := tableLineReg.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		name := strings.Trim(m[1], `"'`)
+		result[name] = append(result[name], i+1)
+	}
+	return result
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Set は key（yaml のキーをドットでつないだもの。例：theme.direction）の設定値を value で上書きする
+//
+// 値は以下のように解釈する
+//   - 文字列はそのまま用いる
+//   - 文字列のリスト（group, ex_info など）はカンマ区切り
+//   - マップ（theme.skinparams など）は theme.skinparams.shadowing のようにキーを続けて要素を指定する
+//   - それ以外は YAML として解釈する（例：legend=true, sources=[{source: yaml, source_from: a.yaml}]）
+func (c *Config) Set(key, value string) error {
+	v := reflect.ValueOf(c).Elem()
+	path := strings.Split(key, ".")
+	for i, name := range path {
+		switch v.Kind() {
+		case reflect.Struct:
+			field, ok := fieldByYamlName(v, name)
+			if !ok {
+				return fmt.Errorf("unknown config key %s", strings.Join(path[:i+1], "."))
+			}
+			v = field
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String || v.Type().Elem().Kind() != reflect.String {
+				return fmt.Errorf("config key %s can not be set", key)
+			}
+			if v.IsNil() {
+				v.Set(reflect.MakeMap(v.Type()))
+			}
+			v.SetMapIndex(reflect.ValueOf(strings.Join(path[i:], ".")), reflect.ValueOf(value))
+			return nil
+		default:
+			return fmt.Errorf("unknown config key %s", key)
+		}
+	}
+
+	if v.Kind() == reflect.String {
+		v.SetString(value)
+		return nil
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String {
+		list := reflect.MakeSlice(v.Type(), 0, 0)
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); len(s) > 0 {
+				list = reflect.Append(list, reflect.ValueOf(s))
+			}
+		}
+		v.Set(list)
+		return nil
+	}
+
+	parsed := reflect.New(v.Type())
+	if err := yaml.Unmarshal([]byte(value), parsed.Interface()); err != nil {
+		return fmt.Errorf("invalid value for config key %s: %v", key, err)
+	}
+	v.Set(parsed.Elem())
+	return nil
+}
+
+// fieldByYamlName は yaml タグの名前が name のフィールドを返す
+func fieldByYamlName(v reflect.Value, name string) (reflect.Value, bool) {
+	for i := 0; i < v.NumField(); i++ {
+		tag := strings.Split(v.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		if tag == name && tag != "-" {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
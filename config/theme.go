@@ -0,0 +1,238 @@
+package config
+
+import "errors"
+
+// Theme は PlantUML 出力の見た目の定義
+type Theme struct {
+	// Name は元にする組み込みテーマの名前（default, mono, blueprint）
+	Name string `yaml:"name,omitempty"`
+	// Includes は !include するスタイルファイルのパス
+	Includes []string `yaml:"includes,omitempty"`
+	// Direction はレイアウトの向き（top-to-bottom, left-to-right）
+	Direction string `yaml:"direction,omitempty"`
+	// LineType は線の種類（ortho, polyline）
+	LineType string `yaml:"line_type,omitempty"`
+	// Skinparams は出力する skinparam の名前と値
+	Skinparams map[string]string `yaml:"skinparams,omitempty"`
+	// CenterGroupColor はグループごとのページで中心となるグループの色。省略時は #DDDDDD
+	CenterGroupColor string `yaml:"center_group_color,omitempty"`
+	// GroupColors はグループごとの色
+	GroupColors map[string]string `yaml:"group_colors,omitempty"`
+	// EdgeColors はリレーションの線の色
+	EdgeColors EdgeColors `yaml:"edge_colors,omitempty"`
+	// EdgeStyle はリレーションの線の引き方（table, column, label）。省略時は table
+	EdgeStyle string `yaml:"edge_style,omitempty"`
+	// TableKinds はテーブルの種類ごとのステレオタイプと色。既定の master, transaction を名前で上書きできる
+	TableKinds []TableKind `yaml:"table_kinds,omitempty"`
+	// Legend がtrueであればテーブルの種類の凡例を出力する
+	Legend bool `yaml:"legend,omitempty"`
+	// Stats がtrueであればテーブルの統計情報（行数とサイズ）を出力する
+	Stats bool `yaml:"stats,omitempty"`
+	// RowColors は行数に応じたテーブルの色。行数が min_rows 以上のもののうち、min_rows が最も大きいものを用いる
+	RowColors []RowColor `yaml:"row_colors,omitempty"`
+}
+
+// RowColor は行数が MinRows 以上のテーブルの色
+type RowColor struct {
+	MinRows int64  `yaml:"min_rows"`
+	Color   string `yaml:"color"`
+}
+
+// RowColorFor は行数 rows のテーブルの色を返す。該当するものがなければ空文字列を返す
+func (t Theme) RowColorFor(rows int64) string {
+	color := ""
+	var minRows int64 = -1
+	for _, rc := range t.RowColors {
+		if rows >= rc.MinRows && rc.MinRows > minRows {
+			color, minRows = rc.Color, rc.MinRows
+		}
+	}
+	return color
+}
+
+// EdgeColors はリレーションの由来ごとの線の色
+type EdgeColors struct {
+	// ForeignKey は外部キーに由来するリレーションの色
+	ForeignKey string `yaml:"foreign_key,omitempty"`
+	// ExInfo は ex_info でのみ定義されたリレーションの色
+	ExInfo string `yaml:"ex_info,omitempty"`
+}
+
+// BuiltinThemes は組み込みテーマ
+var BuiltinThemes = map[string]Theme{
+	"default": {
+		CenterGroupColor: "#DDDDDD",
+	},
+	"mono": {
+		Skinparams: map[string]string{
+			"monochrome": "true",
+			"shadowing":  "false",
+		},
+		CenterGroupColor: "#EEEEEE",
+		TableKinds: []TableKind{
+			{Name: "master", MarkColor: "#FFFFFF", BackgroundColor: "#F5F5F5"},
+			{Name: "transaction", MarkColor: "#FFFFFF"},
+		},
+	},
+	"blueprint": {
+		LineType: "ortho",
+		Skinparams: map[string]string{
+			"BackgroundColor":    "#F5F9FF",
+			"ArrowColor":         "#1F4E79",
+			"ClassBorderColor":   "#1F4E79",
+			"PackageBorderColor": "#1F4E79",
+			"shadowing":          "false",
+		},
+		CenterGroupColor: "#DCE9F7",
+		EdgeColors: EdgeColors{
+			ForeignKey: "#1F4E79",
+			ExInfo:     "#7F7F7F",
+		},
+	},
+}
+
+// Resolve は組み込みテーマに、このテーマで指定した項目を上書きしたものを返す
+func (t Theme) Resolve() (Theme, error) {
+	name := t.Name
+	if len(name) == 0 {
+		name = "default"
+	}
+	base, ok := BuiltinThemes[name]
+	if !ok {
+		return t, errors.New("unknown theme " + name)
+	}
+
+	result := base
+	result.Name = name
+	result.Includes = append(append([]string{}, base.Includes...), t.Includes...)
+	if len(t.Direction) > 0 {
+		result.Direction = t.Direction
+	}
+	if len(t.LineType) > 0 {
+		result.LineType = t.LineType
+	}
+	result.Skinparams = mergeStringMap(base.Skinparams, t.Skinparams)
+	if len(t.CenterGroupColor) > 0 {
+		result.CenterGroupColor = t.CenterGroupColor
+	}
+	if len(result.CenterGroupColor) == 0 {
+		result.CenterGroupColor = "#DDDDDD"
+	}
+	result.GroupColors = mergeStringMap(base.GroupColors, t.GroupColors)
+	if len(t.EdgeColors.ForeignKey) > 0 {
+		result.EdgeColors.ForeignKey = t.EdgeColors.ForeignKey
+	}
+	if len(t.EdgeColors.ExInfo) > 0 {
+		result.EdgeColors.ExInfo = t.EdgeColors.ExInfo
+	}
+	if len(t.EdgeStyle) > 0 {
+		result.EdgeStyle = t.EdgeStyle
+	}
+	result.TableKinds = append(append([]TableKind{}, base.TableKinds...), t.TableKinds...)
+	result.Legend = base.Legend || t.Legend
+	result.Stats = base.Stats || t.Stats
+	if len(t.RowColors) > 0 {
+		result.RowColors = t.RowColors
+	}
+
+	switch result.Direction {
+	case "", "top-to-bottom", "left-to-right":
+	default:
+		return t, errors.New("invalid direction " + result.Direction)
+	}
+	switch result.LineType {
+	case "", "ortho", "polyline":
+	default:
+		return t, errors.New("invalid line_type " + result.LineType)
+	}
+	switch result.EdgeStyle {
+	case "", "table", "column", "label":
+	default:
+		return t, errors.New("invalid edge_style " + result.EdgeStyle)
+	}
+
+	return result, nil
+}
+
+func mergeStringMap(base, override map[string]string) map[string]string {
+	result := map[string]string{}
+	for k, v := range base {
+		result[k] = v
+	}
+	for k, v := range override {
+		result[k] = v
+	}
+	return result
+}
+
+// TableKind はテーブルの種類ごとのステレオタイプと色の定義
+type TableKind struct {
+	Name            string `yaml:"name"`
+	Mark            string `yaml:"mark,omitempty"`
+	MarkColor       string `yaml:"mark_color,omitempty"`
+	BackgroundColor string `yaml:"background_color,omitempty"`
+	Label           string `yaml:"label,omitempty"`
+}
+
+// DefaultTableKinds は既定のテーブルの種類を返す
+func DefaultTableKinds() []TableKind {
+	return []TableKind{
+		{Name: "master", Mark: "M", MarkColor: "#88CCFF", BackgroundColor: "#F0F8FF", Label: "master"},
+		{Name: "transaction", Mark: "T", MarkColor: "#FFAA44", Label: "transaction"},
+	}
+}
+
+// GetTableKinds は既定のテーブルの種類に TableKinds を反映したものを返す
+func (t Theme) GetTableKinds() []TableKind {
+	result := DefaultTableKinds()
+	for _, kind := range t.TableKinds {
+		found := false
+		for i, d := range result {
+			if d.Name == kind.Name {
+				result[i] = kind.withDefaults(d)
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, kind.withDefaults(TableKind{}))
+		}
+	}
+	return result
+}
+
+// GetTableKind は指定した名前のテーブルの種類を返す
+func (t Theme) GetTableKind(name string) TableKind {
+	for _, kind := range t.GetTableKinds() {
+		if kind.Name == name {
+			return kind
+		}
+	}
+	return TableKind{Name: name}.withDefaults(TableKind{})
+}
+
+// withDefaults は未指定の項目を d またはフォールバック値で補う
+func (k TableKind) withDefaults(d TableKind) TableKind {
+	if len(k.Mark) == 0 {
+		k.Mark = d.Mark
+	}
+	if len(k.Mark) == 0 && len(k.Name) > 0 {
+		k.Mark = string([]rune(k.Name)[:1])
+	}
+	if len(k.MarkColor) == 0 {
+		k.MarkColor = d.MarkColor
+	}
+	if len(k.MarkColor) == 0 {
+		k.MarkColor = "#CCCCCC"
+	}
+	if len(k.BackgroundColor) == 0 {
+		k.BackgroundColor = d.BackgroundColor
+	}
+	if len(k.Label) == 0 {
+		k.Label = d.Label
+	}
+	if len(k.Label) == 0 {
+		k.Label = k.Name
+	}
+	return k
+}
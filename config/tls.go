@@ -0,0 +1,62 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"strings"
+)
+
+// HasCustomTLS は CA やクライアント証明書を指定した TLS 設定であればtrueを返す
+func (c DBConfig) HasCustomTLS() bool {
+	return len(c.TLSCA) > 0 || len(c.TLSCert) > 0 || len(c.TLSKey) > 0
+}
+
+// TLSConfigName はドライバに登録する TLS 設定の名前を返す
+// 同じ証明書の組み合わせであれば同じ名前になる
+func (c DBConfig) TLSConfigName() string {
+	h := fnv.New32a()
+	fmt.Fprint(h, strings.ToLower(c.TLS), "\x00", c.Host, "\x00", c.TLSCA, "\x00", c.TLSCert, "\x00", c.TLSKey)
+	return fmt.Sprintf("erdh-%08x", h.Sum32())
+}
+
+// BuildTLSConfig は CA、クライアント証明書、秘密鍵のファイルから tls.Config を生成する
+func (c DBConfig) BuildTLSConfig() (*tls.Config, error) {
+	conf := &tls.Config{ServerName: c.Host}
+
+	switch strings.ToLower(c.TLS) {
+	case "skip-verify":
+		conf.InsecureSkipVerify = true
+	case "", "preferred", "required", "true":
+	default:
+		return nil, errors.New("invalid tls mode " + c.TLS + " with certificate files")
+	}
+
+	if len(c.TLSCA) > 0 {
+		pem, err := ioutil.ReadFile(c.TLSCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("failed to append CA certificate " + c.TLSCA)
+		}
+		conf.RootCAs = pool
+	}
+
+	if len(c.TLSCert) > 0 || len(c.TLSKey) > 0 {
+		if len(c.TLSCert) == 0 || len(c.TLSKey) == 0 {
+			return nil, errors.New("both tls_cert and tls_key are required")
+		}
+		cert, err := tls.LoadX509KeyPair(c.TLSCert, c.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	return conf, nil
+}
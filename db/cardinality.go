@@ -0,0 +1,145 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/iwot/erdh-go/config"
+	"github.com/iwot/erdh-go/erdh"
+)
+
+// MeasureCardinalities は cons のリレーションごとに対象DBのデータを集計し、記述したカーディナリティと比べるための結果を返す
+// 同じテーブルへのリレーションは外部キーの制約ごと（ExRelation.ColumnGroups）に集計する
+// 参照元、参照先のテーブルとカラムが対象DBにないリレーション（他の読み込み元のテーブルなど）とカラムのないリレーションは集計しない
+func MeasureCardinalities(ctx context.Context, target string, dbconf config.DBConfig, cons *erdh.Construction) ([]erdh.CardinalityCheck, error) {
+	d, err := lookupDataDB(target)
+	if err != nil {
+		return nil, err
+	}
+
+	db, closeDB, err := d.open(ctx, dbconf)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDB()
+
+	dbCons, err := d.read(ctx, db, dbconf)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []erdh.CardinalityCheck{}
+	for _, t := range cons.Tables {
+		child := dbCons.GetTableMut(t.Name)
+		if child == nil {
+			continue
+		}
+		for _, rel := range t.ExRelations {
+			parent := dbCons.GetTableMut(rel.ReferencedTableName)
+			if parent == nil {
+				continue
+			}
+			// 同じテーブルへの複数の外部キーは別々に集計する
+			for _, exr := range rel.SplitByColumnGroups() {
+				if !hasRelationColumns(*child, *parent, exr) {
+					continue
+				}
+				stats, err := measureCardinality(ctx, db, d, *child, *parent, exr)
+				if err != nil {
+					return nil, fmt.Errorf("measure %s -> %s: %w", t.Name, exr.ReferencedTableName, err)
+				}
+				result = append(result, erdh.CardinalityCheck{Table: t.Name, Relation: exr, Stats: stats})
+			}
+		}
+	}
+	return result, nil
+}
+
+// MeasureSourceCardinalities は読み込み元（source_from にDBの接続設定ファイルを指定したもの）について MeasureCardinalities を行う
+func MeasureSourceCardinalities(ctx context.Context, src config.SourceConfig, cons *erdh.Construction) ([]erdh.CardinalityCheck, error) {
+	dbConf, err := sourceDBConfig(src)
+	if err != nil {
+		return nil, err
+	}
+	return MeasureCardinalities(ctx, src.Source, *dbConf, cons)
+}
+
+func hasRelationColumns(child, parent erdh.Table, exr erdh.ExRelation) bool {
+	if len(exr.Columns) == 0 {
+		return false
+	}
+	for _, col := range exr.Columns {
+		if child.GetColumn(col.From) == nil || parent.GetColumn(col.To) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// relationQuery はリレーションを調べるSQLの部品
+// 参照元テーブルの別名は c、参照先テーブルの別名は p とする
+type relationQuery struct {
+	childRef, parentRef string
+	// from, to は参照元、参照先のカラム
+	from, to []string
+	// join は c と p を結ぶ条件、fromNotNull, fromNull, toNotNull は別名のないカラムの条件
+	join, fromNotNull, fromNull, toNotNull []string
+}
+
+func newRelationQuery(d dataDB, child, parent erdh.Table, exr erdh.ExRelation) relationQuery {
+	q := relationQuery{childRef: d.tableRef(child), parentRef: d.tableRef(parent)}
+	for _, col := range exr.Columns {
+		f, t := d.quote(col.From), d.quote(col.To)
+		q.from = append(q.from, f)
+		q.to = append(q.to, t)
+		q.join = append(q.join, "p."+t+" = c."+f)
+		q.fromNotNull = append(q.fromNotNull, f+" IS NOT NULL")
+		q.fromNull = append(q.fromNull, f+" IS NULL")
+		q.toNotNull = append(q.toNotNull, t+" IS NOT NULL")
+	}
+	return q
+}
+
+// orphanCondition は参照元のカラムがNULLでなく、参照先に対応する行のない参照元の行の条件を返す
+func (q relationQuery) orphanCondition() string {
+	return fmt.Sprintf(`%s AND NOT EXISTS (SELECT 1 FROM %s p WHERE %s)`,
+		strings.Join(prefixAll("c.", q.fromNotNull), " AND "), q.parentRef, strings.Join(q.join, " AND "))
+}
+
+// measureCardinality はリレーションについて行数、NULLの行数、参照先のない行数、参照先ひとつあたりの最大行数などを集計する
+func measureCardinality(ctx context.Context, db *sql.DB, d dataDB, child, parent erdh.Table, exr erdh.ExRelation) (erdh.CardinalityStats, error) {
+	var stats erdh.CardinalityStats
+	q := newRelationQuery(d, child, parent, exr)
+
+	queries := []struct {
+		query string
+		dest  *int
+	}{
+		{fmt.Sprintf(`SELECT COUNT(*) FROM %s`, q.childRef), &stats.Rows},
+		{fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s`, q.childRef, strings.Join(q.fromNull, " OR ")), &stats.NullRows},
+		{fmt.Sprintf(`SELECT COUNT(*) FROM %s c WHERE %s`, q.childRef, q.orphanCondition()), &stats.Orphans},
+		{fmt.Sprintf(`SELECT COALESCE(MAX(n), 0) FROM (SELECT COUNT(*) AS n FROM %s WHERE %s GROUP BY %s) s`,
+			q.childRef, strings.Join(q.fromNotNull, " AND "), strings.Join(q.from, ", ")), &stats.MaxChildren},
+		{fmt.Sprintf(`SELECT COUNT(*) FROM %s`, q.parentRef), &stats.Parents},
+		{fmt.Sprintf(`SELECT COUNT(*) FROM %s p WHERE NOT EXISTS (SELECT 1 FROM %s c WHERE %s)`,
+			q.parentRef, q.childRef, strings.Join(q.join, " AND ")), &stats.ChildlessParents},
+		{fmt.Sprintf(`SELECT COALESCE(MAX(n), 0) FROM (SELECT COUNT(*) AS n FROM %s WHERE %s GROUP BY %s) s`,
+			q.parentRef, strings.Join(q.toNotNull, " AND "), strings.Join(q.to, ", ")), &stats.MaxParents},
+	}
+	for _, query := range queries {
+		if err := db.QueryRowContext(ctx, query.query).Scan(query.dest); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+func prefixAll(prefix string, values []string) []string {
+	result := []string{}
+	for _, v := range values {
+		result = append(result, prefix+v)
+	}
+	return result
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/iwot/erdh-go/config"
+	"github.com/iwot/erdh-go/erdh"
+)
+
+func TestMeasureCardinalities(t *testing.T) {
+	path := createTestSQLite(t,
+		`CREATE TABLE members (id INTEGER PRIMARY KEY)`,
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY, member_id INTEGER REFERENCES members (id))`,
+		`CREATE TABLE prices (shop_id INTEGER, item_code TEXT, price INTEGER, PRIMARY KEY (shop_id, item_code))`,
+		`CREATE TABLE sales (id INTEGER PRIMARY KEY, shop_id INTEGER, item_code TEXT)`,
+		`INSERT INTO members (id) VALUES (1), (2), (3)`,
+		`INSERT INTO orders (id, member_id) VALUES (1, 1), (2, 1), (3, 2), (4, NULL), (5, 9)`,
+		`INSERT INTO prices (shop_id, item_code, price) VALUES (1, 'a', 100), (1, 'b', 200), (2, 'a', 110)`,
+		`INSERT INTO sales (id, shop_id, item_code) VALUES (1, 1, 'a'), (2, 1, 'b'), (3, 2, 'a')`,
+	)
+
+	cons, err := ReadSQLite(config.DBConfig{DBName: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cons.UpdateExRelationsFromForeignKeys()
+	cons.ApplyExInfo(config.ExtraConfig{Tables: []config.Table{
+		{Name: "sales", Relations: []config.ExRelation{{
+			ReferencedTableName: "prices",
+			Columns:             []config.ColumnRelation{{From: "shop_id", To: "shop_id"}, {From: "item_code", To: "item_code"}},
+			ThisConnection:      "only-one",
+			ThatConnection:      "only-one",
+		}}},
+		// 存在しないカラムのリレーションは集計しない
+		{Name: "members", Relations: []config.ExRelation{{
+			ReferencedTableName: "sales",
+			Columns:             []config.ColumnRelation{{From: "sale_id", To: "id"}},
+		}}},
+	}})
+
+	checks, err := MeasureCardinalities(context.Background(), "sqlite", config.DBConfig{DBName: path}, cons)
+	if err != nil {
+		t.Fatalf("failed test MeasureCardinalities %#v", err)
+	}
+	if len(checks) != 2 {
+		t.Fatalf("failed test MeasureCardinalities %#v", checks)
+	}
+
+	expected := erdh.CardinalityStats{Rows: 5, NullRows: 1, Orphans: 1, MaxChildren: 2, Parents: 3, ChildlessParents: 1, MaxParents: 1}
+	if checks[0].Table != "orders" || checks[0].Stats != expected {
+		t.Fatalf("failed test MeasureCardinalities orders %#v", checks[0])
+	}
+	if thisConn, thatConn := checks[0].ObservedConnections(); thisConn != "zero-many" || thatConn != "zero-or-one" {
+		t.Fatalf("failed test MeasureCardinalities observed %s %s", thisConn, thatConn)
+	}
+
+	expected = erdh.CardinalityStats{Rows: 3, MaxChildren: 1, Parents: 3, MaxParents: 1}
+	if checks[1].Table != "sales" || checks[1].Stats != expected || len(checks[1].Problems()) != 0 {
+		t.Fatalf("failed test MeasureCardinalities composite %#v", checks[1])
+	}
+}
+
+func TestMeasureCardinalitiesForeignKeysToSameTable(t *testing.T) {
+	path := createTestSQLite(t,
+		`CREATE TABLE members (id INTEGER PRIMARY KEY)`,
+		`CREATE TABLE orders (
+			id INTEGER PRIMARY KEY,
+			member_id INTEGER NOT NULL REFERENCES members (id),
+			reviewer_id INTEGER NOT NULL REFERENCES members (id)
+		)`,
+		`INSERT INTO members (id) VALUES (1), (2)`,
+		`INSERT INTO orders (id, member_id, reviewer_id) VALUES (1, 1, 2), (2, 2, 1)`,
+	)
+
+	cons, err := ReadSQLite(config.DBConfig{DBName: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cons.UpdateExRelationsFromForeignKeys()
+	if relations := cons.GetTableMut("orders").ExRelations; len(relations) != 1 || len(relations[0].Columns) != 2 {
+		t.Fatalf("failed test foreign keys to the same table are one relation %#v", relations)
+	}
+
+	// 2つの外部キーを複合キーとして扱わず、別々に集計する
+	checks, err := MeasureCardinalities(context.Background(), "sqlite", config.DBConfig{DBName: path}, cons)
+	if err != nil {
+		t.Fatalf("failed test MeasureCardinalities %#v", err)
+	}
+	if len(checks) != 2 || checks[0].Relation.Columns[0].From == checks[1].Relation.Columns[0].From {
+		t.Fatalf("failed test MeasureCardinalities per foreign key %#v", checks)
+	}
+	expected := erdh.CardinalityStats{Rows: 2, MaxChildren: 1, Parents: 2, MaxParents: 1}
+	for _, c := range checks {
+		if len(c.Relation.Columns) != 1 || c.Stats != expected || len(c.Problems()) != 0 {
+			t.Fatalf("failed test MeasureCardinalities %s %#v", c, c.Stats)
+		}
+		if thisConn, thatConn := c.ObservedConnections(); thisConn != "only-one" || thatConn != "only-one" {
+			t.Fatalf("failed test MeasureCardinalities observed %s", c)
+		}
+	}
+
+	proposal := erdh.ProposeExInfo(config.ExtraConfig{}, cons, checks)
+	relations := proposal.Tables[0].Relations
+	if len(relations) != 1 || len(relations[0].Columns) != 2 || relations[0].ThisConnection != "only-one" || relations[0].ThatConnection != "only-one" {
+		t.Fatalf("failed test ProposeExInfo %#v", proposal)
+	}
+}
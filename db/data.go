@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/iwot/erdh-go/config"
+	"github.com/iwot/erdh-go/erdh"
+)
+
+// ErrDataNotSupported は DiscoverRelations, MeasureCardinalities に対応していないDBを指定した場合のエラー
+var ErrDataNotSupported = errors.New("reading data is not supported")
+
+// dataDB はDBを開いて読み、データを調べるための関数
+type dataDB struct {
+	open  func(ctx context.Context, dbconf config.DBConfig) (*sql.DB, func(), error)
+	read  func(ctx context.Context, db *sql.DB, dbconf config.DBConfig) (*erdh.Construction, error)
+	quote func(name string) string
+}
+
+var dataDBs = map[string]dataDB{
+	"mysql": {
+		open: func(ctx context.Context, dbconf config.DBConfig) (*sql.DB, func(), error) {
+			return openMySQL(dbconf)
+		},
+		read:  readMySQLWith,
+		quote: quoteMySQLIdent,
+	},
+	"sqlite": {
+		open:  openSQLite,
+		read:  readSQLiteWith,
+		quote: quoteSQLiteIdent,
+	},
+}
+
+func lookupDataDB(target string) (dataDB, error) {
+	d, ok := dataDBs[strings.ToLower(target)]
+	if !ok {
+		return d, fmt.Errorf("%w for %s", ErrDataNotSupported, target)
+	}
+	return d, nil
+}
+
+// tableRef はスキーマで修飾したテーブルをSQLに埋め込む形式で返す
+func (d dataDB) tableRef(t erdh.Table) string {
+	if len(t.Schema) == 0 {
+		return d.quote(t.Name)
+	}
+	return d.quote(t.Schema) + "." + d.quote(t.LocalName())
+}
+
+// sourceDBConfig は読み込み元の source_from からDBの接続設定を読み、パスワードを適用する
+func sourceDBConfig(src config.SourceConfig) (*config.DBConfig, error) {
+	if _, err := lookupDataDB(src.Source); err != nil {
+		return nil, err
+	}
+	dbConf, err := config.NewDBConfigFromYamlFile(src.SourceFrom)
+	if err != nil {
+		return nil, err
+	}
+	if len(src.Password) > 0 {
+		dbConf.Password = src.Password
+	}
+	return dbConf, nil
+}
+
+func quoteMySQLIdent(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
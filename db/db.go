@@ -1,9 +1,12 @@
 package db
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"os"
 	"strings"
+	"sync"
 	"syscall"
 
 	"github.com/iwot/erdh-go/config"
@@ -11,18 +14,67 @@ import (
 	"golang.org/x/crypto/ssh/terminal"
 )
 
+// DBReader は DBConfig で指定したDBを読み、Constructionを返す
+type DBReader func(ctx context.Context, dbconf config.DBConfig) (*erdh.Construction, error)
+
+var (
+	dbReadersMu sync.RWMutex
+	dbReaders   = map[string]DBReader{}
+)
+
+func init() {
+	RegisterDB("mysql", ReadMySQLContext)
+	RegisterDB("sqlite", ReadSQLiteContext)
+	erdh.RegisterReader("ddl", erdh.ReaderFunc(func(ctx context.Context, src config.SourceConfig) (*erdh.Construction, error) {
+		return ReadDDL(src.SourceFrom)
+	}))
+}
+
+// RegisterDB は name（大文字小文字を区別しない）のDBの読み方を登録する
+// 登録したDBは ReadDB の target や設定ファイルの source に name を指定して読める
+// source_from にはDBの接続設定ファイルを指定する
+func RegisterDB(name string, r DBReader) {
+	dbReadersMu.Lock()
+	dbReaders[strings.ToLower(name)] = r
+	dbReadersMu.Unlock()
+
+	erdh.RegisterReader(name, erdh.ReaderFunc(func(ctx context.Context, src config.SourceConfig) (*erdh.Construction, error) {
+		dbConf, err := config.NewDBConfigFromYamlFile(src.SourceFrom)
+		if err != nil {
+			return nil, err
+		}
+		if len(src.Password) > 0 {
+			dbConf.Password = src.Password
+		}
+		return r(ctx, *dbConf)
+	}))
+}
+
 // ReadDB は対象DBを読み、Constructionを返す
 func ReadDB(target string, dbconf config.DBConfig) (*erdh.Construction, error) {
-	switch target {
-	case "mysql":
-		cons, err := ReadMySQL(dbconf)
-		return cons, err
-	case "sqlite":
-		cons, err := ReadSQLite(dbconf)
-		return cons, err
-	default:
+	return ReadDBContext(context.Background(), target, dbconf)
+}
+
+// ReadDBContext は ctx を用いて対象DBを読み、Constructionを返す
+func ReadDBContext(ctx context.Context, target string, dbconf config.DBConfig) (*erdh.Construction, error) {
+	dbReadersMu.RLock()
+	r, ok := dbReaders[strings.ToLower(target)]
+	dbReadersMu.RUnlock()
+	if !ok {
 		return &erdh.Construction{}, errors.New("invalid target")
 	}
+	return r(ctx, dbconf)
+}
+
+// ReadSource は読み込み元の定義に従ってConstructionを返す
+// 読み込み元は erdh.RegisterReader、RegisterDB で登録したものから選ぶ
+func ReadSource(src config.SourceConfig) (*erdh.Construction, error) {
+	return erdh.ReadSource(context.Background(), src)
+}
+
+// ReadIntermediate は中間形式ファイルを拡張子（.json またはそれ以外はYAML）に従って読み、Constructionを返す
+func ReadIntermediate(path string) (*erdh.Construction, error) {
+	return erdh.NewConstructionFromFile(path)
 }
 
 // ReadYAML は中間形式ファイルを読み、Constructionを返す
@@ -31,12 +83,16 @@ func ReadYAML(path string) (*erdh.Construction, error) {
 }
 
 func readConsolePassword() (string, error) {
-	fmt.Print("Enter DB Password: ")
+	if !terminal.IsTerminal(int(syscall.Stdin)) {
+		return "", errors.New("password is not given and stdin is not a terminal (use password_file, option_file or -password-stdin)")
+	}
+	// 標準出力には図を出力するため、プロンプトは標準エラー出力に出す
+	fmt.Fprint(os.Stderr, "Enter DB Password: ")
 	bytePassword, err := terminal.ReadPassword(int(syscall.Stdin))
 	if err != nil {
 		return "", err
 	}
 	passwd := string(bytePassword)
-	fmt.Println("")
+	fmt.Fprintln(os.Stderr, "")
 	return strings.TrimSpace(passwd), nil
 }
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/iwot/erdh-go/erdh"
+)
+
+var createTableReg = regexp.MustCompile(`(?is)^\s*CREATE\s+(TEMP\s+|TEMPORARY\s+)?TABLE\s`)
+
+// ReadDDL はCREATE TABLE文を記述したファイルを読み、Constructionを返す
+func ReadDDL(path string) (*erdh.Construction, error) {
+	var cons erdh.Construction
+
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return &cons, err
+	}
+
+	cons.DBName = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	for _, query := range splitStatements(string(buf)) {
+		if !createTableReg.MatchString(query) {
+			continue
+		}
+		table, err := parseCreateQuery(query, cons.DBName, "")
+		if err != nil {
+			return &cons, err
+		}
+		cons.Tables = append(cons.Tables, table)
+	}
+
+	return &cons, nil
+}
+
+// splitStatements はSQLを ; で文に分割する。コメントは取り除く
+// 文字列（'...'）、引用符で囲んだ識別子（"...", `...`, [...]）とコメント（-- ..., /* ... */）の中の ; では分割しない
+func splitStatements(sql string) []string {
+	result := []string{}
+	var b strings.Builder
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == ';':
+			result = append(result, b.String())
+			b.Reset()
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end
+			}
+			b.WriteByte('\n')
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end + 3
+			}
+			b.WriteByte(' ')
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			// 閉じる引用符を2つ続けたものはエスケープとして扱う
+			j := i + 1
+			for j < len(sql) {
+				if sql[j] == closing {
+					if j+1 < len(sql) && sql[j+1] == closing && closing != ']' {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			if j >= len(sql) {
+				j = len(sql) - 1
+			}
+			b.WriteString(sql[i : j+1])
+			i = j
+		default:
+			b.WriteByte(c)
+		}
+	}
+	if len(strings.TrimSpace(b.String())) > 0 {
+		result = append(result, b.String())
+	}
+	return result
+}
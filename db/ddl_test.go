@@ -0,0 +1,55 @@
+package db
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		sql      string
+		expected []string
+	}{
+		{"CREATE TABLE a (id int); CREATE TABLE b (id int);", []string{"CREATE TABLE a (id int)", " CREATE TABLE b (id int)"}},
+		{"CREATE TABLE a (s text DEFAULT 'a;b', t text DEFAULT 'it''s;')", []string{"CREATE TABLE a (s text DEFAULT 'a;b', t text DEFAULT 'it''s;')"}},
+		{"CREATE TABLE \"a;b\" (`c;d` int, [e;f] int)", []string{"CREATE TABLE \"a;b\" (`c;d` int, [e;f] int)"}},
+		{"CREATE TABLE a (x int CHECK (x <> ';'))", []string{"CREATE TABLE a (x int CHECK (x <> ';'))"}},
+		{"CREATE TABLE a (id int) -- end; of a\n;/* b; */CREATE TABLE b (id int)", []string{"CREATE TABLE a (id int) \n", " CREATE TABLE b (id int)"}},
+		{"CREATE TABLE a (s text DEFAULT 'unterminated;", []string{"CREATE TABLE a (s text DEFAULT 'unterminated;"}},
+	}
+	for _, test := range tests {
+		if got := splitStatements(test.sql); !reflect.DeepEqual(got, test.expected) {
+			t.Fatalf("failed test splitStatements %#v", got)
+		}
+	}
+}
+
+func TestReadDDL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shop.sql")
+	ioutil.WriteFile(path, []byte(`
+/* tables; for the shop */
+CREATE TABLE members (
+  id INTEGER PRIMARY KEY,
+  note TEXT DEFAULT 'a;b' -- default with ;
+);
+CREATE TABLE orders (
+  id INTEGER PRIMARY KEY,
+  member_id INTEGER REFERENCES members (id),
+  status TEXT DEFAULT 'new;' /* ; */
+);
+`), 0644)
+
+	cons, err := ReadDDL(path)
+	if err != nil {
+		t.Fatalf("failed test ReadDDL %#v", err)
+	}
+	if cons.DBName != "shop" || len(cons.Tables) != 2 {
+		t.Fatalf("failed test ReadDDL %#v", cons)
+	}
+	if len(cons.Tables[0].Columns) != 2 || len(cons.Tables[1].Columns) != 3 || !strings.Contains(cons.Tables[0].Columns[1].Default, "a;b") {
+		t.Fatalf("failed test ReadDDL columns %#v", cons.Tables)
+	}
+}
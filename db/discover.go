@@ -0,0 +1,144 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"github.com/iwot/erdh-go/config"
+	"github.com/iwot/erdh-go/erdh"
+)
+
+// DiscoverOptions は DiscoverRelations の設定
+type DiscoverOptions struct {
+	// SampleSize は候補ごとに調べる参照元の値（重複しない値）の最大数。0 であれば 1000
+	SampleSize int
+	// MinDistinct は候補とするのに必要な参照元の値の数。0 であれば 3
+	MinDistinct int
+	// MinConfidence は候補とするのに必要な、参照元の値が参照先に含まれる割合。0 であれば 0.95
+	MinConfidence float64
+	// MaxCandidates は調べる候補（参照元と参照先のカラムの組）の最大数。0 であれば 10000
+	// 超えた場合はカラム名が参照先を指す候補を優先する
+	MaxCandidates int
+	// Tables は調べる参照元のテーブル。空であればすべてのテーブルを調べる
+	Tables []string
+	// ExInfo は適用する ex_info。ex_info ですでにリレーションを指定したカラムは調べない
+	ExInfo *config.ExtraConfig
+	// Log は進捗の出力先。nil であれば出力しない
+	Log io.Writer
+}
+
+// discoverProgressInterval は進捗を出力する候補の数の間隔
+const discoverProgressInterval = 100
+
+func (o DiscoverOptions) withDefaults() DiscoverOptions {
+	if o.SampleSize <= 0 {
+		o.SampleSize = 1000
+	}
+	if o.MinDistinct <= 0 {
+		o.MinDistinct = 3
+	}
+	if o.MinConfidence <= 0 {
+		o.MinConfidence = 0.95
+	}
+	if o.MaxCandidates <= 0 {
+		o.MaxCandidates = 10000
+	}
+	if o.Log == nil {
+		o.Log = ioutil.Discard
+	}
+	return o
+}
+
+// DiscoverRelations は対象DBを読み、外部キーと ex_info のリレーションのないカラムの値を調べてリレーションの候補を探す
+// 参照元の値を SampleSize 個まで取り出し、参照先に含まれる割合が MinConfidence 以上のものを返す
+// 読んで ex_info を適用したConstructionも返す
+func DiscoverRelations(ctx context.Context, target string, dbconf config.DBConfig, opts DiscoverOptions) (*erdh.Construction, []erdh.DiscoveredRelation, error) {
+	d, err := lookupDataDB(target)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts = opts.withDefaults()
+
+	db, closeDB, err := d.open(ctx, dbconf)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer closeDB()
+
+	cons, err := d.read(ctx, db, dbconf)
+	if err != nil {
+		return nil, nil, err
+	}
+	cons.UpdateExRelationsFromForeignKeys()
+	if opts.ExInfo != nil {
+		cons.ApplyExInfo(*opts.ExInfo)
+	}
+
+	tables := map[string]erdh.Table{}
+	for _, t := range cons.Tables {
+		tables[t.Name] = t
+	}
+
+	candidates := cons.PrioritizeCandidates(filterCandidates(cons.RelationCandidates(), opts.Tables))
+	if len(candidates) > opts.MaxCandidates {
+		fmt.Fprintf(opts.Log, "%d candidates found, sampling only the first %d\n", len(candidates), opts.MaxCandidates)
+		candidates = candidates[:opts.MaxCandidates]
+	}
+
+	result := []erdh.DiscoveredRelation{}
+	for i, c := range candidates {
+		if i > 0 && i%discoverProgressInterval == 0 {
+			fmt.Fprintf(opts.Log, "%d of %d candidates sampled\n", i, len(candidates))
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		query := fmt.Sprintf(`
+		SELECT COUNT(*), COALESCE(SUM(CASE WHEN EXISTS (SELECT 1 FROM %s p WHERE p.%s = s.v) THEN 1 ELSE 0 END), 0)
+		  FROM (SELECT DISTINCT %s AS v FROM %s WHERE %s IS NOT NULL LIMIT ?) s`,
+			d.tableRef(tables[c.ReferencedTable]), d.quote(c.ReferencedColumn),
+			d.quote(c.Column), d.tableRef(tables[c.Table]), d.quote(c.Column))
+
+		found := erdh.DiscoveredRelation{RelationCandidate: c}
+		err := db.QueryRowContext(ctx, query, opts.SampleSize).Scan(&found.Sampled, &found.Matched)
+		if err != nil {
+			return nil, nil, fmt.Errorf("sample %s.%s: %w", c.Table, c.Column, err)
+		}
+		if found.Sampled >= opts.MinDistinct && found.Confidence() >= opts.MinConfidence {
+			result = append(result, found)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Confidence() > result[j].Confidence() })
+	return cons, result, nil
+}
+
+// filterCandidates は参照元が tables のいずれかである候補を返す。tables が空であればすべての候補を返す
+func filterCandidates(candidates []erdh.RelationCandidate, tables []string) []erdh.RelationCandidate {
+	if len(tables) == 0 {
+		return candidates
+	}
+	target := map[string]bool{}
+	for _, t := range tables {
+		target[t] = true
+	}
+	result := []erdh.RelationCandidate{}
+	for _, c := range candidates {
+		if target[c.Table] {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// DiscoverSource は読み込み元（source_from にDBの接続設定ファイルを指定したもの）について DiscoverRelations を行う
+func DiscoverSource(ctx context.Context, src config.SourceConfig, opts DiscoverOptions) (*erdh.Construction, []erdh.DiscoveredRelation, error) {
+	dbConf, err := sourceDBConfig(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	return DiscoverRelations(ctx, src.Source, *dbConf, opts)
+}
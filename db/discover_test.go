@@ -0,0 +1,106 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/iwot/erdh-go/config"
+	"github.com/iwot/erdh-go/erdh"
+)
+
+func TestDiscoverRelations(t *testing.T) {
+	path := createTestSQLite(t,
+		`CREATE TABLE members (id INTEGER PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE items (id INTEGER PRIMARY KEY, code TEXT NOT NULL UNIQUE)`,
+		`CREATE TABLE orders (
+			id INTEGER PRIMARY KEY,
+			member_id INTEGER NOT NULL,
+			item_code TEXT,
+			quantity INTEGER,
+			note TEXT
+		)`,
+		`INSERT INTO members (id, name) VALUES (1, 'a'), (2, 'b'), (3, 'c'), (4, 'd'), (5, 'e')`,
+		`INSERT INTO items (id, code) VALUES (1, 'x1'), (2, 'x2'), (3, 'x3'), (10, 'x10')`,
+		`INSERT INTO orders (id, member_id, item_code, quantity, note) VALUES
+			(1, 1, 'x1', 100, 'x1'),
+			(2, 2, 'x2', 200, 'n'),
+			(3, 5, 'x3', 300, 'm'),
+			(4, 5, NULL, 1, NULL)`,
+	)
+
+	cons, found, err := DiscoverRelations(context.Background(), "sqlite", config.DBConfig{DBName: path}, DiscoverOptions{})
+	if err != nil {
+		t.Fatalf("failed test DiscoverRelations %#v", err)
+	}
+	got := []string{}
+	for _, d := range found {
+		got = append(got, d.Table+"."+d.Column+"->"+d.ReferencedTable+"."+d.ReferencedColumn)
+	}
+	// member_id は members.id にも items.id にも含まれうるが、items.id には5がない
+	expected := []string{"orders.member_id->members.id", "orders.item_code->items.code"}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Fatalf("failed test DiscoverRelations %#v", got)
+	}
+	if found[0].Sampled != 3 || found[0].Matched != 3 {
+		t.Fatalf("failed test DiscoverRelations sample %#v", found[0])
+	}
+
+	var b bytes.Buffer
+	if err := erdh.WriteDiscoveredExInfo(&b, cons, found); err != nil {
+		t.Fatal(err)
+	}
+	exInfo, err := config.NewExtraConfigFromYaml(b.Bytes())
+	if err != nil {
+		t.Fatalf("failed test discovered ex_info is valid yaml %v\n%s", err, b.String())
+	}
+	if issues := cons.ValidateExInfo(*exInfo, nil); len(issues) > 0 {
+		t.Fatalf("failed test discovered ex_info %#v\n%s", issues, b.String())
+	}
+	relations := exInfo.Tables[0].Relations
+	if len(relations) != 2 || relations[0].ReferencedTableName != "items" || relations[1].ThatConnection != "only-one" || relations[1].Style != erdh.RelationStyleDashed {
+		t.Fatalf("failed test discovered ex_info\n%s", b.String())
+	}
+
+	// ex_info でリレーションを指定したカラムは調べない
+	exInfo = &config.ExtraConfig{Tables: []config.Table{{Name: "orders", Group: "DATA", Relations: []config.ExRelation{{
+		ReferencedTableName: "members",
+		Columns:             []config.ColumnRelation{{From: "member_id", To: "id"}},
+	}}}}}
+	_, found, err = DiscoverRelations(context.Background(), "sqlite", config.DBConfig{DBName: path}, DiscoverOptions{ExInfo: exInfo})
+	if err != nil || len(found) != 1 || found[0].Column != "item_code" {
+		t.Fatalf("failed test DiscoverRelations with ex_info %#v %#v", found, err)
+	}
+
+	// 候補の数を制限した場合はカラム名が参照先を指す候補を優先し、進捗を出力する
+	var log bytes.Buffer
+	_, found, err = DiscoverRelations(context.Background(), "sqlite", config.DBConfig{DBName: path}, DiscoverOptions{MaxCandidates: 2, Log: &log})
+	if err != nil || len(found) != 2 || !strings.Contains(log.String(), "sampling only the first 2") {
+		t.Fatalf("failed test DiscoverRelations max candidates %#v %#v %s", found, err, log.String())
+	}
+
+	// 参照元のテーブルを指定した場合はそのテーブルだけを調べる
+	_, found, err = DiscoverRelations(context.Background(), "sqlite", config.DBConfig{DBName: path}, DiscoverOptions{Tables: []string{"members"}})
+	if err != nil || len(found) != 0 {
+		t.Fatalf("failed test DiscoverRelations tables %#v %#v", found, err)
+	}
+
+	// 外部キーのあるカラムは調べない
+	path = createTestSQLite(t,
+		`CREATE TABLE members (id INTEGER PRIMARY KEY)`,
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY, member_id INTEGER REFERENCES members (id))`,
+		`INSERT INTO members (id) VALUES (1), (2), (3)`,
+		`INSERT INTO orders (id, member_id) VALUES (1, 1), (2, 2), (3, 3)`,
+	)
+	_, found, err = DiscoverRelations(context.Background(), "sqlite", config.DBConfig{DBName: path}, DiscoverOptions{})
+	if err != nil || len(found) != 0 {
+		t.Fatalf("failed test DiscoverRelations with foreign key %#v %#v", found, err)
+	}
+
+	_, _, err = DiscoverRelations(context.Background(), "ddl", config.DBConfig{}, DiscoverOptions{})
+	if !errors.Is(err, ErrDataNotSupported) {
+		t.Fatalf("failed test DiscoverRelations unsupported %#v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/iwot/erdh-go/config"
+	"github.com/iwot/erdh-go/erdh"
+)
+
+// IntegrityOptions は CheckIntegrity の設定
+type IntegrityOptions struct {
+	// SampleSize はリレーションごとに取り出す参照先のない値の最大数。0 であれば 10
+	SampleSize int
+	// IncludeForeignKeys がtrueであれば外部キーに由来するリレーションも調べる
+	IncludeForeignKeys bool
+}
+
+func (o IntegrityOptions) withDefaults() IntegrityOptions {
+	if o.SampleSize <= 0 {
+		o.SampleSize = 10
+	}
+	return o
+}
+
+// CheckIntegrity は cons のリレーションごとに、参照先に対応する行のない参照元の行を対象DBのデータから数える
+// 外部キーはDBが整合性を保つため、既定では ex_info で定義したカラムの組だけを調べる
+// リレーションは外部キーの制約ごと（ExRelation.SplitByColumnGroups）に調べる
+// 参照元、参照先のテーブルとカラムが対象DBにないリレーションとカラムのないリレーションは調べない
+func CheckIntegrity(ctx context.Context, target string, dbconf config.DBConfig, cons *erdh.Construction, opts IntegrityOptions) ([]erdh.IntegrityResult, error) {
+	d, err := lookupDataDB(target)
+	if err != nil {
+		return nil, err
+	}
+	opts = opts.withDefaults()
+
+	db, closeDB, err := d.open(ctx, dbconf)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDB()
+
+	dbCons, err := d.read(ctx, db, dbconf)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []erdh.IntegrityResult{}
+	for _, t := range cons.Tables {
+		child := dbCons.GetTableMut(t.Name)
+		if child == nil {
+			continue
+		}
+		for _, rel := range t.ExRelations {
+			parent := dbCons.GetTableMut(rel.ReferencedTableName)
+			if parent == nil {
+				continue
+			}
+			// 同じテーブルへの複数の外部キーと、外部キーのリレーションに ex_info で加えたカラムは別々に調べる
+			for _, exr := range rel.SplitByColumnGroups() {
+				if exr.Source == erdh.RelationSourceForeignKey && !opts.IncludeForeignKeys {
+					continue
+				}
+				if !hasRelationColumns(*child, *parent, exr) {
+					continue
+				}
+				r, err := checkIntegrity(ctx, db, d, *child, *parent, exr, opts.SampleSize)
+				if err != nil {
+					return nil, fmt.Errorf("check %s -> %s: %w", t.Name, exr.ReferencedTableName, err)
+				}
+				result = append(result, r)
+			}
+		}
+	}
+	return result, nil
+}
+
+// CheckSourceIntegrity は読み込み元（source_from にDBの接続設定ファイルを指定したもの）について CheckIntegrity を行う
+func CheckSourceIntegrity(ctx context.Context, src config.SourceConfig, cons *erdh.Construction, opts IntegrityOptions) ([]erdh.IntegrityResult, error) {
+	dbConf, err := sourceDBConfig(src)
+	if err != nil {
+		return nil, err
+	}
+	return CheckIntegrity(ctx, src.Source, *dbConf, cons, opts)
+}
+
+// checkIntegrity はリレーションの参照元の行数と参照先のない行数を数え、参照先のない値を sampleSize 個まで取り出す
+func checkIntegrity(ctx context.Context, db *sql.DB, d dataDB, child, parent erdh.Table, exr erdh.ExRelation, sampleSize int) (erdh.IntegrityResult, error) {
+	r := erdh.IntegrityResult{
+		Table:           child.Name,
+		ReferencedTable: parent.Name,
+		Columns:         exr.Columns,
+		Source:          exr.Source,
+	}
+	q := newRelationQuery(d, child, parent, exr)
+
+	if err := db.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM %s`, q.childRef)).Scan(&r.Rows); err != nil {
+		return r, err
+	}
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM %s c WHERE %s`, q.childRef, q.orphanCondition())
+	if err := db.QueryRowContext(ctx, query).Scan(&r.Orphans); err != nil {
+		return r, err
+	}
+	if r.Orphans == 0 {
+		return r, nil
+	}
+
+	from := strings.Join(prefixAll("c.", q.from), ", ")
+	query = fmt.Sprintf(`SELECT DISTINCT %s FROM %s c WHERE %s ORDER BY %s LIMIT ?`, from, q.childRef, q.orphanCondition(), from)
+	rows, err := db.QueryContext(ctx, query, sampleSize)
+	if err != nil {
+		return r, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		values := make([]sql.NullString, len(q.from))
+		dest := make([]interface{}, len(values))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return r, err
+		}
+		sample := []string{}
+		for _, v := range values {
+			sample = append(sample, v.String)
+		}
+		r.Samples = append(r.Samples, sample)
+	}
+	return r, rows.Err()
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/iwot/erdh-go/config"
+)
+
+func TestCheckIntegrity(t *testing.T) {
+	path := createTestSQLite(t,
+		`CREATE TABLE members (id INTEGER PRIMARY KEY)`,
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY, member_id INTEGER REFERENCES members (id))`,
+		`CREATE TABLE prices (shop_id INTEGER, item_code TEXT, PRIMARY KEY (shop_id, item_code))`,
+		`CREATE TABLE sales (id INTEGER PRIMARY KEY, shop_id INTEGER, item_code TEXT, member_id INTEGER)`,
+		`INSERT INTO members (id) VALUES (1), (2)`,
+		`INSERT INTO orders (id, member_id) VALUES (1, 1), (2, 9)`,
+		`INSERT INTO prices (shop_id, item_code) VALUES (1, 'a'), (1, 'b')`,
+		`INSERT INTO sales (id, shop_id, item_code, member_id) VALUES (1, 1, 'a', 1), (2, 1, 'c', 2), (3, 2, 'a', NULL), (4, 2, 'a', 2), (5, NULL, 'x', 2)`,
+	)
+
+	cons, err := ReadSQLite(config.DBConfig{DBName: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cons.UpdateExRelationsFromForeignKeys()
+	cons.ApplyExInfo(config.ExtraConfig{Tables: []config.Table{
+		{Name: "sales", Relations: []config.ExRelation{
+			{
+				ReferencedTableName: "prices",
+				Columns:             []config.ColumnRelation{{From: "shop_id", To: "shop_id"}, {From: "item_code", To: "item_code"}},
+			},
+			{
+				ReferencedTableName: "members",
+				Columns:             []config.ColumnRelation{{From: "member_id", To: "id"}},
+			},
+		}},
+	}})
+
+	results, err := CheckIntegrity(context.Background(), "sqlite", config.DBConfig{DBName: path}, cons, IntegrityOptions{SampleSize: 1})
+	if err != nil {
+		t.Fatalf("failed test CheckIntegrity %#v", err)
+	}
+	// 外部キーに由来する orders -> members は既定では調べない
+	if len(results) != 2 {
+		t.Fatalf("failed test CheckIntegrity %#v", results)
+	}
+	prices, members := results[0], results[1]
+	if prices.ReferencedTable != "prices" || prices.Rows != 5 || prices.Orphans != 3 {
+		t.Fatalf("failed test CheckIntegrity composite %#v", prices)
+	}
+	if !reflect.DeepEqual(prices.Samples, [][]string{{"1", "c"}}) {
+		t.Fatalf("failed test CheckIntegrity samples %#v", prices.Samples)
+	}
+	if members.ReferencedTable != "members" || members.Orphans != 0 || len(members.Samples) != 0 {
+		t.Fatalf("failed test CheckIntegrity %#v", members)
+	}
+
+	results, err = CheckIntegrity(context.Background(), "sqlite", config.DBConfig{DBName: path}, cons, IntegrityOptions{IncludeForeignKeys: true})
+	if err != nil {
+		t.Fatalf("failed test CheckIntegrity %#v", err)
+	}
+	if len(results) != 3 || results[0].Table != "orders" || results[0].Orphans != 1 ||
+		!reflect.DeepEqual(results[0].Samples, [][]string{{"9"}}) {
+		t.Fatalf("failed test CheckIntegrity include fk %#v", results)
+	}
+	if !reflect.DeepEqual(results[1].Samples, [][]string{{"1", "c"}, {"2", "a"}}) {
+		t.Fatalf("failed test CheckIntegrity distinct samples %#v", results[1].Samples)
+	}
+}
+
+func TestCheckIntegrityForeignKeysToSameTable(t *testing.T) {
+	path := createTestSQLite(t,
+		`CREATE TABLE members (id INTEGER PRIMARY KEY)`,
+		`CREATE TABLE orders (
+			id INTEGER PRIMARY KEY,
+			member_id INTEGER REFERENCES members (id),
+			reviewer_id INTEGER REFERENCES members (id),
+			editor_id INTEGER
+		)`,
+		`INSERT INTO members (id) VALUES (1), (2)`,
+		`INSERT INTO orders (id, member_id, reviewer_id, editor_id) VALUES (1, 1, 2, 1), (2, 2, 1, 7)`,
+	)
+
+	cons, err := ReadSQLite(config.DBConfig{DBName: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cons.UpdateExRelationsFromForeignKeys()
+	// 外部キーのリレーションに ex_info で論理的なカラムを加える
+	cons.ApplyExInfo(config.ExtraConfig{Tables: []config.Table{
+		{Name: "orders", Relations: []config.ExRelation{{
+			ReferencedTableName: "members",
+			Columns:             []config.ColumnRelation{{From: "editor_id", To: "id"}},
+		}}},
+	}})
+
+	// 既定では ex_info で加えたカラムだけを調べる
+	results, err := CheckIntegrity(context.Background(), "sqlite", config.DBConfig{DBName: path}, cons, IntegrityOptions{})
+	if err != nil {
+		t.Fatalf("failed test CheckIntegrity %#v", err)
+	}
+	if len(results) != 1 || results[0].Source != "ex_info" || results[0].Columns[0].From != "editor_id" ||
+		results[0].Orphans != 1 || !reflect.DeepEqual(results[0].Samples, [][]string{{"7"}}) {
+		t.Fatalf("failed test CheckIntegrity ex_info columns on foreign key relation %#v", results)
+	}
+
+	// 2つの外部キーを複合キーとして扱わず、別々に調べる
+	results, err = CheckIntegrity(context.Background(), "sqlite", config.DBConfig{DBName: path}, cons, IntegrityOptions{IncludeForeignKeys: true})
+	if err != nil {
+		t.Fatalf("failed test CheckIntegrity %#v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("failed test CheckIntegrity include fk %#v", results)
+	}
+	for _, r := range results[:2] {
+		if r.Source != "fk" || len(r.Columns) != 1 || r.Rows != 2 || r.Orphans != 0 {
+			t.Fatalf("failed test CheckIntegrity per foreign key %#v", r)
+		}
+	}
+}
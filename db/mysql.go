@@ -1,82 +1,230 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"strings"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	"github.com/iwot/erdh-go/config"
 	"github.com/iwot/erdh-go/erdh"
 )
 
 // ReadMySQL は対象DBを読み、Constructionを返す
 func ReadMySQL(dbconf config.DBConfig) (*erdh.Construction, error) {
+	return ReadMySQLContext(context.Background(), dbconf)
+}
+
+// ReadMySQLContext は ctx を用いて対象DBを読み、Constructionを返す
+func ReadMySQLContext(ctx context.Context, dbconf config.DBConfig) (*erdh.Construction, error) {
+	db, closeDB, err := openMySQL(dbconf)
+	if err != nil {
+		return &erdh.Construction{}, err
+	}
+	defer closeDB()
+
+	return readMySQLWith(ctx, db, dbconf)
+}
+
+// readMySQLWith は openMySQL で開いたDBを読み、Constructionを返す
+func readMySQLWith(ctx context.Context, db *sql.DB, dbconf config.DBConfig) (*erdh.Construction, error) {
 	var cons erdh.Construction
 
+	err := readMySQLDBName(ctx, db, &cons)
+	if err != nil {
+		return &cons, err
+	}
+
+	schemas, err := readMySQLSchemas(ctx, db, dbconf, cons.DBName)
+	if err != nil {
+		return &cons, err
+	}
+	qualify := dbconf.IsMultiSchema()
+	for _, schema := range schemas {
+		err = readMySQLTables(ctx, db, &cons, schema, qualify, dbconf.CollectStats)
+		if err != nil {
+			return &cons, err
+		}
+	}
+
+	for _, tbl := range cons.Tables {
+		err = readMySQLTableColumns(ctx, db, &cons, tbl)
+		if err != nil {
+			return &cons, err
+		}
+		err = readMySQLTableIndexes(ctx, db, &cons, tbl)
+		if err != nil {
+			return &cons, err
+		}
+		err = readMySQLTableForeginKeys(ctx, db, &cons, tbl, qualify)
+		if err != nil {
+			return &cons, err
+		}
+	}
+
+	return &cons, nil
+}
+
+// openMySQL は接続情報を解決してDBを開く
+// 返す関数でDBと（あれば）SSHトンネルを閉じる
+func openMySQL(dbconf config.DBConfig) (*sql.DB, func(), error) {
+	err := dbconf.ResolveCredentials()
+	if err != nil {
+		return nil, nil, err
+	}
 	if len(dbconf.Password) == 0 {
 		passwd, err := readConsolePassword()
 		if err != nil {
-			return &cons, err
+			return nil, nil, err
 		}
 		dbconf.Password = passwd
 	}
-	dsn, err := dbconf.ToDSN()
+	if dbconf.HasCustomTLS() {
+		tlsConf, err := dbconf.BuildTLSConfig()
+		if err != nil {
+			return nil, nil, err
+		}
+		err = mysql.RegisterTLSConfig(dbconf.TLSConfigName(), tlsConf)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	network := dbconf.Network()
+	var tunnel *sshTunnel
+	releaseDial := func() {}
+	if dbconf.SSH != nil {
+		tunnel, err = openSSHTunnel(*dbconf.SSH)
+		if err != nil {
+			return nil, nil, err
+		}
+		network, releaseDial = registerMySQLSSHDial(tunnel, dbconf.Network())
+	}
+	closeTunnel := func() {
+		if tunnel != nil {
+			releaseDial()
+			tunnel.Close()
+		}
+	}
+
+	dsn, err := dbconf.ToDSNVia(network)
 	if err != nil {
-		return &cons, err
+		closeTunnel()
+		return nil, nil, err
 	}
 
 	db, err := sql.Open(dbconf.DBType, dsn)
 	if err != nil {
-		return &cons, err
+		closeTunnel()
+		return nil, nil, err
 	}
-	defer db.Close()
 
-	readMySQLDBName(db, &cons)
+	return db, func() {
+		db.Close()
+		closeTunnel()
+	}, nil
+}
 
-	readMySQLTables(db, &cons)
+func readMySQLDBName(ctx context.Context, db *sql.DB, cons *erdh.Construction) error {
+	rows, err := db.QueryContext(ctx, "SELECT database() AS db_name")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var dbName sql.NullString
+		err := rows.Scan(&dbName)
+		if err != nil {
+			return err
+		}
+		cons.DBName = dbName.String
+		break
+	}
+	return rows.Err()
+}
 
-	for _, tbl := range cons.Tables {
-		readMySQLTableColumns(db, &cons, tbl.Name)
-		readMySQLTableIndexes(db, &cons, tbl.Name)
-		readMySQLTableForeginKeys(db, &cons, tbl.Name)
+// readMySQLSchemas は読み込み対象のスキーマ一覧を返す
+func readMySQLSchemas(ctx context.Context, db *sql.DB, dbconf config.DBConfig, dbName string) ([]string, error) {
+	if len(dbconf.Schemas) > 0 {
+		return dbconf.Schemas, nil
+	}
+	if len(dbconf.SchemaPattern) == 0 {
+		return []string{dbName}, nil
 	}
 
-	return &cons, nil
-}
+	query := `
+	SELECT schema_name
+	  FROM information_schema.schemata
+	 WHERE schema_name LIKE ?
+	 ORDER BY schema_name`
 
-func readMySQLDBName(db *sql.DB, cons *erdh.Construction) {
-	rows, err := db.Query("SELECT database() AS db_name")
+	rows, err := db.QueryContext(ctx, query, dbconf.SchemaPattern)
 	if err != nil {
-		panic(err.Error())
+		return nil, err
 	}
+	defer rows.Close()
+	schemas := []string{}
 	for rows.Next() {
-		var dbName string
-		err := rows.Scan(&dbName)
+		var schema string
+		err := rows.Scan(&schema)
 		if err != nil {
-			panic(err.Error())
+			return nil, err
 		}
-		cons.DBName = dbName
-		break
+		schemas = append(schemas, schema)
 	}
+	return schemas, rows.Err()
 }
 
-func readMySQLTables(db *sql.DB, cons *erdh.Construction) {
-	rows, err := db.Query("show tables")
+// readMySQLTables はスキーマのテーブルを読む
+// collectStats がtrueであれば information_schema.tables の統計情報も読む（ビューは統計情報を持たない）
+func readMySQLTables(ctx context.Context, db *sql.DB, cons *erdh.Construction, schema string, qualify, collectStats bool) error {
+	query := `
+	SELECT table_name, table_type, table_rows, data_length, index_length, engine, table_collation, auto_increment
+	  FROM information_schema.tables
+	 WHERE table_schema = ?
+	 ORDER BY table_name`
+
+	rows, err := db.QueryContext(ctx, query, schema)
 	if err != nil {
-		panic(err.Error())
+		return err
 	}
+	defer rows.Close()
 	for rows.Next() {
-		var tblName string
-		err := rows.Scan(&tblName)
+		var (
+			tblName       string
+			tableType     string
+			tableRows     sql.NullInt64
+			dataLength    sql.NullInt64
+			indexLength   sql.NullInt64
+			engine        sql.NullString
+			collation     sql.NullString
+			autoIncrement sql.NullInt64
+		)
+		err := rows.Scan(&tblName, &tableType, &tableRows, &dataLength, &indexLength, &engine, &collation, &autoIncrement)
 		if err != nil {
-			panic(err.Error())
+			return err
+		}
+		tbl := erdh.Table{Name: tblName, Schema: schema, Group: schema}
+		if qualify {
+			tbl.Name = erdh.QualifiedTableName(schema, tblName)
 		}
-		cons.Tables = append(cons.Tables, erdh.Table{Name: tblName, Group:cons.DBName})
+		if collectStats && tableType != "VIEW" {
+			tbl.Stats = &erdh.TableStats{
+				Rows:          tableRows.Int64,
+				DataLength:    dataLength.Int64,
+				IndexLength:   indexLength.Int64,
+				Engine:        engine.String,
+				Collation:     collation.String,
+				AutoIncrement: autoIncrement.Int64,
+			}
+		}
+		cons.Tables = append(cons.Tables, tbl)
 	}
+	return rows.Err()
 }
 
-func readMySQLTableColumns(db *sql.DB, cons *erdh.Construction, tableName string) {
-	table := cons.GetTableMut(tableName)
+func readMySQLTableColumns(ctx context.Context, db *sql.DB, cons *erdh.Construction, tbl erdh.Table) error {
+	table := cons.GetTableMut(tbl.Name)
 
 	query := `
 	SELECT column_name
@@ -90,16 +238,17 @@ func readMySQLTableColumns(db *sql.DB, cons *erdh.Construction, tableName string
     AND c.table_name = ?
 	ORDER BY ordinal_position`
 
-	stmt, err := db.Prepare(query)
+	stmt, err := db.PrepareContext(ctx, query)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer stmt.Close()
 
-	rows, err := stmt.Query(cons.DBName, tableName)
+	rows, err := stmt.QueryContext(ctx, tbl.Schema, tbl.LocalName())
 	if err != nil {
-		panic(err)
+		return err
 	}
+	defer rows.Close()
 	for rows.Next() {
 		var (
 			columnName    string
@@ -111,20 +260,26 @@ func readMySQLTableColumns(db *sql.DB, cons *erdh.Construction, tableName string
 		)
 		err = rows.Scan(&columnName, &columnType, &columnkey, &extra, &columnDefault, &isNullable)
 		if err != nil {
-			panic(err)
+			return err
 		}
 		var columnDefaultValue string
 		if columnDefault.Valid {
 			columnDefaultValue = columnDefault.String
 		}
-		isNullableBool := true
+		isNotNull := false
 		if strings.ToUpper(isNullable) == "NO" {
-			isNullableBool = false
+			isNotNull = true
 		}
 		isPrimary := false
 		if strings.ToUpper(columnkey) == "PRI" {
 			isPrimary = true
 		}
+		generated := ""
+		if strings.Contains(strings.ToUpper(extra), "VIRTUAL GENERATED") {
+			generated = erdh.GeneratedVirtual
+		} else if strings.Contains(strings.ToUpper(extra), "STORED GENERATED") {
+			generated = erdh.GeneratedStored
+		}
 		table.Columns = append(
 			table.Columns,
 			erdh.Column{
@@ -133,31 +288,35 @@ func readMySQLTableColumns(db *sql.DB, cons *erdh.Construction, tableName string
 				Key:        columnkey,
 				Extra:      extra,
 				Default:    columnDefaultValue,
-				NotNull:    isNullableBool,
-				IsPrimary:  isPrimary})
+				NotNull:    isNotNull,
+				IsPrimary:  isPrimary,
+				Generated:  generated})
 	}
+	return rows.Err()
 }
 
-func readMySQLTableIndexes(db *sql.DB, cons *erdh.Construction, tableName string) {
-	table := cons.GetTableMut(tableName)
+func readMySQLTableIndexes(ctx context.Context, db *sql.DB, cons *erdh.Construction, tbl erdh.Table) error {
+	table := cons.GetTableMut(tbl.Name)
 
 	query := `
 	SELECT index_name
          , column_name
       FROM information_schema.statistics
      WHERE table_schema = ?
-       AND table_name = ?`
+       AND table_name = ?
+     ORDER BY index_name, seq_in_index`
 
-	stmt, err := db.Prepare(query)
+	stmt, err := db.PrepareContext(ctx, query)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer stmt.Close()
 
-	rows, err := stmt.Query(cons.DBName, tableName)
+	rows, err := stmt.QueryContext(ctx, tbl.Schema, tbl.LocalName())
 	if err != nil {
-		panic(err)
+		return err
 	}
+	defer rows.Close()
 	for rows.Next() {
 		var (
 			indexName  string
@@ -165,48 +324,56 @@ func readMySQLTableIndexes(db *sql.DB, cons *erdh.Construction, tableName string
 		)
 		err = rows.Scan(&indexName, &columnName)
 		if err != nil {
-			panic(err)
+			return err
 		}
 		table.Indexes = append(table.Indexes, erdh.Index{Name: indexName, ColumnName: columnName})
 	}
+	return rows.Err()
 }
 
-func readMySQLTableForeginKeys(db *sql.DB, cons *erdh.Construction, tableName string) {
-	table := cons.GetTableMut(tableName)
+func readMySQLTableForeginKeys(ctx context.Context, db *sql.DB, cons *erdh.Construction, tbl erdh.Table, qualify bool) error {
+	table := cons.GetTableMut(tbl.Name)
 
 	query := `
 	SELECT constraint_name
          , column_name
+         , referenced_table_schema
          , referenced_table_name
          , referenced_column_name
       FROM information_schema.key_column_usage
-     WHERE constraint_schema = ?
+     WHERE table_schema = ?
        AND table_name = ?
        AND constraint_name <> 'PRIMARY'
-     ORDER BY CONSTRAINT_NAME`
+     ORDER BY constraint_name, ordinal_position`
 
-	stmt, err := db.Prepare(query)
+	stmt, err := db.PrepareContext(ctx, query)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer stmt.Close()
 
-	rows, err := stmt.Query(cons.DBName, tableName)
+	rows, err := stmt.QueryContext(ctx, tbl.Schema, tbl.LocalName())
 	if err != nil {
-		panic(err)
+		return err
 	}
+	defer rows.Close()
 	for rows.Next() {
 		var (
-			constraintName       string
-			columnName           string
-			referencedTableName  string
-			referencedColumnName string
+			constraintName        string
+			columnName            string
+			referencedTableSchema string
+			referencedTableName   string
+			referencedColumnName  string
 		)
+		referencedTableSchemaTemp := new(sql.NullString)
 		referencedTableNameTemp := new(sql.NullString)
 		referencedColumnNameTemp := new(sql.NullString)
-		err = rows.Scan(&constraintName, &columnName, &referencedTableNameTemp, &referencedColumnNameTemp)
+		err = rows.Scan(&constraintName, &columnName, &referencedTableSchemaTemp, &referencedTableNameTemp, &referencedColumnNameTemp)
 		if err != nil {
-			panic(err)
+			return err
+		}
+		if referencedTableSchemaTemp != nil && referencedTableSchemaTemp.Valid {
+			referencedTableSchema = referencedTableSchemaTemp.String
 		}
 		if referencedTableNameTemp != nil && referencedTableNameTemp.Valid {
 			referencedTableName = referencedTableNameTemp.String
@@ -214,13 +381,19 @@ func readMySQLTableForeginKeys(db *sql.DB, cons *erdh.Construction, tableName st
 		if referencedColumnNameTemp != nil && referencedColumnNameTemp.Valid {
 			referencedColumnName = referencedColumnNameTemp.String
 		}
+		// 複数スキーマを読む場合や他スキーマへの参照の場合は、参照先をスキーマで修飾する
+		if len(referencedTableName) > 0 && (qualify || referencedTableSchema != tbl.Schema) {
+			referencedTableName = erdh.QualifiedTableName(referencedTableSchema, referencedTableName)
+		}
 		table.ForeginKeys = append(
 			table.ForeginKeys,
 			erdh.ForeginKey{
-				ConstraintName:       constraintName,
-				ColumnName:           columnName,
-				ReferencedTableName:  referencedTableName,
-				ReferencedColumnName: referencedColumnName,
+				ConstraintName:        constraintName,
+				ColumnName:            columnName,
+				ReferencedTableSchema: referencedTableSchema,
+				ReferencedTableName:   referencedTableName,
+				ReferencedColumnName:  referencedColumnName,
 			})
 	}
+	return rows.Err()
 }
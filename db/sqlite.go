@@ -1,10 +1,13 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"path/filepath"
 	"regexp"
+	"strings"
 
 	"github.com/iwot/Sqlite3CreateTableParser/parser"
 	"github.com/iwot/erdh-go/config"
@@ -12,45 +15,395 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// SQLiteの読み方（DBConfig.SQLiteReader）
+const (
+	// SQLiteReaderPragma はPRAGMAでテーブル構造を読む。PRAGMAで読めないテーブルはCREATE文を解析する
+	SQLiteReaderPragma = "pragma"
+	// SQLiteReaderParser はCREATE文を解析してテーブル構造を読む
+	SQLiteReaderParser = "parser"
+)
+
 // ReadSQLite は対象DBを読み、Constructionを返す
 func ReadSQLite(dbconf config.DBConfig) (*erdh.Construction, error) {
-	var cons erdh.Construction
+	return ReadSQLiteContext(context.Background(), dbconf)
+}
+
+// ReadSQLiteContext は ctx を用いて対象DBを読み、Constructionを返す
+// attach で指定したデータベースのテーブルは、名前をデータベース名で修飾し、データベース名をグループとする
+func ReadSQLiteContext(ctx context.Context, dbconf config.DBConfig) (*erdh.Construction, error) {
+	db, closeDB, err := openSQLite(ctx, dbconf)
+	if err != nil {
+		return &erdh.Construction{}, err
+	}
+	defer closeDB()
+
+	return readSQLiteWith(ctx, db, dbconf)
+}
+
+// openSQLite はDBを開き、attach で指定したデータベースをアタッチする
+// 返す関数でDBを閉じる
+func openSQLite(ctx context.Context, dbconf config.DBConfig) (*sql.DB, func(), error) {
+	switch dbconf.SQLiteReader {
+	case "", SQLiteReaderPragma, SQLiteReaderParser:
+	default:
+		return nil, nil, fmt.Errorf("invalid sqlite_reader %s", dbconf.SQLiteReader)
+	}
 
 	db, err := sql.Open("sqlite3", dbconf.DBName)
 	if err != nil {
-		return &cons, err
+		return nil, nil, err
 	}
-	defer db.Close()
+	// ATTACH は接続ごとに有効なため、接続をひとつに限る
+	db.SetMaxOpenConns(1)
 
+	for _, name := range dbconf.AttachNames() {
+		_, err := db.ExecContext(ctx, `ATTACH DATABASE ? AS `+quoteSQLiteIdent(name), dbconf.Attach[name])
+		if err != nil {
+			db.Close()
+			return nil, nil, fmt.Errorf("attach %s: %w", name, err)
+		}
+	}
+	return db, func() { db.Close() }, nil
+}
+
+// readSQLiteWith は openSQLite で開いたDBを読み、Constructionを返す
+func readSQLiteWith(ctx context.Context, db *sql.DB, dbconf config.DBConfig) (*erdh.Construction, error) {
+	var cons erdh.Construction
 	cons.DBName = filepath.Base(dbconf.DBName)
 
-	creates, err := retrieveCreateQueries(db)
+	schemas := append([]string{"main"}, dbconf.AttachNames()...)
+	for _, schema := range schemas {
+		creates, err := retrieveCreateQueries(ctx, db, schema)
+		if err != nil {
+			return &cons, err
+		}
+		if !dbconf.IncludeInternalTables {
+			creates = filterSQLiteInternalTables(creates)
+		}
+
+		group := cons.DBName
+		if schema != "main" {
+			group = schema
+		}
+		for _, create := range creates {
+			table, err := readSQLiteTableWith(ctx, db, dbconf.SQLiteReader, group, create)
+			if err != nil {
+				return &cons, err
+			}
+			if dbconf.CollectStats && len(table.Module) == 0 {
+				table.Stats, err = readSQLiteStats(ctx, db, schema, create.tableName)
+				if err != nil {
+					return &cons, err
+				}
+			}
+			if schema != "main" {
+				qualifySQLiteTable(&table, schema)
+			}
+			cons.Tables = append(cons.Tables, table)
+		}
+	}
+
+	return &cons, nil
+}
+
+// readSQLiteTableWith は reader の方法でテーブルを読む
+func readSQLiteTableWith(ctx context.Context, db *sql.DB, reader, group string, create createQuery) (erdh.Table, error) {
+	module, args := sqliteVirtualTable(create.query)
+
+	var table erdh.Table
+	var err error
+	switch {
+	case len(module) > 0:
+		table, err = readSQLiteTable(ctx, db, group, create)
+		if err != nil {
+			// モジュールが組み込まれていない仮想テーブルはPRAGMAで読めないため、USING の引数をカラムとする
+			table = erdh.Table{Name: create.tableName, Group: group}
+			for _, c := range sqliteVirtualTableColumns(args) {
+				table.AddColumn(c, "", "", "", "", false, false)
+			}
+			err = nil
+		}
+		table.Module = module
+	case reader == SQLiteReaderParser:
+		table, err = parseCreateQuery(create.query, group, create.tableName)
+	default:
+		table, err = readSQLiteTable(ctx, db, group, create)
+		if err != nil {
+			// PRAGMAで読めない場合はCREATE文を解析する
+			var parseErr error
+			table, parseErr = parseCreateQuery(create.query, group, create.tableName)
+			if parseErr != nil {
+				err = fmt.Errorf("table %s: %v (parser: %v)", create.tableName, err, parseErr)
+			} else {
+				err = nil
+			}
+		}
+	}
+	if err != nil {
+		return table, err
+	}
+	table.WithoutRowID, table.Strict = sqliteTableOptions(create.query)
+	return table, nil
+}
+
+// readSQLiteStats はテーブルの行数を数える
+// dbstat 仮想テーブルが使える場合はテーブルとインデックスのサイズも読む
+func readSQLiteStats(ctx context.Context, db *sql.DB, schema, tableName string) (*erdh.TableStats, error) {
+	stats := &erdh.TableStats{}
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+quoteSQLiteIdent(schema)+`.`+quoteSQLiteIdent(tableName)).Scan(&stats.Rows)
+	if err != nil {
+		return nil, fmt.Errorf("count %s: %w", tableName, err)
+	}
+
+	var dataLength, indexLength sql.NullInt64
+	err = db.QueryRowContext(ctx, `
+	SELECT (SELECT SUM(pgsize) FROM dbstat(?) WHERE name = ?),
+	       (SELECT SUM(pgsize) FROM dbstat(?) WHERE name IN (SELECT name FROM pragma_index_list(?, ?)))`,
+		schema, tableName, schema, tableName, schema).Scan(&dataLength, &indexLength)
+	if err == nil {
+		stats.DataLength = dataLength.Int64
+		stats.IndexLength = indexLength.Int64
+	}
+	return stats, nil
+}
+
+// qualifySQLiteTable はアタッチしたデータベースのテーブル名と参照先のテーブル名を schema で修飾する
+// SQLiteの外部キーは同じデータベース内のテーブルのみを参照する
+func qualifySQLiteTable(table *erdh.Table, schema string) {
+	table.Schema = schema
+	table.Name = erdh.QualifiedTableName(schema, table.Name)
+	for i := range table.ForeginKeys {
+		table.ForeginKeys[i].ReferencedTableSchema = schema
+		table.ForeginKeys[i].ReferencedTableName = erdh.QualifiedTableName(schema, table.ForeginKeys[i].ReferencedTableName)
+	}
+}
+
+// readSQLiteTable はPRAGMAでテーブルのカラム、インデックス、外部キーを読む
+func readSQLiteTable(ctx context.Context, db *sql.DB, group string, create createQuery) (erdh.Table, error) {
+	table := erdh.Table{Name: create.tableName, Group: group}
+
+	err := readSQLiteColumns(ctx, db, create.schema, &table)
 	if err != nil {
-		return &cons, err
+		return table, err
 	}
+	err = readSQLiteIndexes(ctx, db, create.schema, &table)
+	if err != nil {
+		return table, err
+	}
+	err = readSQLiteForeignKeys(ctx, db, create.schema, &table)
+	if err != nil {
+		return table, err
+	}
+	return table, nil
+}
 
-	var tables []erdh.Table
-	for tablName, query := range creates {
-		table, err := parseCreateQuery(query, cons.DBName, tablName)
+func readSQLiteColumns(ctx context.Context, db *sql.DB, schema string, table *erdh.Table) error {
+	rows, err := db.QueryContext(ctx, `SELECT name, type, "notnull", dflt_value, pk, hidden FROM pragma_table_xinfo(?, ?) ORDER BY cid`, table.Name, schema)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			name      string
+			colType   string
+			notNull   bool
+			dfltValue sql.NullString
+			pk        int
+			hidden    int
+		)
+		err = rows.Scan(&name, &colType, &notNull, &dfltValue, &pk, &hidden)
 		if err != nil {
-			return &cons, err
+			return err
+		}
+		column := erdh.Column{
+			Name:       name,
+			ColumnType: colType,
+			Default:    dfltValue.String,
+			NotNull:    notNull || pk > 0,
+			IsPrimary:  pk > 0,
+		}
+		if pk > 0 {
+			column.Key = "PRI"
 		}
-		tables = append(tables, table)
+		// hidden は 1 が仮想テーブルの隠しカラム、2 が VIRTUAL、3 が STORED の生成列
+		switch hidden {
+		case 1:
+			continue
+		case 2:
+			column.Generated = erdh.GeneratedVirtual
+			column.Extra = "VIRTUAL GENERATED"
+		case 3:
+			column.Generated = erdh.GeneratedStored
+			column.Extra = "STORED GENERATED"
+		}
+		table.Columns = append(table.Columns, column)
 	}
+	return rows.Err()
+}
 
-	cons.Tables = tables
+// readSQLiteIndexes はインデックスを読む
+// 主キー以外のカラムひとつのユニークインデックスがあれば、そのカラムの key を UNI とする
+func readSQLiteIndexes(ctx context.Context, db *sql.DB, schema string, table *erdh.Table) error {
+	rows, err := db.QueryContext(ctx, `SELECT name, "unique", origin FROM pragma_index_list(?, ?) ORDER BY name`, table.Name, schema)
+	if err != nil {
+		return err
+	}
+	type indexInfo struct {
+		name   string
+		unique bool
+		origin string
+	}
+	indexes := []indexInfo{}
+	for rows.Next() {
+		var index indexInfo
+		if err := rows.Scan(&index.name, &index.unique, &index.origin); err != nil {
+			rows.Close()
+			return err
+		}
+		indexes = append(indexes, index)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
 
-	return &cons, nil
+	for _, index := range indexes {
+		rows, err := db.QueryContext(ctx, `SELECT name FROM pragma_index_info(?, ?) ORDER BY seqno`, index.name, schema)
+		if err != nil {
+			return err
+		}
+		columns := []sql.NullString{}
+		for rows.Next() {
+			var column sql.NullString
+			if err := rows.Scan(&column); err != nil {
+				rows.Close()
+				return err
+			}
+			columns = append(columns, column)
+			// 式インデックスの式の部分はカラム名がない
+			if column.Valid {
+				table.AddIndex(index.name, column.String)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if index.unique && index.origin != "pk" && len(columns) == 1 && columns[0].Valid {
+			if col := table.GetColumn(columns[0].String); col != nil && len(col.Key) == 0 {
+				col.Key = "UNI"
+			}
+		}
+	}
+	return nil
 }
 
-func retrieveCreateQueries(db *sql.DB) (map[string]string, error) {
-	result := map[string]string{}
+func readSQLiteForeignKeys(ctx context.Context, db *sql.DB, schema string, table *erdh.Table) error {
+	rows, err := db.QueryContext(ctx, `SELECT id, "table", "from", "to" FROM pragma_foreign_key_list(?, ?) ORDER BY id, seq`, table.Name, schema)
+	if err != nil {
+		return err
+	}
+	type foreignKey struct {
+		id    int
+		table string
+		from  string
+		to    sql.NullString
+	}
+	fks := []foreignKey{}
+	for rows.Next() {
+		var fk foreignKey
+		if err := rows.Scan(&fk.id, &fk.table, &fk.from, &fk.to); err != nil {
+			rows.Close()
+			return err
+		}
+		fks = append(fks, fk)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// pragma_foreign_key_list の id は宣言の逆順に振られるため、宣言順に直して制約名とする
+	maxID := -1
+	for _, fk := range fks {
+		if fk.id > maxID {
+			maxID = fk.id
+		}
+	}
+
+	// 参照先カラムを省略した外部キーは参照先テーブルの主キーを参照する
+	seq := map[int]int{}
+	for _, fk := range fks {
+		to := fk.to.String
+		if !fk.to.Valid {
+			pk, err := readSQLitePrimaryKey(ctx, db, schema, fk.table)
+			if err != nil {
+				return err
+			}
+			if seq[fk.id] < len(pk) {
+				to = pk[seq[fk.id]]
+			}
+		}
+		seq[fk.id]++
+		table.AddForeginKey(sqliteForeignKeyName(maxID-fk.id), fk.from, fk.table, to)
+	}
+	return nil
+}
 
-	sql := `SELECT tbl_name, sql FROM sqlite_master WHERE type = "table"`
-	rows, err := db.Query(sql)
+// readSQLitePrimaryKey はテーブルの主キーのカラム名を主キー内の順に返す
+func readSQLitePrimaryKey(ctx context.Context, db *sql.DB, schema, tableName string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT name FROM pragma_table_info(?, ?) WHERE pk > 0 ORDER BY pk`, tableName, schema)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+	result := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		result = append(result, name)
+	}
+	return result, rows.Err()
+}
+
+var sqliteTableOptionReg = regexp.MustCompile(`(?i)^\s*(WITHOUT\s+ROWID|STRICT)\s*(,\s*(WITHOUT\s+ROWID|STRICT)\s*)*;?\s*$`)
+
+// sqliteTableOptions はCREATE文の末尾のテーブルオプションから WITHOUT ROWID と STRICT の指定を返す
+func sqliteTableOptions(query string) (withoutRowID, strict bool) {
+	query = removeQueryComment(query)
+	end := strings.LastIndex(query, ")")
+	if end < 0 {
+		return false, false
+	}
+	options := query[end+1:]
+	if !sqliteTableOptionReg.MatchString(options) {
+		return false, false
+	}
+	upper := strings.ToUpper(options)
+	return strings.Contains(upper, "ROWID"), strings.Contains(upper, "STRICT")
+}
+
+// createQuery はテーブル名とそのCREATE文の組
+type createQuery struct {
+	schema    string
+	tableName string
+	query     string
+}
+
+func retrieveCreateQueries(ctx context.Context, db *sql.DB, schema string) ([]createQuery, error) {
+	result := []createQuery{}
+
+	sql := `SELECT tbl_name, sql FROM ` + quoteSQLiteIdent(schema) + `.sqlite_master WHERE type = 'table' ORDER BY tbl_name`
+	rows, err := db.QueryContext(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var tblName string
@@ -59,7 +412,7 @@ func retrieveCreateQueries(db *sql.DB) (map[string]string, error) {
 		if err != nil {
 			return nil, err
 		}
-		result[tblName] = query
+		result = append(result, createQuery{schema, tblName, query})
 	}
 	err = rows.Err()
 	if err != nil {
@@ -69,6 +422,83 @@ func retrieveCreateQueries(db *sql.DB) (map[string]string, error) {
 	return result, nil
 }
 
+// sqliteShadowTableSuffixes は仮想テーブルのモジュールが作成するシャドウテーブルの接尾辞
+var sqliteShadowTableSuffixes = map[string][]string{
+	"fts3":      {"content", "segments", "segdir", "docsize", "stat"},
+	"fts4":      {"content", "segments", "segdir", "docsize", "stat"},
+	"fts5":      {"data", "idx", "content", "docsize", "config"},
+	"rtree":     {"node", "parent", "rowid"},
+	"rtree_i32": {"node", "parent", "rowid"},
+	"geopoly":   {"node", "parent", "rowid"},
+}
+
+// filterSQLiteInternalTables はSQLiteの内部テーブル（sqlite_sequence, sqlite_stat1 など）と仮想テーブルのシャドウテーブルを除く
+func filterSQLiteInternalTables(creates []createQuery) []createQuery {
+	shadows := map[string]bool{}
+	for _, create := range creates {
+		module, _ := sqliteVirtualTable(create.query)
+		for _, suffix := range sqliteShadowTableSuffixes[strings.ToLower(module)] {
+			shadows[strings.ToLower(create.tableName+"_"+suffix)] = true
+		}
+	}
+
+	result := []createQuery{}
+	for _, create := range creates {
+		if strings.HasPrefix(strings.ToLower(create.tableName), "sqlite_") || shadows[strings.ToLower(create.tableName)] {
+			continue
+		}
+		result = append(result, create)
+	}
+	return result
+}
+
+var sqliteVirtualTableReg = regexp.MustCompile(`(?is)^\s*CREATE\s+VIRTUAL\s+TABLE\s+.*?\s+USING\s+(\w+)\s*(\((.*)\))?\s*;?\s*$`)
+
+// sqliteVirtualTable は仮想テーブルのCREATE文であればモジュール名と USING の引数を返す
+func sqliteVirtualTable(query string) (module, args string) {
+	m := sqliteVirtualTableReg.FindStringSubmatch(query)
+	if m == nil {
+		return "", ""
+	}
+	return strings.ToLower(m[1]), m[3]
+}
+
+// sqliteVirtualTableColumns は仮想テーブルの USING の引数からカラム名を返す
+// tokenize=porter のようなオプションは除く
+func sqliteVirtualTableColumns(args string) []string {
+	result := []string{}
+	depth := 0
+	start := 0
+	split := func(end int) {
+		arg := strings.TrimSpace(args[start:end])
+		start = end + 1
+		if len(arg) == 0 || strings.Contains(arg, "=") {
+			return
+		}
+		name := strings.Fields(arg)[0]
+		result = append(result, strings.Trim(name, "\"`[]'"))
+	}
+	for i, r := range args {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				split(i)
+			}
+		}
+	}
+	split(len(args))
+	return result
+}
+
+// quoteSQLiteIdent はSQLiteの識別子として name を引用符で囲む
+func quoteSQLiteIdent(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
 var commentReg = regexp.MustCompile(`--\s*.*(\r\n|\n)?`)
 
 func removeQueryComment(query string) string {
@@ -100,17 +530,25 @@ func parseCreateQuery(query, dbName, tableName string) (erdh.Table, error) {
 			c.IsNotnull,
 			c.IsPrimaryKey)
 	}
+	fkIndex := 0
 	for _, c := range table.Constraints {
 		if c.ForeignKeyNum > 0 {
 			for i := 0; i < c.ForeignKeyNum; i++ {
 				result.AddForeginKey(
-					"",
+					sqliteForeignKeyName(fkIndex),
 					c.ForeignKeyName[i],
 					c.ForeignKeyClause.Table,
 					c.ForeignKeyClause.ColumnName[i])
 			}
+			fkIndex++
 		}
 	}
 
 	return result, nil
 }
+
+// sqliteForeignKeyName は宣言順で index 番目の外部キーの制約名を返す
+// SQLiteは制約名を読み出せないため、同じ参照先への複数の外部キーを区別するための名前とする
+func sqliteForeignKeyName(index int) string {
+	return fmt.Sprintf("fk_%d", index)
+}
@@ -0,0 +1,319 @@
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iwot/erdh-go/config"
+	"github.com/iwot/erdh-go/erdh"
+)
+
+// createTestSQLite は statements を実行した一時的なSQLiteファイルを作成し、そのパスを返す
+func createTestSQLite(t *testing.T, statements ...string) string {
+	dir, err := ioutil.TempDir("", "erdh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "test.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, s := range statements {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("failed to exec %s: %v", s, err)
+		}
+	}
+	return path
+}
+
+func TestReadSQLitePragma(t *testing.T) {
+	path := createTestSQLite(t,
+		`CREATE TABLE items (
+			id INTEGER PRIMARY KEY,
+			code TEXT NOT NULL UNIQUE,
+			price INTEGER DEFAULT 0,
+			price_with_tax INTEGER GENERATED ALWAYS AS (price * 110 / 100) VIRTUAL,
+			label TEXT AS (code || ':' || id) STORED
+		)`,
+		`CREATE TABLE members (id INTEGER PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE member_items (
+			member_id INTEGER NOT NULL REFERENCES members,
+			item_id INTEGER NOT NULL,
+			-- コメント
+			quantity INTEGER,
+			PRIMARY KEY (member_id, item_id),
+			FOREIGN KEY (item_id) REFERENCES items (id)
+		) WITHOUT ROWID`,
+		`CREATE INDEX idx_member_items_item ON member_items (item_id, quantity)`,
+		`CREATE INDEX idx_items_lower ON items (lower(code), price)`,
+	)
+
+	cons, err := ReadSQLite(config.DBConfig{DBName: path})
+	if err != nil {
+		t.Fatalf("failed test ReadSQLite %#v", err)
+	}
+	if cons.DBName != "test.db" || len(cons.Tables) != 3 {
+		t.Fatalf("failed test ReadSQLite tables %#v", cons)
+	}
+
+	items := cons.GetTableMut("items")
+	if len(items.Columns) != 5 || items.Group != "test.db" || items.WithoutRowID {
+		t.Fatalf("failed test items %#v", items)
+	}
+	if c := items.Columns[0]; !c.IsPrimary || c.Key != "PRI" || !c.NotNull || c.ColumnType != "INTEGER" {
+		t.Fatalf("failed test items.id %#v", c)
+	}
+	if c := items.Columns[1]; !c.NotNull || c.IsPrimary {
+		t.Fatalf("failed test items.code %#v", c)
+	}
+	if c := items.Columns[2]; c.Default != "0" || c.NotNull {
+		t.Fatalf("failed test items.price %#v", c)
+	}
+	if c := items.Columns[3]; c.Generated != erdh.GeneratedVirtual {
+		t.Fatalf("failed test items.price_with_tax %#v", c)
+	}
+	if c := items.Columns[4]; c.Generated != erdh.GeneratedStored {
+		t.Fatalf("failed test items.label %#v", c)
+	}
+	expectedIndexes := []erdh.Index{
+		{Name: "idx_items_lower", ColumnName: "price"},
+		{Name: "sqlite_autoindex_items_1", ColumnName: "code"},
+	}
+	if len(items.Indexes) != len(expectedIndexes) || items.Indexes[0] != expectedIndexes[0] || items.Indexes[1] != expectedIndexes[1] {
+		t.Fatalf("failed test items indexes %#v", items.Indexes)
+	}
+
+	memberItems := cons.GetTableMut("member_items")
+	if !memberItems.WithoutRowID || memberItems.Strict {
+		t.Fatalf("failed test member_items options %#v", memberItems)
+	}
+	if pk := memberItems.PrimaryKeyColumns(); len(pk) != 2 {
+		t.Fatalf("failed test member_items primary key %#v", pk)
+	}
+	// 制約名は宣言順の番号とする
+	expectedFKs := []erdh.ForeginKey{
+		{ConstraintName: "fk_1", ColumnName: "item_id", ReferencedTableName: "items", ReferencedColumnName: "id"},
+		{ConstraintName: "fk_0", ColumnName: "member_id", ReferencedTableName: "members", ReferencedColumnName: "id"},
+	}
+	if len(memberItems.ForeginKeys) != 2 || memberItems.ForeginKeys[0] != expectedFKs[0] || memberItems.ForeginKeys[1] != expectedFKs[1] {
+		t.Fatalf("failed test member_items foreign keys %#v", memberItems.ForeginKeys)
+	}
+	indexed := map[string]bool{}
+	for _, idx := range memberItems.Indexes {
+		indexed[idx.Name+"."+idx.ColumnName] = true
+	}
+	if !indexed["idx_member_items_item.item_id"] || !indexed["idx_member_items_item.quantity"] {
+		t.Fatalf("failed test member_items indexes %#v", memberItems.Indexes)
+	}
+}
+
+func TestReadSQLiteParser(t *testing.T) {
+	path := createTestSQLite(t,
+		`CREATE TABLE members (id INTEGER PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE member_items (id INTEGER PRIMARY KEY, member_id INTEGER, FOREIGN KEY (member_id) REFERENCES members (id))`,
+	)
+
+	cons, err := ReadSQLite(config.DBConfig{DBName: path, SQLiteReader: SQLiteReaderParser})
+	if err != nil {
+		t.Fatalf("failed test ReadSQLite %#v", err)
+	}
+	memberItems := cons.GetTableMut("member_items")
+	if len(memberItems.Columns) != 2 || len(memberItems.ForeginKeys) != 1 || memberItems.ForeginKeys[0].ReferencedTableName != "members" {
+		t.Fatalf("failed test member_items %#v", memberItems)
+	}
+
+	if _, err := ReadSQLite(config.DBConfig{DBName: path, SQLiteReader: "unknown"}); err == nil {
+		t.Fatalf("failed test invalid sqlite_reader")
+	}
+}
+
+func TestReadSQLiteForeignKeysToSameTable(t *testing.T) {
+	path := createTestSQLite(t,
+		`CREATE TABLE members (id INTEGER PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE reviews (
+			id INTEGER PRIMARY KEY,
+			member_id INTEGER NOT NULL,
+			reviewer_id INTEGER,
+			FOREIGN KEY (member_id) REFERENCES members (id),
+			FOREIGN KEY (reviewer_id) REFERENCES members (id)
+		)`,
+	)
+
+	for _, reader := range []string{SQLiteReaderPragma, SQLiteReaderParser} {
+		cons, err := ReadSQLite(config.DBConfig{DBName: path, SQLiteReader: reader})
+		if err != nil {
+			t.Fatalf("failed test ReadSQLite %s %#v", reader, err)
+		}
+		fks := cons.GetTableMut("reviews").ForeginKeys
+		names := map[string]string{}
+		for _, fk := range fks {
+			names[fk.ColumnName] = fk.ConstraintName
+		}
+		if len(fks) != 2 || names["member_id"] != "fk_0" || names["reviewer_id"] != "fk_1" {
+			t.Fatalf("failed test %s foreign key names %#v", reader, fks)
+		}
+
+		// 外部キーごとに線を引く
+		cons.UpdateExRelationsFromForeignKeys()
+		var b bytes.Buffer
+		if err := erdh.WritePumlByGroup(&b, cons, erdh.PumlOptions{Theme: config.Theme{EdgeStyle: "column"}}); err != nil {
+			t.Fatal(err)
+		}
+		edges := 0
+		for _, line := range strings.Split(b.String(), "\n") {
+			if strings.HasPrefix(line, "reviews::") {
+				edges++
+			}
+		}
+		if edges != 2 || !strings.Contains(b.String(), "reviews::member_id  ") || !strings.Contains(b.String(), "reviews::reviewer_id  ") {
+			t.Fatalf("failed test %s column edges\n%s", reader, b.String())
+		}
+	}
+}
+
+func TestSQLiteTableOptions(t *testing.T) {
+	tests := []struct {
+		query        string
+		withoutRowID bool
+		strict       bool
+	}{
+		{"CREATE TABLE t (id INTEGER PRIMARY KEY)", false, false},
+		{"CREATE TABLE t (id INTEGER PRIMARY KEY) WITHOUT ROWID", true, false},
+		{"CREATE TABLE t (id INTEGER PRIMARY KEY) strict", false, true},
+		{"CREATE TABLE t (id INTEGER PRIMARY KEY) STRICT, WITHOUT  ROWID;", true, true},
+		{"CREATE TABLE t (id INTEGER PRIMARY KEY, note TEXT DEFAULT 'WITHOUT ROWID')", false, false},
+		{"CREATE TABLE t (id INTEGER PRIMARY KEY) -- STRICT\n", false, false},
+		{"CREATE VIRTUAL TABLE t USING fts5(body)", false, false},
+	}
+	for _, test := range tests {
+		withoutRowID, strict := sqliteTableOptions(test.query)
+		if withoutRowID != test.withoutRowID || strict != test.strict {
+			t.Fatalf("failed test sqliteTableOptions %#v %#v %#v", test.query, withoutRowID, strict)
+		}
+	}
+}
+
+func TestReadSQLiteInternalAndVirtualTables(t *testing.T) {
+	path := createTestSQLite(t,
+		`CREATE TABLE items (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT)`,
+		`INSERT INTO items (name) VALUES ('a')`,
+		`CREATE INDEX idx_items_name ON items (name)`,
+		`ANALYZE`,
+		`CREATE VIRTUAL TABLE item_search USING fts4(name, note)`,
+		`CREATE VIRTUAL TABLE item_area USING rtree(id, min_x, max_x)`,
+		// モジュールが組み込まれていない仮想テーブル
+		`PRAGMA writable_schema = ON`,
+		`INSERT INTO sqlite_master (type, name, tbl_name, rootpage, sql) VALUES ('table', 'docs', 'docs', 0, 'CREATE VIRTUAL TABLE docs USING fts5(title, "body", tokenize = ''porter ascii'')')`,
+		`PRAGMA writable_schema = OFF`,
+	)
+
+	cons, err := ReadSQLite(config.DBConfig{DBName: path})
+	if err != nil {
+		t.Fatalf("failed test ReadSQLite %#v", err)
+	}
+	names := []string{}
+	for _, tbl := range cons.Tables {
+		names = append(names, tbl.Name+":"+tbl.Module)
+	}
+	expected := []string{"docs:fts5", "item_area:rtree", "item_search:fts4", "items:"}
+	if len(names) != len(expected) {
+		t.Fatalf("failed test internal tables are filtered %#v", names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Fatalf("failed test internal tables are filtered %#v", names)
+		}
+	}
+
+	columnNames := func(tbl *erdh.Table) []string {
+		result := []string{}
+		for _, c := range tbl.Columns {
+			result = append(result, c.Name)
+		}
+		return result
+	}
+	if cols := columnNames(cons.GetTableMut("docs")); len(cols) != 2 || cols[0] != "title" || cols[1] != "body" {
+		t.Fatalf("failed test columns of virtual table without module %#v", cols)
+	}
+	if cols := columnNames(cons.GetTableMut("item_search")); len(cols) != 2 || cols[1] != "note" {
+		t.Fatalf("failed test columns of fts4 table %#v", cols)
+	}
+	if cols := columnNames(cons.GetTableMut("item_area")); len(cols) != 3 {
+		t.Fatalf("failed test columns of rtree table %#v", cols)
+	}
+
+	cons, err = ReadSQLite(config.DBConfig{DBName: path, IncludeInternalTables: true})
+	if err != nil {
+		t.Fatalf("failed test ReadSQLite %#v", err)
+	}
+	found := map[string]bool{}
+	for _, tbl := range cons.Tables {
+		found[tbl.Name] = true
+	}
+	for _, name := range []string{"sqlite_sequence", "sqlite_stat1", "item_search_content", "item_area_node"} {
+		if !found[name] {
+			t.Fatalf("failed test include_internal_tables %s not in %#v", name, found)
+		}
+	}
+}
+
+func TestReadSQLiteAttach(t *testing.T) {
+	mainPath := createTestSQLite(t,
+		`CREATE TABLE members (id INTEGER PRIMARY KEY, name TEXT)`,
+	)
+	archivePath := createTestSQLite(t,
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY, member_id INTEGER)`,
+		`CREATE TABLE order_items (id INTEGER PRIMARY KEY, order_id INTEGER REFERENCES orders (id))`,
+	)
+
+	cons, err := ReadSQLite(config.DBConfig{DBName: mainPath, Attach: map[string]string{"archive": archivePath}})
+	if err != nil {
+		t.Fatalf("failed test ReadSQLite %#v", err)
+	}
+	if len(cons.Tables) != 3 {
+		t.Fatalf("failed test attached tables %#v", cons.Tables)
+	}
+	if members := cons.Tables[0]; members.Name != "members" || members.Group != "test.db" || members.Schema != "" {
+		t.Fatalf("failed test main table %#v", members)
+	}
+	orderItems := cons.Tables[1]
+	if orderItems.Name != "archive.order_items" || orderItems.Group != "archive" || orderItems.Schema != "archive" || orderItems.LocalName() != "order_items" {
+		t.Fatalf("failed test attached table %#v", orderItems)
+	}
+	if fk := orderItems.ForeginKeys; len(fk) != 1 || fk[0].ReferencedTableName != "archive.orders" || fk[0].ReferencedTableSchema != "archive" {
+		t.Fatalf("failed test attached foreign key %#v", fk)
+	}
+}
+
+func TestReadSQLiteStats(t *testing.T) {
+	path := createTestSQLite(t,
+		`CREATE TABLE members (id INTEGER PRIMARY KEY)`,
+		`CREATE VIEW member_ids AS SELECT id FROM members`,
+		`INSERT INTO members (id) VALUES (1), (2), (3)`,
+	)
+
+	cons, err := ReadSQLite(config.DBConfig{DBName: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cons.GetTableMut("members").Stats != nil {
+		t.Fatalf("failed test stats are not collected by default")
+	}
+
+	cons, err = ReadSQLite(config.DBConfig{DBName: path, CollectStats: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := cons.GetTableMut("members").Stats; stats == nil || stats.Rows != 3 {
+		t.Fatalf("failed test collect_stats %#v", stats)
+	}
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/iwot/erdh-go/config"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshTunnel は踏み台ホストを経由して接続先へ到達するためのSSH接続
+type sshTunnel struct {
+	client    *ssh.Client
+	agentConn net.Conn
+}
+
+// openSSHTunnel は踏み台ホストへ接続する
+func openSSHTunnel(conf config.SSHConfig) (*sshTunnel, error) {
+	var tunnel sshTunnel
+
+	auths := []ssh.AuthMethod{}
+	if len(conf.KeyFile) > 0 {
+		signer, err := readSSHKeyFile(conf.KeyFile, conf.KeyPassphrase)
+		if err != nil {
+			return nil, err
+		}
+		auths = append(auths, ssh.PublicKeys(signer))
+	}
+	if conf.UseAgent {
+		sock := os.Getenv("SSH_AUTH_SOCK")
+		if len(sock) == 0 {
+			return nil, errors.New("use_agent is set but SSH_AUTH_SOCK is empty")
+		}
+		conn, err := net.Dial("unix", sock)
+		if err != nil {
+			return nil, err
+		}
+		tunnel.agentConn = conn
+		auths = append(auths, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+	}
+	if len(auths) == 0 {
+		return nil, errors.New("ssh requires key_file or use_agent")
+	}
+
+	hostKeyCallback, err := sshHostKeyCallback(conf)
+	if err != nil {
+		tunnel.Close()
+		return nil, err
+	}
+
+	client, err := ssh.Dial("tcp", conf.Address(), &ssh.ClientConfig{
+		User:            conf.User,
+		Auth:            auths,
+		HostKeyCallback: hostKeyCallback,
+	})
+	if err != nil {
+		tunnel.Close()
+		return nil, err
+	}
+	tunnel.client = client
+
+	return &tunnel, nil
+}
+
+func readSSHKeyFile(path, passphrase string) (ssh.Signer, error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) > 0 {
+		return ssh.ParsePrivateKeyWithPassphrase(pem, []byte(passphrase))
+	}
+	return ssh.ParsePrivateKey(pem)
+}
+
+func sshHostKeyCallback(conf config.SSHConfig) (ssh.HostKeyCallback, error) {
+	if conf.InsecureIgnoreHostKey {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	path := conf.KnownHosts
+	if len(path) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	return knownhosts.New(path)
+}
+
+// Dial は踏み台ホストから見た address へ接続する
+func (t *sshTunnel) Dial(network, address string) (net.Conn, error) {
+	return t.client.Dial(network, address)
+}
+
+// Close はSSH接続を閉じる
+func (t *sshTunnel) Close() error {
+	var err error
+	if t.client != nil {
+		err = t.client.Close()
+	}
+	if t.agentConn != nil {
+		t.agentConn.Close()
+	}
+	return err
+}
+
+var (
+	mysqlSSHDialMu    sync.Mutex
+	mysqlSSHDialCount int
+	// mysqlSSHDialFree は使い終わって再利用できるダイアラ名
+	mysqlSSHDialFree []string
+)
+
+// errSSHTunnelClosed は閉じたトンネルのダイアラで接続しようとした場合のエラー
+var errSSHTunnelClosed = errors.New("ssh tunnel is closed")
+
+// registerMySQLSSHDial はトンネル経由のダイアラをMySQLドライバに登録し、DSNで用いる名前と登録を解除する関数を返す
+// ドライバには登録を削除する手段がないため、解除した名前は閉じたトンネルを使わないダイアラに置き換え、次のトンネルで再利用する
+func registerMySQLSSHDial(tunnel *sshTunnel, network string) (string, func()) {
+	mysqlSSHDialMu.Lock()
+	defer mysqlSSHDialMu.Unlock()
+
+	var name string
+	if n := len(mysqlSSHDialFree); n > 0 {
+		name = mysqlSSHDialFree[n-1]
+		mysqlSSHDialFree = mysqlSSHDialFree[:n-1]
+	} else {
+		mysqlSSHDialCount++
+		name = fmt.Sprintf("erdh-ssh-%d", mysqlSSHDialCount)
+	}
+	mysql.RegisterDialContext(name, func(ctx context.Context, addr string) (net.Conn, error) {
+		return tunnel.Dial(network, addr)
+	})
+
+	release := func() {
+		mysqlSSHDialMu.Lock()
+		defer mysqlSSHDialMu.Unlock()
+		mysql.RegisterDialContext(name, func(ctx context.Context, addr string) (net.Conn, error) {
+			return nil, errSSHTunnelClosed
+		})
+		mysqlSSHDialFree = append(mysqlSSHDialFree, name)
+	}
+	return name, release
+}
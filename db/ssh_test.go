@@ -0,0 +1,198 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/iwot/erdh-go/config"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// startTestSSHServer は direct-tcpip のみを扱うSSHサーバーを起動し、そのアドレスを返す
+func startTestSSHServer(t *testing.T, hostKey ssh.Signer, clientKey ssh.PublicKey) string {
+	serverConf := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) == string(clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	serverConf.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, serverConf)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for newChan := range chans {
+					if newChan.ChannelType() != "direct-tcpip" {
+						newChan.Reject(ssh.UnknownChannelType, "unsupported")
+						continue
+					}
+					var payload struct {
+						Host       string
+						Port       uint32
+						OriginHost string
+						OriginPort uint32
+					}
+					ssh.Unmarshal(newChan.ExtraData(), &payload)
+					target, err := net.Dial("tcp", net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port))))
+					if err != nil {
+						newChan.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+					ch, reqs, _ := newChan.Accept()
+					go ssh.DiscardRequests(reqs)
+					go func() {
+						io.Copy(target, ch)
+						target.Close()
+					}()
+					go func() {
+						io.Copy(ch, target)
+						ch.Close()
+					}()
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestSSHTunnel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "erdh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hostRSA, _ := rsa.GenerateKey(rand.Reader, 2048)
+	hostKey, _ := ssh.NewSignerFromKey(hostRSA)
+	clientRSA, _ := rsa.GenerateKey(rand.Reader, 2048)
+	clientKey, _ := ssh.NewSignerFromKey(clientRSA)
+
+	keyFile := filepath.Join(dir, "id_rsa")
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(clientRSA)}), 0600)
+
+	// 踏み台の先にあるDBの代わりとなるエコーサーバー
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	sshAddr := startTestSSHServer(t, hostKey, clientKey.PublicKey())
+	sshHost, sshPort, _ := net.SplitHostPort(sshAddr)
+
+	knownHosts := filepath.Join(dir, "known_hosts")
+	ioutil.WriteFile(knownHosts, []byte(knownhosts.Line([]string{sshAddr}, hostKey.PublicKey())+"\n"), 0600)
+
+	sshConf := config.SSHConfig{Host: sshHost, Port: sshPort, User: "erdh", KeyFile: keyFile, KnownHosts: knownHosts}
+	tunnel, err := openSSHTunnel(sshConf)
+	if err != nil {
+		t.Fatalf("failed test openSSHTunnel %#v", err)
+	}
+	defer tunnel.Close()
+
+	conn, err := tunnel.Dial("tcp", echo.Addr().String())
+	if err != nil {
+		t.Fatalf("failed test tunnel.Dial %#v", err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("failed test tunnel echo %#v %#v", string(buf), err)
+	}
+
+	// known_hosts にないホスト鍵は拒否する
+	ioutil.WriteFile(knownHosts, []byte(knownhosts.Line([]string{sshAddr}, clientKey.PublicKey())+"\n"), 0600)
+	if _, err := openSSHTunnel(sshConf); err == nil {
+		t.Fatalf("failed test host key verification")
+	}
+}
+
+func TestMySQLSSHAddress(t *testing.T) {
+	sshConf := &config.SSHConfig{Host: "bastion.example.com", User: "erdh"}
+	tests := []struct {
+		dbconf config.DBConfig
+		dsn    string
+	}{
+		// port を省略した場合は 3306 とする（カスタムのダイアラにはドライバが既定のポートを付けない）
+		{config.DBConfig{DBType: "mysql", Host: "db.internal", User: "user", DBName: "testdb", SSH: sshConf},
+			"user@erdh-ssh-1(db.internal:3306)/testdb"},
+		{config.DBConfig{DBType: "mysql", Host: "::1", Port: "3307", User: "user", DBName: "testdb", SSH: sshConf},
+			"user@erdh-ssh-1([::1]:3307)/testdb"},
+		// host を省略してもトンネルを経由する
+		{config.DBConfig{DBType: "mysql", User: "user", DBName: "testdb", SSH: sshConf},
+			"user@erdh-ssh-1(127.0.0.1:3306)/testdb"},
+	}
+	for _, test := range tests {
+		dsn, err := test.dbconf.ToDSNVia("erdh-ssh-1")
+		if err != nil {
+			t.Fatalf("failed test ToDSNVia %#v", err)
+		}
+		if dsn != test.dsn {
+			t.Fatalf("failed test ToDSNVia %#v", dsn)
+		}
+	}
+
+	// ssh を指定しなければ host を省略した場合はドライバの既定の接続先とする
+	dsn, err := config.DBConfig{DBType: "mysql", User: "user", DBName: "testdb"}.ToDSN()
+	if err != nil || dsn != "user@/testdb" {
+		t.Fatalf("failed test ToDSN without host %#v %#v", dsn, err)
+	}
+}
+
+func TestRegisterMySQLSSHDial(t *testing.T) {
+	first, releaseFirst := registerMySQLSSHDial(&sshTunnel{}, "tcp")
+	second, releaseSecond := registerMySQLSSHDial(&sshTunnel{}, "tcp")
+	if first == second {
+		t.Fatalf("failed test registerMySQLSSHDial same name %s", first)
+	}
+	releaseFirst()
+	// 解除した名前は次のトンネルで再利用する
+	third, releaseThird := registerMySQLSSHDial(&sshTunnel{}, "tcp")
+	if third != first {
+		t.Fatalf("failed test registerMySQLSSHDial reuse %s %s", first, third)
+	}
+	releaseSecond()
+	releaseThird()
+}
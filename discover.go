@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/iwot/erdh-go/config"
+	"github.com/iwot/erdh-go/db"
+	"github.com/iwot/erdh-go/erdh"
+)
+
+// runDiscover はDBのデータを調べ、見つけたリレーションを ex_info の断片として出力する
+// 調べるのは最初の読み込み元（mysql または sqlite）のみで、設定ファイルの ex_info でリレーションを指定したカラムは調べない
+func runDiscover(fs *flag.FlagSet, args []string) error {
+	cf := newConfigFlags(fs)
+	o := fs.String("out", "", "output ex_info file path (default stdout)")
+	sample := fs.Int("sample", 1000, "maximum number of distinct values sampled per candidate column")
+	minDistinct := fs.Int("min-distinct", 3, "minimum number of distinct values required to propose a relation")
+	minConfidence := fs.Float64("min-confidence", 0.95, "minimum ratio of sampled values found in the referenced column")
+	maxCandidates := fs.Int("max-candidates", 10000, "maximum number of column pairs sampled (columns named after the referenced table first)")
+	tables := fs.String("tables", "", "comma separated referencing tables to examine (default all)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	conf, err := cf.load()
+	if err != nil {
+		return err
+	}
+	if *sample <= 0 || *minDistinct <= 0 || *maxCandidates <= 0 || *minConfidence <= 0 || *minConfidence > 1 {
+		return usageError{"-sample, -min-distinct and -max-candidates must be positive and -min-confidence must be in (0, 1]"}
+	}
+	password, err := cf.password()
+	if err != nil {
+		return err
+	}
+
+	exInfo, err := config.NewExtraConfigFromYamlFiles(conf.ExInfo)
+	if err != nil {
+		return fmt.Errorf("read ex_info: %w", err)
+	}
+
+	src := conf.GetSources()[0]
+	if len(password) > 0 {
+		src.Password = password
+	}
+	fmt.Fprintln(os.Stderr, "discover from", src.SourceFrom)
+	opts := db.DiscoverOptions{
+		SampleSize:    *sample,
+		MinDistinct:   *minDistinct,
+		MinConfidence: *minConfidence,
+		MaxCandidates: *maxCandidates,
+		Tables:        splitList(*tables),
+		ExInfo:        exInfo,
+		Log:           os.Stderr,
+	}
+	cons, found, err := db.DiscoverSource(context.Background(), src, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d relations found\n", len(found))
+
+	out, err := createOutput(*o)
+	if err != nil {
+		return err
+	}
+	err = erdh.WriteDiscoveredExInfo(out, cons, found)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+package erdh
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PumlReservedWords はPlantUMLで別名として使えない語
+var PumlReservedWords = []string{
+	"abstract", "actor", "annotation", "artifact", "as", "bottom", "card", "class",
+	"cloud", "component", "database", "down", "end", "endlegend", "entity", "enum",
+	"file", "folder", "footer", "frame", "header", "hide", "interface", "json",
+	"left", "legend", "map", "namespace", "node", "note", "object", "package",
+	"queue", "rectangle", "remove", "right", "set", "show", "skinparam", "stack",
+	"storage", "title", "together", "top", "up", "usecase",
+}
+
+// Aliases は表示名から図の中で用いる識別子（別名）を生成する
+// 同じ表示名には常に同じ別名を返し、異なる表示名の別名が衝突しないようにする
+type Aliases struct {
+	byName   map[string]string
+	used     map[string]bool
+	reserved map[string]bool
+}
+
+// NewAliases は reserved を避けて別名を生成する Aliases を返す
+func NewAliases(reserved []string) *Aliases {
+	a := &Aliases{
+		byName:   map[string]string{},
+		used:     map[string]bool{},
+		reserved: map[string]bool{},
+	}
+	for _, r := range reserved {
+		a.reserved[strings.ToLower(r)] = true
+	}
+	return a
+}
+
+// NewPumlAliases はPlantUML用の Aliases を返す
+func NewPumlAliases() *Aliases {
+	return NewAliases(PumlReservedWords)
+}
+
+// Get は name の別名を返す
+// 英数字とアンダースコア以外の文字はアンダースコアに置き換え、衝突する場合は連番を付ける
+func (a *Aliases) Get(name string) string {
+	return a.GetScoped("", name)
+}
+
+// GetScoped は scope（グループなど）の中での name の別名を返す
+// scope が異なれば同じ名前でも異なる別名となる
+func (a *Aliases) GetScoped(scope, name string) string {
+	key := scope + "\x00" + name
+	if alias, ok := a.byName[key]; ok {
+		return alias
+	}
+
+	var b strings.Builder
+	for _, r := range name {
+		if r < 0x80 && (r == '_' || ('0' <= r && r <= '9') || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z')) {
+			b.WriteRune(r)
+		} else if r >= 0x80 {
+			// ASCII以外の文字は衝突しにくいようにコードポイントで表す
+			fmt.Fprintf(&b, "u%X", r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	base := b.String()
+	if len(base) == 0 || ('0' <= base[0] && base[0] <= '9') {
+		base = "_" + base
+	}
+	if a.reserved[strings.ToLower(base)] {
+		base = base + "_"
+	}
+
+	alias := base
+	for i := 2; a.used[alias]; i++ {
+		alias = fmt.Sprintf("%s_%d", base, i)
+	}
+
+	a.byName[key] = alias
+	a.used[alias] = true
+	return alias
+}
+
+// QuotePuml はPlantUMLのダブルクォートで囲む文字列として使えるように name を変換する
+// ダブルクォートは表示が変わらないように <U+0022> で表し、改行は空白に置き換える
+func QuotePuml(name string) string {
+	name = strings.Replace(name, "\"", "<U+0022>", -1)
+	name = strings.Replace(name, "\r", " ", -1)
+	return strings.Replace(name, "\n", " ", -1)
+}
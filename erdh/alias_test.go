@@ -0,0 +1,239 @@
+package erdh
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/iwot/erdh-go/config"
+)
+
+func TestAliases(t *testing.T) {
+	aliases := NewPumlAliases()
+
+	tests := []struct {
+		name  string
+		alias string
+	}{
+		{"members", "members"},
+		{"member-items", "member_items"},
+		{"member_items", "member_items_2"},
+		{"sales.orders", "sales_orders"},
+		{"order items", "order_items"},
+		{"package", "package_"},
+		{"1st", "_1st"},
+		{"会員", "u4F1Au54E1"},
+		{"", "_"},
+	}
+	for _, test := range tests {
+		if alias := aliases.Get(test.name); alias != test.alias {
+			t.Fatalf("failed test alias of %#v %#v", test.name, alias)
+		}
+	}
+
+	if alias := aliases.Get("member-items"); alias != "member_items" {
+		t.Fatalf("failed test alias is not stable %#v", alias)
+	}
+}
+
+var (
+	pumlIdentReg   = `[A-Za-z_][A-Za-z0-9_]*`
+	pumlPackageReg = regexp.MustCompile(`^package "[^"\n]*" as (` + pumlIdentReg + `)( #[0-9A-Fa-f]{6})? \{$`)
+	pumlEntityReg  = regexp.MustCompile(`^  entity "[^"\n]*" as (` + pumlIdentReg + `) <<\(.,#[0-9A-Fa-f]{6}\) [a-z]+>>( #[0-9A-Fa-f]{6})? \{$`)
+	pumlRelReg     = regexp.MustCompile(`^(` + pumlIdentReg + `)(?:::\w+)?  (?:"[^"\n]*" )?[|}o.-]{2}(?:-(?:\[#[0-9A-Fa-f]{6}\])?-|\.(?:\[#[0-9A-Fa-f]{6}\])?\.)[.|{o-]{2}(?: "[^"\n]*")?  (` + pumlIdentReg + `)(?:::\w+)?(?: : [^\n]+)?$`)
+	pumlStartReg   = regexp.MustCompile(`^@startuml( ` + pumlIdentReg + `)?$`)
+)
+
+// splitPumlDocuments は @enduml の行で区切ったドキュメントを返す
+func splitPumlDocuments(puml string) []string {
+	docs := []string{}
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(puml, "\n") {
+		b.WriteString(line)
+		if line == "@enduml\n" {
+			docs = append(docs, b.String())
+			b.Reset()
+		}
+	}
+	return docs
+}
+
+// checkPumlDocument は WritePuml が出力する範囲の構文としてドキュメントを検査する
+func checkPumlDocument(t *testing.T, doc string) {
+	declared := map[string]bool{}
+	depth := 0
+	inSkinparam := false
+	lines := strings.Split(strings.TrimSuffix(doc, "\n"), "\n")
+	for i, line := range lines {
+		switch {
+		case i == 0:
+			if !pumlStartReg.MatchString(line) {
+				t.Fatalf("invalid @startuml line %#v", line)
+			}
+		case i == len(lines)-1:
+			if line != "@enduml" || depth != 0 {
+				t.Fatalf("invalid @enduml line %#v", line)
+			}
+		case line == "skinparam class {" && depth == 0:
+			inSkinparam = true
+		case inSkinparam:
+			if line == "}" {
+				inSkinparam = false
+			} else if !strings.HasPrefix(line, "  BackgroundColor<<") {
+				t.Fatalf("invalid skinparam line %#v", line)
+			}
+		case pumlPackageReg.MatchString(line):
+			alias := pumlPackageReg.FindStringSubmatch(line)[1]
+			if depth != 0 || declared[alias] {
+				t.Fatalf("invalid package line %#v", line)
+			}
+			declared[alias] = true
+			depth++
+		case pumlEntityReg.MatchString(line):
+			alias := pumlEntityReg.FindStringSubmatch(line)[1]
+			if depth != 1 || declared[alias] {
+				t.Fatalf("invalid entity line %#v", line)
+			}
+			declared[alias] = true
+			depth++
+		case line == "  }" || line == "}":
+			depth--
+			if depth < 0 {
+				t.Fatalf("unbalanced brace %#v", line)
+			}
+		case pumlRelReg.MatchString(line):
+			if depth != 0 {
+				t.Fatalf("invalid relation line %#v", line)
+			}
+			m := pumlRelReg.FindStringSubmatch(line)
+			if !declared[m[1]] || !declared[m[2]] {
+				t.Fatalf("relation to undeclared alias %#v", line)
+			}
+		case depth == 2 && strings.HasPrefix(line, "    ") && !strings.Contains(line, "\n"):
+			// カラム
+		default:
+			t.Fatalf("unexpected line %#v in\n%s", line, doc)
+		}
+	}
+}
+
+func TestWritePumlAliasesDocument(t *testing.T) {
+	tests := []struct {
+		table1, group1, table2, group2, table3, column string
+	}{
+		{"members", "DATA", "member-items", "DATA", "sales.orders", "id"},
+		{"会員", "マスタ", "会員 履歴", "マスタ", "class", "会員番号"},
+		{"a", "a", "a_2", "b", "1", "a b"},
+		{"x\"y", "", "x'y", "g h", "package", "x\"y"},
+		{"line\nbreak", "g\r\nh", "{}", "@enduml", "end", "col\nname"},
+	}
+
+	for _, test := range tests {
+		var cons = &Construction{}
+		for _, tbl := range []Table{{Name: test.table1, Group: test.group1}, {Name: test.table2, Group: test.group2}, {Name: test.table3, Group: test.group1}} {
+			if cons.GetTableMut(tbl.Name).Group == "" {
+				cons.GetTableMut(tbl.Name).Group = tbl.Group
+			}
+		}
+		for i := range cons.Tables {
+			cons.Tables[i].AddColumn(test.column, "int", "PRI", "", "", true, true)
+			cons.Tables[i].AddColumn(test.column+"_2", "int", "", "", "", true, false)
+			cons.Tables[i].AddExRelations(test.table1, []ExRelationColumn{}, "many", "onlyone")
+		}
+
+		var puml bytes.Buffer
+		if err := WritePumlByGroup(&puml, cons, PumlOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		for _, doc := range splitPumlDocuments(puml.String()) {
+			checkPumlDocument(t, doc)
+		}
+	}
+}
+
+// aliasNameParts は TestWritePumlAliasesRandom で名前を組み立てる部品
+var aliasNameParts = []string{
+	"members", "items", "a", "A", "_", "1", "2nd", "-", ".", " ", "\"", "'", "\n", "\r\n", "{", "}", "@enduml", "::",
+	"package", "class", "entity", "end", "Entity", "u4F1A", "会員", "履歴", "マスタ", "ー", "_2", "",
+}
+
+func randomAliasName(r *rand.Rand) string {
+	var b strings.Builder
+	for i := r.Intn(4) + 1; i > 0; i-- {
+		b.WriteString(aliasNameParts[r.Intn(len(aliasNameParts))])
+	}
+	return b.String()
+}
+
+// TestWritePumlAliasesRandom は名前をランダムに組み立て、別名が衝突しないことと出力がPlantUMLとして読めることを確かめる
+// go.mod の go 1.15 では testing.F を使えないため、シードを固定した math/rand で入力を作る
+func TestWritePumlAliasesRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 300; n++ {
+		aliases := NewPumlAliases()
+		byAlias := map[string]string{}
+		var cons = &Construction{}
+		groups := []string{randomAliasName(r), randomAliasName(r)}
+		for i := r.Intn(6) + 1; i > 0; i-- {
+			name := randomAliasName(r)
+			alias := aliases.Get(name)
+			if other, ok := byAlias[alias]; ok && other != name {
+				t.Fatalf("failed test alias %q of %q collides with %q", alias, name, other)
+			}
+			byAlias[alias] = name
+			if again := aliases.Get(name); again != alias {
+				t.Fatalf("failed test alias of %q is not stable %q %q", name, alias, again)
+			}
+			if aliases.GetScoped("package", name) == alias {
+				t.Fatalf("failed test scoped alias of %q equals %q", name, alias)
+			}
+
+			tbl := cons.GetTableMut(name)
+			if len(tbl.Columns) > 0 {
+				continue
+			}
+			tbl.Group = groups[r.Intn(len(groups))]
+			tbl.AddColumn(randomAliasName(r), "int", "PRI", "", "", true, true)
+			tbl.AddColumn(randomAliasName(r), "int", "", "", "", false, false)
+		}
+		for i := range cons.Tables {
+			ref := cons.Tables[r.Intn(len(cons.Tables))]
+			cons.Tables[i].AddExRelations(ref.Name, []ExRelationColumn{{From: cons.Tables[i].Columns[1].Name, To: ref.Columns[0].Name}}, "many", "onlyone")
+		}
+
+		for _, opts := range []PumlOptions{{}, {Theme: config.Theme{EdgeStyle: "label"}}} {
+			var puml bytes.Buffer
+			if err := WritePumlByGroup(&puml, cons, opts); err != nil {
+				t.Fatal(err)
+			}
+			for _, doc := range splitPumlDocuments(puml.String()) {
+				checkPumlDocument(t, doc)
+			}
+			for _, tbl := range cons.Tables {
+				if !strings.Contains(puml.String(), fmt.Sprintf("entity \"%s\" as ", QuotePuml(tbl.Name))) {
+					t.Fatalf("failed test entity %q\n%s", tbl.Name, puml.String())
+				}
+			}
+		}
+	}
+}
+
+func TestQuotePuml(t *testing.T) {
+	tests := []struct {
+		name, quoted string
+	}{
+		{"members", "members"},
+		{"x\"y", "x<U+0022>y"},
+		{"x'y", "x'y"},
+		{"line\r\nbreak", "line  break"},
+		{"会員", "会員"},
+	}
+	for _, test := range tests {
+		if quoted := QuotePuml(test.name); quoted != test.quoted {
+			t.Fatalf("failed test QuotePuml(%q) %q", test.name, quoted)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package erdh
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/iwot/erdh-go/config"
+	"gopkg.in/yaml.v2"
+)
+
+// CardinalityStats はリレーションについてデータを集計した結果
+type CardinalityStats struct {
+	// Rows は参照元テーブルの行数
+	Rows int
+	// NullRows は参照元のカラムのいずれかがNULLの行数
+	NullRows int
+	// Orphans は参照元のカラムがNULLでなく、参照先に対応する行のない行数
+	Orphans int
+	// MaxChildren は参照先の値ひとつあたりの参照元の最大行数
+	MaxChildren int
+	// Parents は参照先テーブルの行数
+	Parents int
+	// ChildlessParents は参照元から参照されていない参照先の行数
+	ChildlessParents int
+	// MaxParents は参照先の値ひとつあたりの参照先の最大行数（参照先のカラムが一意でなければ2以上）
+	MaxParents int
+}
+
+// CardinalityCheck はリレーションに記述したカーディナリティとデータから集計した結果
+type CardinalityCheck struct {
+	Table    string
+	Relation ExRelation
+	Stats    CardinalityStats
+}
+
+// カーディナリティの上限として多数を表す値
+const cardinalityMany = 2
+
+// parseConnection は this_conn, that_conn の文字列の下限（0 または 1）と上限（1 または cardinalityMany）を返す
+// one（既定値）と無効な文字列は未指定として ok にfalseを、下限を指定しない many は下限に -1 を返す
+func parseConnection(conn string) (min, max int, ok bool) {
+	switch conn {
+	case "only-one", "onlyone":
+		return 1, 1, true
+	case "zero-or-one", "zeroorone":
+		return 0, 1, true
+	case "many":
+		return -1, cardinalityMany, true
+	case "one-more", "onemore":
+		return 1, cardinalityMany, true
+	case "zero-many", "zeromany":
+		return 0, cardinalityMany, true
+	default:
+		return 0, 0, false
+	}
+}
+
+func connectionName(min, max int) string {
+	switch {
+	case min == 1 && max == 1:
+		return "only-one"
+	case max <= 1:
+		return "zero-or-one"
+	case min == 1:
+		return "one-more"
+	default:
+		return "zero-many"
+	}
+}
+
+// ObservedConnections はデータから求めた this_conn と that_conn を返す
+func (c CardinalityCheck) ObservedConnections() (string, string) {
+	thisMin, thisMax := 1, 1
+	if c.Stats.ChildlessParents > 0 || c.Stats.Parents == 0 {
+		thisMin = 0
+	}
+	if c.Stats.MaxChildren > 1 {
+		thisMax = cardinalityMany
+	}
+	thatMin, thatMax := 1, 1
+	if c.Stats.NullRows > 0 || c.Stats.Orphans > 0 {
+		thatMin = 0
+	}
+	if c.Stats.MaxParents > 1 {
+		thatMax = cardinalityMany
+	}
+	return connectionName(thisMin, thisMax), connectionName(thatMin, thatMax)
+}
+
+// Problems は記述したカーディナリティとデータが食い違う点を返す
+// 上限が1のところに複数の行がある場合と、下限が1のところに行がない場合を問題とする
+// 未指定（one）のカーディナリティは検査しない
+func (c CardinalityCheck) Problems() []string {
+	thisProblems, thatProblems := c.problems()
+	return append(thisProblems, thatProblems...)
+}
+
+// problems は this_conn と that_conn それぞれについて、データと食い違う点を返す
+func (c CardinalityCheck) problems() (thisProblems, thatProblems []string) {
+	ref := c.Relation.ReferencedTableName
+	if min, max, ok := parseConnection(c.Relation.ThisConn); ok {
+		if max == 1 && c.Stats.MaxChildren > 1 {
+			thisProblems = append(thisProblems, fmt.Sprintf("this_conn %s but a %s row has up to %d %s rows", c.Relation.ThisConn, ref, c.Stats.MaxChildren, c.Table))
+		}
+		if min == 1 && c.Stats.ChildlessParents > 0 {
+			thisProblems = append(thisProblems, fmt.Sprintf("this_conn %s but %d %s rows have no %s rows", c.Relation.ThisConn, c.Stats.ChildlessParents, ref, c.Table))
+		}
+	}
+	if min, max, ok := parseConnection(c.Relation.ThatConn); ok {
+		if max == 1 && c.Stats.MaxParents > 1 {
+			thatProblems = append(thatProblems, fmt.Sprintf("that_conn %s but a %s row matches up to %d %s rows", c.Relation.ThatConn, c.Table, c.Stats.MaxParents, ref))
+		}
+		if min == 1 && c.Stats.NullRows > 0 {
+			thatProblems = append(thatProblems, fmt.Sprintf("that_conn %s but %d %s rows have NULL in %s", c.Relation.ThatConn, c.Stats.NullRows, c.Table, strings.Join(relationFromColumns(c.Relation), ", ")))
+		}
+		if min == 1 && c.Stats.Orphans > 0 {
+			thatProblems = append(thatProblems, fmt.Sprintf("that_conn %s but %d %s rows have no %s row", c.Relation.ThatConn, c.Stats.Orphans, c.Table, ref))
+		}
+	}
+	return thisProblems, thatProblems
+}
+
+func (c CardinalityCheck) String() string {
+	cols := []string{}
+	for _, col := range c.Relation.Columns {
+		cols = append(cols, col.From+"="+col.To)
+	}
+	thisConn, thatConn := c.ObservedConnections()
+	return fmt.Sprintf("%s -> %s (%s): declared %s/%s, observed %s/%s",
+		c.Table, c.Relation.ReferencedTableName, strings.Join(cols, ", "), c.Relation.ThisConn, c.Relation.ThatConn, thisConn, thatConn)
+}
+
+func relationFromColumns(exr ExRelation) []string {
+	result := []string{}
+	for _, col := range exr.Columns {
+		result = append(result, col.From)
+	}
+	return result
+}
+
+// ProposeExInfo は exInfo のカーディナリティを checks の結果で修正したものを返す
+// 未指定のカーディナリティはデータから求めた値で置き換え、データと食い違うカーディナリティはデータに合うように広げる
+// exInfo にないリレーション（外部キーに由来するものなど）は追加する
+// 同じリレーションに複数の結果（外部キーの制約ごとの結果）がある場合は、すべての結果に合うように広げる
+func ProposeExInfo(exInfo config.ExtraConfig, cons *Construction, checks []CardinalityCheck) config.ExtraConfig {
+	result := config.ExtraConfig{}
+	for _, t := range exInfo.Tables {
+		t.Relations = append([]config.ExRelation{}, t.Relations...)
+		result.Tables = append(result.Tables, t)
+	}
+	// proposed はこの関数で修正したリレーション、added は追加したリレーション（テーブル名と参照先テーブル名）
+	proposed, added := map[string]bool{}, map[string]bool{}
+
+	for _, c := range checks {
+		thisConn, thatConn := c.ObservedConnections()
+		_, _, thisOK := parseConnection(c.Relation.ThisConn)
+		_, _, thatOK := parseConnection(c.Relation.ThatConn)
+		thisProblems, thatProblems := c.problems()
+		if !thisOK {
+			c.Relation.ThisConn = thisConn
+		} else if len(thisProblems) > 0 {
+			c.Relation.ThisConn = correctConnection(c.Relation.ThisConn, thisConn)
+		}
+		if !thatOK {
+			c.Relation.ThatConn = thatConn
+		} else if len(thatProblems) > 0 {
+			c.Relation.ThatConn = correctConnection(c.Relation.ThatConn, thatConn)
+		}
+
+		var table *config.Table
+		for i := range result.Tables {
+			if result.Tables[i].Name == c.Table {
+				table = &result.Tables[i]
+				break
+			}
+		}
+		if table == nil {
+			t := config.Table{Name: c.Table}
+			if tbl := cons.findTable(c.Table); tbl != nil {
+				t.Group = tbl.Group
+				t.IsMaster = tbl.IsMaster
+				t.Kind = tbl.Kind
+			}
+			result.Tables = append(result.Tables, t)
+			table = &result.Tables[len(result.Tables)-1]
+		}
+
+		var relation *config.ExRelation
+		for i := range table.Relations {
+			if table.Relations[i].ReferencedTableName == c.Relation.ReferencedTableName {
+				relation = &table.Relations[i]
+				break
+			}
+		}
+		key := c.Table + "\x00" + c.Relation.ReferencedTableName
+		if relation == nil {
+			table.Relations = append(table.Relations, config.ExRelation{
+				ReferencedTableName: c.Relation.ReferencedTableName,
+				Columns:             []config.ColumnRelation{},
+			})
+			relation = &table.Relations[len(table.Relations)-1]
+			// 追加したリレーションには、集計したカラムの組をすべて加える
+			added[key] = true
+		}
+		if added[key] {
+			for _, col := range c.Relation.Columns {
+				relation.Columns = append(relation.Columns, config.ColumnRelation{From: col.From, To: col.To})
+			}
+		}
+		if proposed[key] {
+			relation.ThisConnection = correctConnection(relation.ThisConnection, c.Relation.ThisConn)
+			relation.ThatConnection = correctConnection(relation.ThatConnection, c.Relation.ThatConn)
+		} else {
+			relation.ThisConnection = c.Relation.ThisConn
+			relation.ThatConnection = c.Relation.ThatConn
+		}
+		proposed[key] = true
+	}
+	return result
+}
+
+// correctConnection は記述したカーディナリティを、データと食い違う下限と上限だけ observed に合わせて広げたものを返す
+func correctConnection(declared, observed string) string {
+	declaredMin, declaredMax, _ := parseConnection(declared)
+	observedMin, observedMax, _ := parseConnection(observed)
+	if declaredMin < 0 || observedMin < declaredMin {
+		declaredMin = observedMin
+	}
+	if observedMax > declaredMax {
+		declaredMax = observedMax
+	}
+	return connectionName(declaredMin, declaredMax)
+}
+
+// WriteExInfo は ex_info をYAMLとして書き込む
+func WriteExInfo(w io.Writer, exInfo config.ExtraConfig) error {
+	buf, err := yaml.Marshal(exInfo)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
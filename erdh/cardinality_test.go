@@ -0,0 +1,115 @@
+package erdh
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/iwot/erdh-go/config"
+)
+
+func TestCardinalityCheck(t *testing.T) {
+	check := CardinalityCheck{
+		Table: "orders",
+		Relation: ExRelation{
+			ReferencedTableName: "members",
+			Columns:             []ExRelationColumn{{From: "member_id", To: "id"}},
+			ThisConn:            "zero-or-one",
+			ThatConn:            "only-one",
+		},
+		Stats: CardinalityStats{Rows: 5, NullRows: 1, Orphans: 0, MaxChildren: 3, Parents: 4, ChildlessParents: 2, MaxParents: 1},
+	}
+	if thisConn, thatConn := check.ObservedConnections(); thisConn != "zero-many" || thatConn != "zero-or-one" {
+		t.Fatalf("failed test ObservedConnections %s %s", thisConn, thatConn)
+	}
+	expected := []string{
+		"this_conn zero-or-one but a members row has up to 3 orders rows",
+		"that_conn only-one but 1 orders rows have NULL in member_id",
+	}
+	if problems := check.Problems(); strings.Join(problems, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("failed test Problems %#v", problems)
+	}
+	if check.String() != "orders -> members (member_id=id): declared zero-or-one/only-one, observed zero-many/zero-or-one" {
+		t.Fatalf("failed test String %s", check.String())
+	}
+
+	// 広いカーディナリティは食い違いとしない
+	check.Relation.ThisConn, check.Relation.ThatConn = "zero-many", "zero-or-one"
+	if problems := check.Problems(); len(problems) != 0 {
+		t.Fatalf("failed test Problems %#v", problems)
+	}
+	// 未指定のカーディナリティは検査しない
+	check.Relation.ThisConn, check.Relation.ThatConn = "one", "one"
+	if problems := check.Problems(); len(problems) != 0 {
+		t.Fatalf("failed test Problems %#v", problems)
+	}
+}
+
+func TestProposeExInfo(t *testing.T) {
+	var cons = &Construction{}
+	cons.Tables = []Table{{Name: "members", Group: "DATA"}, {Name: "orders", Group: "DATA"}, {Name: "items", Group: "MASTER", IsMaster: true}}
+	exInfo := config.ExtraConfig{Tables: []config.Table{
+		{Name: "orders", Group: "DATA", Relations: []config.ExRelation{{
+			ReferencedTableName: "members",
+			Columns:             []config.ColumnRelation{{From: "member_id", To: "id"}},
+			ThisConnection:      "one-more",
+			ThatConnection:      "only-one",
+			Label:               "placed by",
+		}}},
+	}}
+	checks := []CardinalityCheck{
+		{
+			Table:    "orders",
+			Relation: ExRelation{ReferencedTableName: "members", Columns: []ExRelationColumn{{From: "member_id", To: "id"}}, ThisConn: "one-more", ThatConn: "only-one"},
+			Stats:    CardinalityStats{Rows: 3, Orphans: 1, MaxChildren: 2, Parents: 2, ChildlessParents: 1, MaxParents: 1},
+		},
+		{
+			Table:    "orders",
+			Relation: ExRelation{ReferencedTableName: "items", Columns: []ExRelationColumn{{From: "item_id", To: "id"}}, ThisConn: "one", ThatConn: "one"},
+			Stats:    CardinalityStats{Rows: 3, MaxChildren: 1, Parents: 3, MaxParents: 1},
+		},
+	}
+
+	proposal := ProposeExInfo(exInfo, cons, checks)
+	var b bytes.Buffer
+	if err := WriteExInfo(&b, proposal); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := config.NewExtraConfigFromYaml(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	relations := parsed.Tables[0].Relations
+	if len(parsed.Tables) != 1 || len(relations) != 2 {
+		t.Fatalf("failed test ProposeExInfo\n%s", b.String())
+	}
+	// 食い違う下限だけを広げ、ラベルなどはそのまま残す
+	if relations[0].ThisConnection != "zero-many" || relations[0].ThatConnection != "zero-or-one" || relations[0].Label != "placed by" {
+		t.Fatalf("failed test ProposeExInfo corrected\n%s", b.String())
+	}
+	if relations[1].ReferencedTableName != "items" || relations[1].ThisConnection != "only-one" || relations[1].ThatConnection != "only-one" {
+		t.Fatalf("failed test ProposeExInfo added\n%s", b.String())
+	}
+	if exInfo.Tables[0].Relations[0].ThisConnection != "one-more" || len(exInfo.Tables[0].Relations) != 1 {
+		t.Fatalf("failed test ProposeExInfo modifies the original %#v", exInfo)
+	}
+	// 同じリレーションの外部キーごとの結果は、すべてに合うように広げる
+	checks = []CardinalityCheck{
+		{
+			Table:    "orders",
+			Relation: ExRelation{ReferencedTableName: "members", Columns: []ExRelationColumn{{From: "member_id", To: "id", Constraint: "fk_0"}}},
+			Stats:    CardinalityStats{Rows: 3, MaxChildren: 1, Parents: 3, MaxParents: 1},
+		},
+		{
+			Table:    "orders",
+			Relation: ExRelation{ReferencedTableName: "members", Columns: []ExRelationColumn{{From: "reviewer_id", To: "id", Constraint: "fk_1"}}},
+			Stats:    CardinalityStats{Rows: 3, NullRows: 1, MaxChildren: 2, Parents: 3, ChildlessParents: 1, MaxParents: 1},
+		},
+	}
+	proposal = ProposeExInfo(config.ExtraConfig{}, cons, checks)
+	relations = proposal.Tables[0].Relations
+	if len(relations) != 1 || len(relations[0].Columns) != 2 || relations[0].Columns[1].From != "reviewer_id" ||
+		relations[0].ThisConnection != "zero-many" || relations[0].ThatConnection != "zero-or-one" {
+		t.Fatalf("failed test ProposeExInfo per foreign key %#v", relations)
+	}
+}
@@ -2,26 +2,68 @@ package erdh
 
 import (
 	"io/ioutil"
+	"strings"
 
 	"github.com/iwot/erdh-go/config"
-	"gopkg.in/yaml.v2"
 )
 
 // Construction 中間形式
 type Construction struct {
-	DBName string  `yaml:"db_name"`
-	Tables []Table `yaml:"tables"`
+	FormatVersion int     `yaml:"format_version" json:"format_version"`
+	DBName        string  `yaml:"db_name" json:"db_name"`
+	Tables        []Table `yaml:"tables" json:"tables"`
 }
 
 // Table は中間形式中のテーブル型
 type Table struct {
-	Name        string       `yaml:"table"`
-	Group       string       `yaml:"group"`
-	Columns     []Column     `yaml:"columns"`
-	Indexes     []Index      `yaml:"indexes"`
-	ForeginKeys []ForeginKey `yaml:"foreign_keys"`
-	ExRelations []ExRelation `yaml:"ex-relations"`
-	IsMaster    bool         `yaml:"is-master"`
+	Name        string       `yaml:"table" json:"table"`
+	Schema      string       `yaml:"schema,omitempty" json:"schema,omitempty"`
+	Group       string       `yaml:"group" json:"group"`
+	Columns     []Column     `yaml:"columns" json:"columns"`
+	Indexes     []Index      `yaml:"indexes" json:"indexes"`
+	ForeginKeys []ForeginKey `yaml:"foreign_keys" json:"foreign_keys"`
+	ExRelations []ExRelation `yaml:"ex_relations" json:"ex_relations"`
+	IsMaster    bool         `yaml:"is_master" json:"is_master"`
+	Kind        string       `yaml:"kind,omitempty" json:"kind,omitempty"`
+	// WithoutRowID はSQLiteの WITHOUT ROWID テーブルであればtrue
+	WithoutRowID bool `yaml:"without_rowid,omitempty" json:"without_rowid,omitempty"`
+	// Strict はSQLiteの STRICT テーブルであればtrue
+	Strict bool `yaml:"strict,omitempty" json:"strict,omitempty"`
+	// Module は仮想テーブルのモジュール名（fts5, rtree など）。通常のテーブルでは空
+	Module string `yaml:"module,omitempty" json:"module,omitempty"`
+	// Stats はテーブルの統計情報。collect_stats を指定して読んだ場合のみ設定される
+	Stats *TableStats `yaml:"stats,omitempty" json:"stats,omitempty"`
+}
+
+// TableStats はテーブルの統計情報
+// MySQL では information_schema.tables の値（InnoDB の行数は推定値）、SQLite では COUNT(*) と（使えれば）dbstat の値
+type TableStats struct {
+	Rows          int64  `yaml:"rows" json:"rows"`
+	DataLength    int64  `yaml:"data_length,omitempty" json:"data_length,omitempty"`
+	IndexLength   int64  `yaml:"index_length,omitempty" json:"index_length,omitempty"`
+	Engine        string `yaml:"engine,omitempty" json:"engine,omitempty"`
+	Collation     string `yaml:"collation,omitempty" json:"collation,omitempty"`
+	AutoIncrement int64  `yaml:"auto_increment,omitempty" json:"auto_increment,omitempty"`
+}
+
+// テーブルの種類
+const (
+	// TableKindMaster はマスタテーブル
+	TableKindMaster = "master"
+	// TableKindTransaction はトランザクションテーブル
+	TableKindTransaction = "transaction"
+)
+
+// GetKind はテーブルの種類を返す
+// Kind が未指定の場合は IsMaster に従って master または transaction とする
+func (t Table) GetKind() string {
+	if len(t.Kind) > 0 {
+		return t.Kind
+	}
+	if t.IsMaster {
+		return TableKindMaster
+	}
+	return TableKindTransaction
 }
 
 // AddTable は引数のTableがすでに登録されていなければ追加する
@@ -73,46 +115,64 @@ func (c Construction) GetTableToGroupMap() map[string]string {
 }
 
 // UpdateExRelationsFromForeignKeys は ForeginKeys を元にして ExRelations を更新する
+// ExRelations は参照先テーブルが ForeginKeys に最初に現れた順に並ぶ
 func (c *Construction) UpdateExRelationsFromForeignKeys() {
 	for ti, t := range c.Tables {
-		var exRelationsMap = map[string]ExRelation{}
+		exRelations := []ExRelation{}
+		exRelationIndex := map[string]int{}
 		for _, f := range t.ForeginKeys {
 			if len(f.ReferencedTableName) == 0 {
 				continue
 			}
-			if val, ok := exRelationsMap[f.ReferencedTableName]; ok {
-				val.Columns = append(val.Columns, ExRelationColumn{From: f.ColumnName, To: f.ReferencedColumnName})
-			} else {
-				exRelationsMap[f.ReferencedTableName] = ExRelation{
+			idx, ok := exRelationIndex[f.ReferencedTableName]
+			if !ok {
+				idx = len(exRelations)
+				exRelationIndex[f.ReferencedTableName] = idx
+				exRelations = append(exRelations, ExRelation{
 					ReferencedTableName: f.ReferencedTableName,
 					Columns:             []ExRelationColumn{},
 					ThisConn:            "one",
 					ThatConn:            "one",
-				}
+					Source:              RelationSourceForeignKey,
+				})
 			}
+			exRelations[idx].Columns = append(exRelations[idx].Columns, ExRelationColumn{From: f.ColumnName, To: f.ReferencedColumnName, Constraint: f.ConstraintName})
 		}
 
-		c.Tables[ti].ExRelations = []ExRelation{}
-		for _, e := range exRelationsMap {
-			c.Tables[ti].ExRelations = append(c.Tables[ti].ExRelations, e)
-		}
+		c.Tables[ti].ExRelations = exRelations
 	}
 }
 
 // ApplyExInfo は config.ExtraConfig を ExRelations に適用する
+// 存在しないテーブルの設定と、存在しないテーブルへのリレーションは適用しない（ValidateExInfo で警告する）
+// 外部キーなどですでにあるカラムの組は追加しない
 func (c *Construction) ApplyExInfo(exInfo config.ExtraConfig) {
 	for _, ex := range exInfo.Tables {
-		table := c.GetTableMut(ex.Name)
+		table := c.findTable(ex.Name)
+		if table == nil {
+			continue
+		}
 		table.IsMaster = ex.IsMaster
+		table.Kind = ex.Kind
 		table.Group = ex.Group
 		for _, exr := range ex.Relations {
+			if c.findTable(exr.ReferencedTableName) == nil {
+				continue
+			}
 			e := table.GetExRelationOfReferencedTableMut(exr.ReferencedTableName)
 			e.ThisConn = exr.ThisConnection
 			e.ThatConn = exr.ThatConnection
+			e.Label = exr.Label
+			e.ThisRole = exr.ThisRole
+			e.ThatRole = exr.ThatRole
+			e.Style = exr.Style
 			// var columns []ExRelationColumn
 			for _, exrc := range exr.Columns {
 				// columns = append(columns, ExRelationColumn{exrc.From, exrc.To})
-				e.Columns = append(e.Columns, ExRelationColumn{exrc.From, exrc.To})
+				if e.hasColumn(exrc.From, exrc.To) {
+					continue
+				}
+				e.Columns = append(e.Columns, ExRelationColumn{From: exrc.From, To: exrc.To})
 			}
 			// var t = ExRelation{exr.ReferencedTableName, columns, exr.ThisConnection, exr.ThatConnection}
 			// table.ExRelations = append(table.ExRelations, t)
@@ -120,9 +180,33 @@ func (c *Construction) ApplyExInfo(exInfo config.ExtraConfig) {
 	}
 }
 
+// QualifiedTableName はスキーマ名で修飾したテーブル名を返す
+func QualifiedTableName(schema, table string) string {
+	if len(schema) == 0 {
+		return table
+	}
+	return schema + "." + table
+}
+
+// LocalName はスキーマ修飾を除いたテーブル名を返す
+func (t Table) LocalName() string {
+	if len(t.Schema) == 0 {
+		return t.Name
+	}
+	return strings.TrimPrefix(t.Name, t.Schema+".")
+}
+
 // AddColumn はColumnを追加する
 func (t *Table) AddColumn(name, columnType, key, extra, def string, notnull, isPrimary bool) {
-	t.Columns = append(t.Columns, Column{name, columnType, key, extra, def, notnull, isPrimary})
+	t.Columns = append(t.Columns, Column{
+		Name:       name,
+		ColumnType: columnType,
+		Key:        key,
+		Extra:      extra,
+		Default:    def,
+		NotNull:    notnull,
+		IsPrimary:  isPrimary,
+	})
 }
 
 // AddIndex はIndexを追加する
@@ -132,15 +216,30 @@ func (t *Table) AddIndex(indexName, columnName string) {
 
 // AddForeginKey はForeginKeyを追加する
 func (t *Table) AddForeginKey(constraintName, columnName, referencedTableName, ReferencedColumnName string) {
-	t.ForeginKeys = append(t.ForeginKeys, ForeginKey{constraintName, columnName, referencedTableName, ReferencedColumnName})
+	t.ForeginKeys = append(
+		t.ForeginKeys,
+		ForeginKey{
+			ConstraintName:       constraintName,
+			ColumnName:           columnName,
+			ReferencedTableName:  referencedTableName,
+			ReferencedColumnName: ReferencedColumnName,
+		})
 }
 
 // AddExRelations はExRelationを追加する
 func (t *Table) AddExRelations(referencedTableName string, columns []ExRelationColumn, thisConn, thatConn string) {
-	t.ExRelations = append(t.ExRelations, ExRelation{referencedTableName, columns, thisConn, thatConn})
+	t.ExRelations = append(
+		t.ExRelations,
+		ExRelation{
+			ReferencedTableName: referencedTableName,
+			Columns:             columns,
+			ThisConn:            thisConn,
+			ThatConn:            thatConn,
+		})
 }
 
 // GetExRelationOfReferencedTableMut はtableNameへのExRelationを追加し、そのポインタを返す
+// 追加したExRelationの由来は ex_info とする
 func (t *Table) GetExRelationOfReferencedTableMut(tableName string) *ExRelation {
 	for i, e := range t.ExRelations {
 		if e.ReferencedTableName == tableName {
@@ -154,43 +253,81 @@ func (t *Table) GetExRelationOfReferencedTableMut(tableName string) *ExRelation
 			ReferencedTableName: tableName,
 			Columns:             []ExRelationColumn{},
 			ThisConn:            "one",
-			ThatConn:            "one"})
+			ThatConn:            "one",
+			Source:              RelationSourceExInfo})
 	return &t.ExRelations[len(t.ExRelations)-1]
 }
 
 // Column はテーブルのカラム表現
 type Column struct {
-	Name       string `yaml:"name"`
-	ColumnType string `yaml:"type"`
-	Key        string `yaml:"key"`
-	Extra      string `yaml:"extra"`
-	Default    string `yaml:"default"`
-	NotNull    bool   `yaml:"not_null"`
-	IsPrimary  bool   `yaml:"is_primary"`
+	Name       string `yaml:"name" json:"name"`
+	ColumnType string `yaml:"type" json:"type"`
+	Key        string `yaml:"key" json:"key"`
+	Extra      string `yaml:"extra" json:"extra"`
+	Default    string `yaml:"default" json:"default"`
+	NotNull    bool   `yaml:"not_null" json:"not_null"`
+	IsPrimary  bool   `yaml:"is_primary" json:"is_primary"`
+	// Generated は生成列の種類（virtual または stored）。生成列でなければ空
+	Generated string `yaml:"generated,omitempty" json:"generated,omitempty"`
 }
 
+// 生成列の種類
+const (
+	// GeneratedVirtual は読み出し時に計算される生成列
+	GeneratedVirtual = "virtual"
+	// GeneratedStored は書き込み時に計算して保存される生成列
+	GeneratedStored = "stored"
+)
+
 // Index はテーブルのインデックス表現
 type Index struct {
-	Name       string `yaml:"name"`
-	ColumnName string `yaml:"column_name"`
+	Name       string `yaml:"name" json:"name"`
+	ColumnName string `yaml:"column_name" json:"column_name"`
 }
 
 // ForeginKey はテーブルの外部参照表現
 type ForeginKey struct {
-	ConstraintName       string `yaml:"constraint_name"`
-	ColumnName           string `yaml:"column_name"`
-	ReferencedTableName  string `yaml:"referenced_table_name"`
-	ReferencedColumnName string `yaml:"referenced_column_name"`
+	ConstraintName        string `yaml:"constraint_name" json:"constraint_name"`
+	ColumnName            string `yaml:"column_name" json:"column_name"`
+	ReferencedTableSchema string `yaml:"referenced_table_schema,omitempty" json:"referenced_table_schema,omitempty"`
+	ReferencedTableName   string `yaml:"referenced_table_name" json:"referenced_table_name"`
+	ReferencedColumnName  string `yaml:"referenced_column_name" json:"referenced_column_name"`
 }
 
 // ExRelation はユーザーによるテーブル構造（ForeginKey）にはない、参照表現
 type ExRelation struct {
-	ReferencedTableName string             `yaml:"referenced_table_name"`
-	Columns             []ExRelationColumn `yaml:"columns"`
-	ThisConn            string             `yaml:"this_conn"`
-	ThatConn            string             `yaml:"that_conn"`
+	ReferencedTableName string             `yaml:"referenced_table_name" json:"referenced_table_name"`
+	Columns             []ExRelationColumn `yaml:"columns" json:"columns"`
+	ThisConn            string             `yaml:"this_conn" json:"this_conn"`
+	ThatConn            string             `yaml:"that_conn" json:"that_conn"`
+	Source              string             `yaml:"source,omitempty" json:"source,omitempty"`
+	Label               string             `yaml:"label,omitempty" json:"label,omitempty"`
+	ThisRole            string             `yaml:"this_role,omitempty" json:"this_role,omitempty"`
+	ThatRole            string             `yaml:"that_role,omitempty" json:"that_role,omitempty"`
+	Style               string             `yaml:"style,omitempty" json:"style,omitempty"`
+}
+
+// ExRelationの線の種類
+const (
+	// RelationStyleSolid は実線（既定）
+	RelationStyleSolid = "solid"
+	// RelationStyleDashed は破線。論理的なだけのリレーションなどに用いる
+	RelationStyleDashed = "dashed"
+)
+
+// IsValidRelationStyle は style に指定できる文字列であればtrueを返す
+func IsValidRelationStyle(style string) bool {
+	return style == RelationStyleSolid || style == RelationStyleDashed
 }
 
+// ExRelationの由来
+const (
+	// RelationSourceForeignKey は外部キーに由来するリレーション
+	RelationSourceForeignKey = "fk"
+	// RelationSourceExInfo は ex_info でのみ定義されたリレーション
+	RelationSourceExInfo = "ex_info"
+)
+
 // ReferencedTableInfo はReferencedTableNameを取得するためのインターフェイス
 type ReferencedTableInfo interface {
 	GetReferencedTableName() string
@@ -208,8 +345,65 @@ func (e ExRelation) GetReferencedTableName() string {
 
 // ExRelationColumn はExRelationで用いるカラム表現
 type ExRelationColumn struct {
-	From string `yaml:"from"`
-	To   string `yaml:"to"`
+	From string `yaml:"from" json:"from"`
+	To   string `yaml:"to" json:"to"`
+	// Constraint は外部キーに由来するカラムの組の制約名。同じ参照先への複数の外部キーを区別する
+	Constraint string `yaml:"constraint,omitempty" json:"constraint,omitempty"`
+}
+
+// hasColumn は from から to へのカラムの組があればtrueを返す
+func (e ExRelation) hasColumn(from, to string) bool {
+	for _, col := range e.Columns {
+		if col.From == from && col.To == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ColumnGroups はカラムの組を制約ごと（Constraint が最初に現れた順）にまとめて返す
+// 制約名のないカラム（ex_info で指定したものなど）はひとつの組とする
+func (e ExRelation) ColumnGroups() [][]ExRelationColumn {
+	result := [][]ExRelationColumn{}
+	index := map[string]int{}
+	for _, col := range e.Columns {
+		i, ok := index[col.Constraint]
+		if !ok {
+			i = len(result)
+			index[col.Constraint] = i
+			result = append(result, []ExRelationColumn{})
+		}
+		result[i] = append(result[i], col)
+	}
+	return result
+}
+
+// SplitByColumnGroups はリレーションを ColumnGroups の組ごとのリレーションに分けて返す
+// 同じテーブルへの複数の外部キーを、ひとつの複合キーとしてではなく別々に扱う場合に用いる
+// 外部キーに由来するリレーションのうち、制約名のない組（ex_info で加えたカラム）の Source は ex_info とする
+// ただし、どのカラムにも制約名がない場合（制約名を記録していない古い中間形式ファイル）はすべて外部キーとする
+func (e ExRelation) SplitByColumnGroups() []ExRelation {
+	hasConstraint := false
+	for _, col := range e.Columns {
+		if len(col.Constraint) > 0 {
+			hasConstraint = true
+		}
+	}
+	result := []ExRelation{}
+	for _, columns := range e.ColumnGroups() {
+		sub := e.withColumns(columns)
+		if sub.Source == RelationSourceForeignKey && hasConstraint && len(columns[0].Constraint) == 0 {
+			sub.Source = RelationSourceExInfo
+		}
+		result = append(result, sub)
+	}
+	return result
+}
+
+// withColumns はカラムの組を columns に置き換えたリレーションを返す
+func (e ExRelation) withColumns(columns []ExRelationColumn) ExRelation {
+	e.Columns = columns
+	return e
 }
 
 // NewConstructionFromYamlFile は与えられたYAMLファイルパスからConstructionを生成して返す
@@ -223,13 +417,7 @@ func NewConstructionFromYamlFile(path string) (*Construction, error) {
 }
 
 // NewConstructionFromYaml は与えられたYAML文字列からConstructionを生成して返す
+// 古い形式のファイルは現在の形式に変換して読む
 func NewConstructionFromYaml(buf []byte) (*Construction, error) {
-	var result = new(Construction)
-
-	err := yaml.Unmarshal(buf, &result)
-	if err != nil {
-		return nil, err
-	}
-
-	return result, nil
+	return decodeConstruction(buf, false, false)
 }
@@ -0,0 +1,78 @@
+package erdh
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQualifiedTableName(t *testing.T) {
+	tests := []struct {
+		schema, table string
+		qualified     string
+		local         string
+	}{
+		{"", "members", "members", "members"},
+		{"shop", "members", "shop.members", "members"},
+		{"main", "sqlite_stat1", "main.sqlite_stat1", "sqlite_stat1"},
+		{"shop", "shop.members", "shop.shop.members", "shop.members"},
+	}
+	for _, tt := range tests {
+		if got := QualifiedTableName(tt.schema, tt.table); got != tt.qualified {
+			t.Fatalf("failed test QualifiedTableName(%q, %q) %q", tt.schema, tt.table, got)
+		}
+		tbl := Table{Name: tt.qualified, Schema: tt.schema}
+		if got := tbl.LocalName(); got != tt.local {
+			t.Fatalf("failed test LocalName %#v %q", tbl, got)
+		}
+	}
+
+	// スキーマ名で修飾されていない名前はそのまま返す
+	for _, tbl := range []Table{
+		{Name: "members", Schema: "shop"},
+		{Name: "archive.members", Schema: "shop"},
+		{Name: "shop_members", Schema: "shop"},
+	} {
+		if got := tbl.LocalName(); got != tbl.Name {
+			t.Fatalf("failed test LocalName without schema prefix %#v %q", tbl, got)
+		}
+	}
+}
+
+func TestSplitByColumnGroups(t *testing.T) {
+	exr := ExRelation{
+		ReferencedTableName: "members",
+		Columns: []ExRelationColumn{
+			{From: "member_id", To: "id", Constraint: "fk_member"},
+			{From: "editor_id", To: "id"},
+			{From: "reviewer_id", To: "id", Constraint: "fk_reviewer"},
+			{From: "approver_id", To: "id"},
+		},
+		ThisConn: "zero-many",
+		Source:   RelationSourceForeignKey,
+	}
+
+	got := []string{}
+	for _, sub := range exr.SplitByColumnGroups() {
+		cols := []string{}
+		for _, col := range sub.Columns {
+			cols = append(cols, col.From)
+		}
+		got = append(got, strings.Join(cols, "+")+":"+sub.Source+":"+sub.ThisConn)
+	}
+	expected := []string{"member_id:fk:zero-many", "editor_id+approver_id:ex_info:zero-many", "reviewer_id:fk:zero-many"}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Fatalf("failed test SplitByColumnGroups %#v", got)
+	}
+	if len(exr.Columns) != 4 {
+		t.Fatalf("failed test SplitByColumnGroups modifies the original %#v", exr)
+	}
+
+	// 制約名のない古い中間形式ファイルの外部キーはひとつの組とし、由来を変えない
+	exr.Columns = []ExRelationColumn{{From: "shop_id", To: "shop_id"}, {From: "item_code", To: "item_code"}}
+	if subs := exr.SplitByColumnGroups(); len(subs) != 1 || len(subs[0].Columns) != 2 || subs[0].Source != RelationSourceForeignKey {
+		t.Fatalf("failed test SplitByColumnGroups without constraint names %#v", subs)
+	}
+	if subs := (ExRelation{ReferencedTableName: "members"}).SplitByColumnGroups(); len(subs) != 0 {
+		t.Fatalf("failed test SplitByColumnGroups without columns %#v", subs)
+	}
+}
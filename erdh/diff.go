@@ -0,0 +1,246 @@
+package erdh
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 差分の種類
+const (
+	// DiffAdded は新しい側にのみあるもの
+	DiffAdded = "+"
+	// DiffRemoved は古い側にのみあるもの
+	DiffRemoved = "-"
+	// DiffChanged は両方にあり内容が異なるもの
+	DiffChanged = "~"
+)
+
+// DiffObjectStats は統計情報（行数とサイズ）の変化を表す Difference.Object
+const DiffObjectStats = "stats"
+
+// Difference は2つの Construction の差分ひとつ分
+type Difference struct {
+	Op    string
+	Table string
+	// Object は差分のあった要素（例：column id）。テーブル自体の追加、削除では空
+	Object string
+	// Detail は変更内容（例：type int -> bigint）
+	Detail string
+}
+
+// IsStats は統計情報の変化であればtrueを返す
+// 統計情報の変化はデータの増減であり、テーブル構造の差分ではない
+func (d Difference) IsStats() bool {
+	return d.Object == DiffObjectStats
+}
+
+func (d Difference) String() string {
+	s := d.Op + " " + d.Table
+	if len(d.Object) > 0 {
+		s += " " + d.Object
+	}
+	if len(d.Detail) > 0 {
+		s += ": " + d.Detail
+	}
+	return s
+}
+
+// Diff は old から new への差分をテーブル名順に返す
+// 両方に統計情報のあるテーブルは、行数またはサイズが変化していれば Object が DiffObjectStats の差分を加える
+func Diff(old, new *Construction) []Difference {
+	result := []Difference{}
+
+	oldTables := map[string]*Table{}
+	for i := range old.Tables {
+		oldTables[old.Tables[i].Name] = &old.Tables[i]
+	}
+	newTables := map[string]*Table{}
+	for i := range new.Tables {
+		newTables[new.Tables[i].Name] = &new.Tables[i]
+	}
+
+	names := []string{}
+	for name := range oldTables {
+		names = append(names, name)
+	}
+	for name := range newTables {
+		if _, ok := oldTables[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		o, n := oldTables[name], newTables[name]
+		switch {
+		case o == nil:
+			result = append(result, Difference{Op: DiffAdded, Table: name})
+		case n == nil:
+			result = append(result, Difference{Op: DiffRemoved, Table: name})
+		default:
+			result = append(result, diffTable(o, n)...)
+		}
+	}
+
+	return result
+}
+
+func diffTable(o, n *Table) []Difference {
+	result := []Difference{}
+	add := func(op, object, detail string) {
+		result = append(result, Difference{Op: op, Table: n.Name, Object: object, Detail: detail})
+	}
+
+	if o.Group != n.Group {
+		add(DiffChanged, "group", o.Group+" -> "+n.Group)
+	}
+	if o.GetKind() != n.GetKind() {
+		add(DiffChanged, "kind", o.GetKind()+" -> "+n.GetKind())
+	}
+
+	oldColumns := map[string]Column{}
+	for _, c := range o.Columns {
+		oldColumns[c.Name] = c
+	}
+	newColumns := map[string]bool{}
+	for _, c := range n.Columns {
+		newColumns[c.Name] = true
+		oc, ok := oldColumns[c.Name]
+		if !ok {
+			add(DiffAdded, "column "+c.Name, c.ColumnType)
+			continue
+		}
+		if detail := diffColumn(oc, c); len(detail) > 0 {
+			add(DiffChanged, "column "+c.Name, detail)
+		}
+	}
+	for _, c := range o.Columns {
+		if !newColumns[c.Name] {
+			add(DiffRemoved, "column "+c.Name, c.ColumnType)
+		}
+	}
+
+	diffNamed(indexDescriptions(o.Indexes), indexDescriptions(n.Indexes), "index", add)
+	diffNamed(foreignKeyDescriptions(o.ForeginKeys), foreignKeyDescriptions(n.ForeginKeys), "foreign key", add)
+	diffNamed(relationDescriptions(o.ExRelations), relationDescriptions(n.ExRelations), "relation", add)
+
+	if o.Stats != nil && n.Stats != nil {
+		if g := (TableGrowth{Table: n.Name, Old: *o.Stats, New: *n.Stats}); g.Changed() {
+			add(DiffChanged, DiffObjectStats, g.Detail())
+		}
+	}
+
+	return result
+}
+
+func diffColumn(o, n Column) string {
+	details := []string{}
+	if o.ColumnType != n.ColumnType {
+		details = append(details, fmt.Sprintf("type %s -> %s", o.ColumnType, n.ColumnType))
+	}
+	if o.NotNull != n.NotNull {
+		details = append(details, fmt.Sprintf("not_null %t -> %t", o.NotNull, n.NotNull))
+	}
+	if o.Default != n.Default {
+		details = append(details, fmt.Sprintf("default %q -> %q", o.Default, n.Default))
+	}
+	if o.IsPrimary != n.IsPrimary {
+		details = append(details, fmt.Sprintf("is_primary %t -> %t", o.IsPrimary, n.IsPrimary))
+	}
+	if o.Extra != n.Extra {
+		details = append(details, fmt.Sprintf("extra %q -> %q", o.Extra, n.Extra))
+	}
+	return strings.Join(details, ", ")
+}
+
+// diffNamed は名前から内容への対応を比較し、名前順に差分を追加する
+func diffNamed(o, n map[string]string, kind string, add func(op, object, detail string)) {
+	names := []string{}
+	for name := range o {
+		names = append(names, name)
+	}
+	for name := range n {
+		if _, ok := o[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		od, inOld := o[name]
+		nd, inNew := n[name]
+		switch {
+		case !inOld:
+			add(DiffAdded, kind+" "+name, nd)
+		case !inNew:
+			add(DiffRemoved, kind+" "+name, od)
+		case od != nd:
+			add(DiffChanged, kind+" "+name, od+" -> "+nd)
+		}
+	}
+}
+
+func indexDescriptions(indexes []Index) map[string]string {
+	columns := map[string][]string{}
+	for _, idx := range indexes {
+		columns[idx.Name] = append(columns[idx.Name], idx.ColumnName)
+	}
+	result := map[string]string{}
+	for name, cols := range columns {
+		result[name] = "(" + strings.Join(cols, ", ") + ")"
+	}
+	return result
+}
+
+// foreignKeyDescriptions は制約名ごとに外部キーの内容を返す
+// 制約名のない外部キー（SQLiteなど）はカラム名で区別する
+func foreignKeyDescriptions(fks []ForeginKey) map[string]string {
+	type fkColumns struct {
+		table string
+		from  []string
+		to    []string
+	}
+	byName := map[string]*fkColumns{}
+	for _, fk := range fks {
+		if len(fk.ReferencedTableName) == 0 {
+			continue
+		}
+		name := fk.ConstraintName
+		if len(name) == 0 {
+			name = fk.ColumnName
+		}
+		if _, ok := byName[name]; !ok {
+			byName[name] = &fkColumns{table: fk.ReferencedTableName}
+		}
+		byName[name].from = append(byName[name].from, fk.ColumnName)
+		byName[name].to = append(byName[name].to, fk.ReferencedColumnName)
+	}
+	result := map[string]string{}
+	for name, fk := range byName {
+		result[name] = fmt.Sprintf("(%s) -> %s(%s)", strings.Join(fk.from, ", "), fk.table, strings.Join(fk.to, ", "))
+	}
+	return result
+}
+
+func relationDescriptions(relations []ExRelation) map[string]string {
+	result := map[string]string{}
+	for _, exr := range relations {
+		cols := []string{}
+		for _, c := range exr.Columns {
+			cols = append(cols, c.From+"="+c.To)
+		}
+		desc := fmt.Sprintf("%s/%s (%s)", exr.ThisConn, exr.ThatConn, strings.Join(cols, ", "))
+		if len(exr.Label) > 0 {
+			desc += fmt.Sprintf(" %q", exr.Label)
+		}
+		if len(exr.ThisRole) > 0 || len(exr.ThatRole) > 0 {
+			desc += fmt.Sprintf(" [%s/%s]", exr.ThisRole, exr.ThatRole)
+		}
+		if len(exr.Style) > 0 && exr.Style != RelationStyleSolid {
+			desc += " " + exr.Style
+		}
+		result[exr.ReferencedTableName] = desc
+	}
+	return result
+}
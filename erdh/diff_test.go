@@ -0,0 +1,93 @@
+package erdh
+
+import (
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	var old = &Construction{}
+	items := Table{Name: "items", Group: "DATA"}
+	items.AddColumn("id", "int", "PRI", "", "", true, true)
+	items.AddColumn("name", "varchar(32)", "", "", "", false, false)
+	items.AddColumn("price", "int", "", "", "0", true, false)
+	items.AddIndex("idx_name", "name")
+	memberItems := Table{Name: "member_items", Group: "DATA"}
+	memberItems.AddColumn("id", "int", "PRI", "", "", true, true)
+	memberItems.AddColumn("item_id", "int", "", "", "", true, false)
+	memberItems.AddForeginKey("fk_item", "item_id", "items", "id")
+	logs := Table{Name: "logs", Group: "LOG"}
+	logs.AddColumn("id", "int", "PRI", "", "", true, true)
+	old.Tables = []Table{memberItems, items, logs}
+
+	var new = &Construction{}
+	items = Table{Name: "items", Group: "MASTER", IsMaster: true}
+	items.AddColumn("id", "bigint", "PRI", "", "", true, true)
+	items.AddColumn("name", "varchar(32)", "", "", "", true, false)
+	items.AddColumn("code", "varchar(8)", "", "", "", true, false)
+	items.AddIndex("idx_name", "name")
+	items.AddIndex("idx_name", "code")
+	memberItems = Table{Name: "member_items", Group: "DATA"}
+	memberItems.AddColumn("id", "int", "PRI", "", "", true, true)
+	memberItems.AddColumn("item_id", "int", "", "", "", true, false)
+	memberItems.AddForeginKey("fk_item", "item_id", "items", "id")
+	members := Table{Name: "members", Group: "DATA"}
+	new.Tables = []Table{items, memberItems, members}
+
+	expected := []string{
+		"~ items group: DATA -> MASTER",
+		"~ items kind: transaction -> master",
+		"~ items column id: type int -> bigint",
+		"~ items column name: not_null false -> true",
+		"+ items column code: varchar(8)",
+		"- items column price: int",
+		"~ items index idx_name: (name) -> (name, code)",
+		"- logs",
+		"+ members",
+	}
+	diffs := Diff(old, new)
+	if len(diffs) != len(expected) {
+		t.Fatalf("failed test Diff %#v", diffs)
+	}
+	for i, d := range diffs {
+		if d.String() != expected[i] {
+			t.Fatalf("failed test Diff[%d] %#v", i, d.String())
+		}
+	}
+
+	if diffs := Diff(new, new); len(diffs) != 0 {
+		t.Fatalf("failed test Diff of same construction %#v", diffs)
+	}
+}
+
+func TestDiffStats(t *testing.T) {
+	old := &Construction{Tables: []Table{
+		{Name: "orders", Stats: &TableStats{Rows: 1200, DataLength: 1024 * 1024}},
+		{Name: "members", Stats: &TableStats{Rows: 10}},
+		{Name: "items", Stats: &TableStats{Rows: 5}},
+		{Name: "logs"},
+	}}
+	new := &Construction{Tables: []Table{
+		{Name: "orders", Stats: &TableStats{Rows: 3400, DataLength: 2 * 1024 * 1024}},
+		{Name: "members", Stats: &TableStats{Rows: 10}},
+		{Name: "items", Group: "MASTER"},
+		{Name: "logs", Stats: &TableStats{Rows: 100}},
+	}}
+
+	// 統計情報は両方にあるテーブルだけを比べる
+	expected := []string{
+		"~ items group:  -> MASTER",
+		"~ orders stats: rows 1,200 -> 3,400 (+2,200, +183.3%), size 1.0 MB -> 2.0 MB",
+	}
+	diffs := Diff(old, new)
+	if len(diffs) != len(expected) {
+		t.Fatalf("failed test Diff stats %#v", diffs)
+	}
+	for i, d := range diffs {
+		if d.String() != expected[i] {
+			t.Fatalf("failed test Diff stats[%d] %#v", i, d.String())
+		}
+	}
+	if diffs[0].IsStats() || !diffs[1].IsStats() {
+		t.Fatalf("failed test IsStats %#v", diffs)
+	}
+}
@@ -0,0 +1,221 @@
+package erdh
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// RelationCandidate はデータを調べてリレーションかどうかを判断するカラムの組
+type RelationCandidate struct {
+	Table            string
+	Column           string
+	ReferencedTable  string
+	ReferencedColumn string
+}
+
+// DiscoveredRelation はリレーションの候補について、参照元の値が参照先にどれだけ含まれていたかを調べた結果
+type DiscoveredRelation struct {
+	RelationCandidate
+	// Sampled は調べた参照元の値（NULLを除く重複しない値）の数
+	Sampled int
+	// Matched は Sampled のうち参照先に存在した値の数
+	Matched int
+}
+
+// Confidence は参照元の値が参照先に含まれていた割合（0から1）を返す
+func (d DiscoveredRelation) Confidence() float64 {
+	if d.Sampled == 0 {
+		return 0
+	}
+	return float64(d.Matched) / float64(d.Sampled)
+}
+
+// RelationCandidates はデータを調べるリレーションの候補を返す
+// 参照先は主キーまたはユニークキーのカラムひとつで、参照元は型の互換性があり、まだリレーションのないカラムとする
+// 参照先と同じ名前の単独の主キー（id と id など）と、仮想テーブルは候補にしない
+func (c *Construction) RelationCandidates() []RelationCandidate {
+	type uniqueColumn struct {
+		table  Table
+		column Column
+	}
+	referenced := []uniqueColumn{}
+	for _, t := range c.Tables {
+		if len(t.Module) > 0 {
+			continue
+		}
+		pk := t.PrimaryKeyColumns()
+		for _, col := range t.Columns {
+			if (len(pk) == 1 && col.IsPrimary) || col.Key == "UNI" {
+				referenced = append(referenced, uniqueColumn{t, col})
+			}
+		}
+	}
+
+	result := []RelationCandidate{}
+	for _, t := range c.Tables {
+		if len(t.Module) > 0 {
+			continue
+		}
+		related := map[string]bool{}
+		for _, e := range t.ExRelations {
+			for _, col := range e.Columns {
+				related[col.From] = true
+			}
+		}
+		pk := t.PrimaryKeyColumns()
+		for _, col := range t.Columns {
+			if related[col.Name] {
+				continue
+			}
+			for _, ref := range referenced {
+				if ref.table.Name == t.Name && ref.column.Name == col.Name {
+					continue
+				}
+				if len(pk) == 1 && col.IsPrimary && col.Name == ref.column.Name {
+					continue
+				}
+				if !compatibleColumnTypes(col.ColumnType, ref.column.ColumnType) {
+					continue
+				}
+				result = append(result, RelationCandidate{
+					Table:            t.Name,
+					Column:           col.Name,
+					ReferencedTable:  ref.table.Name,
+					ReferencedColumn: ref.column.Name,
+				})
+			}
+		}
+	}
+	return result
+}
+
+// PrioritizeCandidates はカラム名が参照先テーブルを指す候補（items に対する item_id など）を先にした候補を返す
+func (c *Construction) PrioritizeCandidates(candidates []RelationCandidate) []RelationCandidate {
+	tables := map[string]Table{}
+	for _, t := range c.Tables {
+		tables[t.Name] = t
+	}
+	first, rest := []RelationCandidate{}, []RelationCandidate{}
+	for _, rc := range candidates {
+		if t, ok := tables[rc.ReferencedTable]; ok && columnNameRefersTo(rc.Column, t) {
+			first = append(first, rc)
+		} else {
+			rest = append(rest, rc)
+		}
+	}
+	return append(first, rest...)
+}
+
+// compatibleColumnTypes は2つのカラムの型が同じ種類（整数、文字列など）であればtrueを返す
+// 型のないカラム（SQLite）はどの型とも互換とする
+func compatibleColumnTypes(a, b string) bool {
+	x, y := columnTypeFamily(a), columnTypeFamily(b)
+	return len(x) == 0 || len(y) == 0 || x == y
+}
+
+// columnTypeFamily はSQLiteの型の親和性の規則に倣ってカラムの型の種類を返す
+func columnTypeFamily(columnType string) string {
+	t := strings.ToLower(columnType)
+	switch {
+	case len(t) == 0:
+		return ""
+	case strings.Contains(t, "int") || strings.Contains(t, "serial"):
+		return "integer"
+	case strings.Contains(t, "char") || strings.Contains(t, "clob") || strings.Contains(t, "text") || strings.Contains(t, "uuid"):
+		return "text"
+	case strings.Contains(t, "blob") || strings.Contains(t, "binary"):
+		return "blob"
+	case strings.Contains(t, "real") || strings.Contains(t, "floa") || strings.Contains(t, "doub"):
+		return "real"
+	case strings.Contains(t, "date") || strings.Contains(t, "time"):
+		return "datetime"
+	default:
+		return t
+	}
+}
+
+// columnNameRefersTo はカラム名が参照先テーブルを指す名前（items に対する item_id など）であればtrueを返す
+func columnNameRefersTo(column string, table Table) bool {
+	base := strings.TrimSuffix(strings.TrimSuffix(column, "_id"), "_code")
+	name := table.LocalName()
+	for _, candidate := range []string{base + "s", base + "es", strings.TrimSuffix(base, "y") + "ies", base} {
+		if candidate == name {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteDiscoveredExInfo はデータから見つけたリレーションを ex_info の断片として書き込む
+// 参照元のカラムごとに最も確からしい参照先を relations に記入し（同じ確からしさであればカラム名が参照先を指すもの）、
+// その他の参照先はコメントとして出力する
+// ex_info のリレーションは参照先テーブルごとにひとつのため、すでに記入した参照先テーブルへのリレーションもコメントとする
+func WriteDiscoveredExInfo(w io.Writer, cons *Construction, found []DiscoveredRelation) error {
+	sorted := append([]DiscoveredRelation{}, found...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Table != b.Table {
+			return a.Table < b.Table
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		if a.Confidence() != b.Confidence() {
+			return a.Confidence() > b.Confidence()
+		}
+		an, bn := nameRefers(cons, a), nameRefers(cons, b)
+		if an != bn {
+			return an
+		}
+		return a.ReferencedTable < b.ReferencedTable
+	})
+
+	fmt.Fprintf(w, "# relations discovered from data in %s\n", cons.DBName)
+	fmt.Fprintln(w, "tables:")
+	for i := 0; i < len(sorted); {
+		tableName := sorted[i].Table
+		j := i
+		for j < len(sorted) && sorted[j].Table == tableName {
+			j++
+		}
+
+		fmt.Fprintf(w, "- table: %s\n", quoteYaml(tableName))
+		if t := cons.findTable(tableName); t != nil {
+			fmt.Fprintf(w, "  group: %s\n", quoteYaml(t.Group))
+		}
+		fmt.Fprintln(w, "  relations:")
+
+		referencedTables := map[string]bool{}
+		chosenColumns := map[string]bool{}
+		for _, d := range sorted[i:j] {
+			fmt.Fprintf(w, "  # confidence %.2f (%d of %d sampled values found in %s.%s)\n",
+				d.Confidence(), d.Matched, d.Sampled, d.ReferencedTable, d.ReferencedColumn)
+
+			columns := []ExRelationColumn{{From: d.Column, To: d.ReferencedColumn}}
+			e := ExRelation{
+				ReferencedTableName: d.ReferencedTable,
+				Columns:             columns,
+				Style:               RelationStyleDashed,
+			}
+			if t := cons.findTable(tableName); t != nil {
+				e.ThisConn, e.ThatConn = t.InferConnections(columns)
+			}
+			indent := "  # "
+			if !chosenColumns[d.Column] && !referencedTables[d.ReferencedTable] {
+				indent = "  "
+				chosenColumns[d.Column] = true
+				referencedTables[d.ReferencedTable] = true
+			}
+			writeExInfoRelations(w, []ExRelation{e}, indent)
+		}
+		i = j
+	}
+	return nil
+}
+
+func nameRefers(cons *Construction, d DiscoveredRelation) bool {
+	t := cons.findTable(d.ReferencedTable)
+	return t != nil && columnNameRefersTo(d.Column, *t)
+}
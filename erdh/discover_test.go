@@ -0,0 +1,75 @@
+package erdh
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/iwot/erdh-go/config"
+)
+
+func TestRelationCandidates(t *testing.T) {
+	var cons = &Construction{}
+	members := Table{Name: "members", Group: "DATA"}
+	members.AddColumn("id", "int", "PRI", "", "", true, true)
+	members.AddColumn("email", "varchar(255)", "UNI", "", "", true, false)
+	orders := Table{Name: "orders", Group: "DATA"}
+	orders.AddColumn("id", "bigint", "PRI", "", "", true, true)
+	orders.AddColumn("buyer_id", "int unsigned", "", "", "", true, false)
+	orders.AddColumn("memo", "text", "", "", "", false, false)
+	orders.AddColumn("ordered_at", "datetime", "", "", "", false, false)
+	cons.Tables = []Table{members, orders}
+
+	got := []string{}
+	for _, c := range cons.RelationCandidates() {
+		got = append(got, c.Table+"."+c.Column+"->"+c.ReferencedTable+"."+c.ReferencedColumn)
+	}
+	// 型の種類が異なる members.email -> orders.id や、id -> id は候補にならない
+	expected := []string{
+		"orders.buyer_id->members.id",
+		"orders.buyer_id->orders.id",
+		"orders.memo->members.email",
+	}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Fatalf("failed test RelationCandidates %#v", got)
+	}
+}
+
+func TestWriteDiscoveredExInfo(t *testing.T) {
+	var cons = &Construction{DBName: "shop"}
+	for _, name := range []string{"members", "staffs"} {
+		tbl := Table{Name: name, Group: "DATA"}
+		tbl.AddColumn("id", "int", "PRI", "", "", true, true)
+		cons.Tables = append(cons.Tables, tbl)
+	}
+	orders := Table{Name: "orders", Group: "DATA"}
+	orders.AddColumn("member_id", "int", "", "", "", true, false)
+	orders.AddColumn("staff_id", "int", "", "", "", false, false)
+	cons.Tables = append(cons.Tables, orders)
+
+	found := []DiscoveredRelation{
+		{RelationCandidate{"orders", "staff_id", "members", "id"}, 10, 10},
+		{RelationCandidate{"orders", "member_id", "staffs", "id"}, 10, 10},
+		{RelationCandidate{"orders", "member_id", "members", "id"}, 10, 10},
+		{RelationCandidate{"orders", "staff_id", "staffs", "id"}, 10, 10},
+	}
+	var b bytes.Buffer
+	if err := WriteDiscoveredExInfo(&b, cons, found); err != nil {
+		t.Fatal(err)
+	}
+	exInfo, err := config.NewExtraConfigFromYaml(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同じ確からしさであればカラム名が指すテーブルを採用する
+	relations := exInfo.Tables[0].Relations
+	if len(relations) != 2 ||
+		relations[0].ReferencedTableName != "members" || relations[0].Columns[0].From != "member_id" ||
+		relations[1].ReferencedTableName != "staffs" || relations[1].Columns[0].From != "staff_id" ||
+		relations[1].ThatConnection != "zero-or-one" {
+		t.Fatalf("failed test WriteDiscoveredExInfo\n%s", b.String())
+	}
+	if !strings.Contains(b.String(), "  # confidence 1.00 (10 of 10 sampled values found in staffs.id)\n  # - referenced_table_name: \"staffs\"\n") {
+		t.Fatalf("failed test WriteDiscoveredExInfo comments\n%s", b.String())
+	}
+}
@@ -0,0 +1,241 @@
+package erdh
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/iwot/erdh-go/config"
+)
+
+// InferConnections は columns で参照するリレーションの this_conn と that_conn を推定する
+// 参照元のカラムが主キーと一致すれば参照元は高々1行、NOT NULL であれば参照先は必ず1行とする
+func (t Table) InferConnections(columns []ExRelationColumn) (string, string) {
+	from := []string{}
+	notNull := len(columns) > 0
+	for _, c := range columns {
+		from = append(from, c.From)
+		col := t.GetColumn(c.From)
+		if col == nil || !col.NotNull {
+			notNull = false
+		}
+	}
+
+	thisConn := "zero-many"
+	if len(from) > 0 && sameStringSet(from, t.PrimaryKeyColumns()) {
+		thisConn = "zero-or-one"
+	}
+	thatConn := "zero-or-one"
+	if notNull {
+		thatConn = "only-one"
+	}
+	return thisConn, thatConn
+}
+
+// GetColumn は指定した名前のカラムを返す。存在しなければnilを返す
+func (t Table) GetColumn(name string) *Column {
+	for i, c := range t.Columns {
+		if c.Name == name {
+			return &t.Columns[i]
+		}
+	}
+	return nil
+}
+
+// PrimaryKeyColumns は主キーのカラム名を返す
+func (t Table) PrimaryKeyColumns() []string {
+	result := []string{}
+	for _, c := range t.Columns {
+		if c.IsPrimary {
+			result = append(result, c.Name)
+		}
+	}
+	return result
+}
+
+func sameStringSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	x := append([]string{}, a...)
+	y := append([]string{}, b...)
+	sort.Strings(x)
+	sort.Strings(y)
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// SuggestRelations は外部キーのないカラムのうち、名前から参照先が推測できるものをリレーションの候補として返す
+// 例えば item_id は items.id（または item.id）への参照とみなす
+func (c *Construction) SuggestRelations(t Table) []ExRelation {
+	related := map[string]bool{}
+	for _, e := range t.ExRelations {
+		for _, col := range e.Columns {
+			related[col.From] = true
+		}
+	}
+
+	result := []ExRelation{}
+	for _, col := range t.Columns {
+		if related[col.Name] || !strings.HasSuffix(col.Name, "_id") {
+			continue
+		}
+		base := strings.TrimSuffix(col.Name, "_id")
+		for _, candidate := range []string{base + "s", base + "es", strings.TrimSuffix(base, "y") + "ies", base} {
+			referenced := c.findTable(QualifiedTableName(t.Schema, candidate))
+			if referenced == nil {
+				referenced = c.findTable(candidate)
+			}
+			if referenced == nil || referenced.Name == t.Name || referenced.GetColumn("id") == nil {
+				continue
+			}
+			columns := []ExRelationColumn{{From: col.Name, To: "id"}}
+			thisConn, thatConn := t.InferConnections(columns)
+			result = append(result, ExRelation{
+				ReferencedTableName: referenced.Name,
+				Columns:             columns,
+				ThisConn:            thisConn,
+				ThatConn:            thatConn,
+			})
+			break
+		}
+	}
+	return result
+}
+
+func (c *Construction) findTable(name string) *Table {
+	for i, t := range c.Tables {
+		if t.Name == name {
+			return &c.Tables[i]
+		}
+	}
+	return nil
+}
+
+// WriteExInfoSkeleton は全テーブルを列挙した ex_info の雛形を書き込む
+// 外部キーに由来するリレーションは推定したカーディナリティで記入し、名前から推測したリレーションはコメントとして出力する
+func WriteExInfoSkeleton(w io.Writer, cons *Construction) error {
+	fmt.Fprintf(w, "# ex_info skeleton generated from %s\n", cons.DBName)
+	fmt.Fprintln(w, "tables:")
+	return writeExInfoTables(w, cons, cons.Tables)
+}
+
+var topLevelKeyReg = regexp.MustCompile(`^[^\s#-]`)
+
+// UpdateExInfoSkeleton は既存の ex_info に含まれないテーブルの雛形を末尾に追加したものを返す
+// 既存の内容（コメントを含む）はそのまま残す
+func UpdateExInfoSkeleton(existing []byte, cons *Construction) ([]byte, error) {
+	exInfo, err := config.NewExtraConfigFromYaml(existing)
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, t := range exInfo.Tables {
+		known[t.Name] = true
+	}
+
+	// tables が最後のトップレベルのキーである場合のみ末尾に追加できる
+	hasTablesKey := false
+	scanner := bufio.NewScanner(bytes.NewReader(existing))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "tables:") {
+			if strings.TrimSpace(strings.TrimPrefix(line, "tables:")) != "" {
+				return nil, errors.New("tables must be a block list to append new tables")
+			}
+			hasTablesKey = true
+		} else if hasTablesKey && topLevelKeyReg.MatchString(line) {
+			return nil, errors.New("tables must be the last key to append new tables")
+		}
+	}
+
+	newTables := []Table{}
+	for _, t := range cons.Tables {
+		if !known[t.Name] {
+			newTables = append(newTables, t)
+		}
+	}
+
+	var b bytes.Buffer
+	b.Write(existing)
+	if len(existing) > 0 && !bytes.HasSuffix(existing, []byte("\n")) {
+		b.WriteString("\n")
+	}
+	if len(newTables) == 0 {
+		return b.Bytes(), nil
+	}
+	if !hasTablesKey {
+		b.WriteString("tables:\n")
+	}
+	err = writeExInfoTables(&b, cons, newTables)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func writeExInfoTables(w io.Writer, cons *Construction, tables []Table) error {
+	for _, t := range tables {
+		fmt.Fprintf(w, "- table: %s\n", quoteYaml(t.Name))
+		fmt.Fprintf(w, "  group: %s\n", quoteYaml(t.Group))
+		fmt.Fprintln(w, "  is_master: false")
+
+		relations := []ExRelation{}
+		for _, e := range t.ExRelations {
+			if e.Source == RelationSourceForeignKey {
+				e.ThisConn, e.ThatConn = t.InferConnections(e.Columns)
+				relations = append(relations, e)
+			}
+		}
+		if len(relations) > 0 {
+			fmt.Fprintln(w, "  relations:")
+			writeExInfoRelations(w, relations, "  ")
+		}
+
+		suggestions := cons.SuggestRelations(t)
+		if len(suggestions) > 0 {
+			fmt.Fprintln(w, "  # suggested from column names:")
+			if len(relations) == 0 {
+				fmt.Fprintln(w, "  # relations:")
+			}
+			writeExInfoRelations(w, suggestions, "  # ")
+		}
+	}
+	return nil
+}
+
+func writeExInfoRelations(w io.Writer, relations []ExRelation, indent string) {
+	for _, e := range relations {
+		fmt.Fprintf(w, "%s- referenced_table_name: %s\n", indent, quoteYaml(e.ReferencedTableName))
+		fmt.Fprintf(w, "%s  columns:\n", indent)
+		for _, c := range e.Columns {
+			fmt.Fprintf(w, "%s  - from: %s\n", indent, quoteYaml(c.From))
+			fmt.Fprintf(w, "%s    to: %s\n", indent, quoteYaml(c.To))
+		}
+		fmt.Fprintf(w, "%s  this_conn: %s\n", indent, quoteYaml(e.ThisConn))
+		fmt.Fprintf(w, "%s  that_conn: %s\n", indent, quoteYaml(e.ThatConn))
+		for _, opt := range []struct{ key, value string }{
+			{"label", e.Label}, {"this_role", e.ThisRole}, {"that_role", e.ThatRole}, {"style", e.Style},
+		} {
+			if len(opt.value) > 0 {
+				fmt.Fprintf(w, "%s  %s: %s\n", indent, opt.key, quoteYaml(opt.value))
+			}
+		}
+	}
+}
+
+// quoteYaml はYAMLのダブルクォート文字列として値を返す
+func quoteYaml(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
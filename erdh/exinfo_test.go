@@ -0,0 +1,132 @@
+package erdh
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/iwot/erdh-go/config"
+)
+
+func newExInfoTestConstruction() *Construction {
+	var cons = &Construction{DBName: "shop"}
+	items := Table{Name: "items", Group: "shop"}
+	items.AddColumn("id", "int", "PRI", "", "", true, true)
+	categories := Table{Name: "categories", Group: "shop"}
+	categories.AddColumn("id", "int", "PRI", "", "", true, true)
+	memberItems := Table{Name: "member_items", Group: "shop"}
+	memberItems.AddColumn("id", "int", "PRI", "", "", true, true)
+	memberItems.AddColumn("item_id", "int", "", "", "", true, false)
+	memberItems.AddColumn("category_id", "int", "", "", "", false, false)
+	memberItems.AddForeginKey("fk_item", "item_id", "items", "id")
+	itemDetails := Table{Name: "item_details", Group: "shop"}
+	itemDetails.AddColumn("item_id", "int", "PRI", "", "", true, true)
+	itemDetails.AddForeginKey("fk_item", "item_id", "items", "id")
+	cons.Tables = []Table{categories, items, itemDetails, memberItems}
+	cons.UpdateExRelationsFromForeignKeys()
+	return cons
+}
+
+func TestWriteExInfoSkeleton(t *testing.T) {
+	cons := newExInfoTestConstruction()
+
+	var buf bytes.Buffer
+	if err := WriteExInfoSkeleton(&buf, cons); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, `  # - referenced_table_name: "categories"`) {
+		t.Fatalf("failed test suggestion\n%s", out)
+	}
+
+	exInfo, err := config.NewExtraConfigFromYaml(buf.Bytes())
+	if err != nil {
+		t.Fatalf("failed test skeleton is not valid ex_info %#v\n%s", err, out)
+	}
+	if len(exInfo.Tables) != 4 {
+		t.Fatalf("failed test skeleton tables %#v", exInfo.Tables)
+	}
+	details := exInfo.Tables[2].Relations
+	if len(details) != 1 || details[0].ThisConnection != "zero-or-one" || details[0].ThatConnection != "only-one" {
+		t.Fatalf("failed test inferred cardinality %#v", details)
+	}
+	memberItems := exInfo.Tables[3].Relations
+	if len(memberItems) != 1 || memberItems[0].ThisConnection != "zero-many" || memberItems[0].Columns[0].From != "item_id" {
+		t.Fatalf("failed test inferred cardinality %#v", memberItems)
+	}
+	if len(cons.ValidateExInfo(*exInfo, nil)) != 0 {
+		t.Fatalf("failed test skeleton validation %#v", cons.ValidateExInfo(*exInfo, nil))
+	}
+}
+
+func TestApplyExInfoSkeleton(t *testing.T) {
+	cons := newExInfoTestConstruction()
+	members := Table{Name: "members", Group: "shop"}
+	members.AddColumn("id", "int", "PRI", "", "", true, true)
+	reviews := Table{Name: "reviews", Group: "shop"}
+	reviews.AddColumn("id", "int", "PRI", "", "", true, true)
+	reviews.AddColumn("member_id", "int", "", "", "", true, false)
+	reviews.AddColumn("reviewer_id", "int", "", "", "", true, false)
+	reviews.AddForeginKey("fk_member", "member_id", "members", "id")
+	reviews.AddForeginKey("fk_reviewer", "reviewer_id", "members", "id")
+	cons.Tables = append(cons.Tables, members, reviews)
+	cons.UpdateExRelationsFromForeignKeys()
+
+	var buf bytes.Buffer
+	if err := WriteExInfoSkeleton(&buf, cons); err != nil {
+		t.Fatal(err)
+	}
+	exInfo, err := config.NewExtraConfigFromYaml(buf.Bytes())
+	if err != nil {
+		t.Fatalf("failed test skeleton is not valid ex_info %#v\n%s", err, buf.String())
+	}
+
+	// 雛形を適用しても外部キーのカラムの組は重複しない
+	counts := map[string]int{}
+	for _, tbl := range cons.Tables {
+		for _, exr := range tbl.ExRelations {
+			counts[tbl.Name+"->"+exr.ReferencedTableName] = len(exr.Columns)
+		}
+	}
+	cons.ApplyExInfo(*exInfo)
+	for _, tbl := range cons.Tables {
+		for _, exr := range tbl.ExRelations {
+			key := tbl.Name + "->" + exr.ReferencedTableName
+			if len(exr.Columns) != counts[key] {
+				t.Fatalf("failed test ApplyExInfo columns of %s %#v", key, exr.Columns)
+			}
+		}
+	}
+	if got := cons.GetTableMut("reviews").ExRelations[0].Columns; len(got) != 2 || got[1].Constraint != "fk_reviewer" {
+		t.Fatalf("failed test ApplyExInfo reviews %#v", got)
+	}
+}
+
+func TestUpdateExInfoSkeleton(t *testing.T) {
+	cons := newExInfoTestConstruction()
+	existing := []byte(`# hand-edited
+tables:
+- table: items
+  is_master: true # master data
+  group: MASTER
+`)
+
+	updated, err := UpdateExInfoSkeleton(existing, cons)
+	if err != nil {
+		t.Fatalf("failed test UpdateExInfoSkeleton %#v", err)
+	}
+	if !bytes.HasPrefix(updated, existing) {
+		t.Fatalf("failed test existing entries are preserved\n%s", updated)
+	}
+	exInfo, err := config.NewExtraConfigFromYaml(updated)
+	if err != nil {
+		t.Fatalf("failed test updated ex_info is not valid %#v\n%s", err, updated)
+	}
+	if len(exInfo.Tables) != 4 || exInfo.Tables[0].Group != "MASTER" || exInfo.Tables[1].Name != "categories" {
+		t.Fatalf("failed test updated tables %#v", exInfo.Tables)
+	}
+
+	if _, err := UpdateExInfoSkeleton([]byte("tables:\n- table: items\nversion: 1\n"), cons); err == nil {
+		t.Fatalf("failed test tables is not the last key")
+	}
+}
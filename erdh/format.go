@@ -0,0 +1,203 @@
+package erdh
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// CurrentFormatVersion は中間形式ファイルの現在の形式バージョン
+// format_version がないファイルはバージョン1として扱う
+const CurrentFormatVersion = 2
+
+// formatMigrations は形式バージョン i+1 から i+2 への変換
+var formatMigrations = []func(doc map[string]interface{}) error{
+	// 1 -> 2: ex-relations, is-master を ex_relations, is_master に改名し、リレーションの由来（source）を補う
+	func(doc map[string]interface{}) error {
+		return eachTableDocument(doc, func(table map[string]interface{}) {
+			renameDocumentKey(table, "ex-relations", "ex_relations")
+			renameDocumentKey(table, "is-master", "is_master")
+			fillRelationSources(table)
+		})
+	},
+}
+
+// NewConstructionFromFileStrict は NewConstructionFromFile と同様に中間形式ファイルを読むが、
+// 未知のフィールドを含む場合はエラーとする
+func NewConstructionFromFileStrict(path string) (*Construction, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeConstruction(buf, IsJSONPath(path), true)
+}
+
+// decodeConstruction は中間形式を読み、現在の形式バージョンに変換したConstructionを返す
+func decodeConstruction(buf []byte, isJSON, strict bool) (*Construction, error) {
+	var raw interface{}
+	var err error
+	if isJSON {
+		err = json.Unmarshal(buf, &raw)
+	} else {
+		err = yaml.Unmarshal(buf, &raw)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	doc, ok := normalizeDocument(raw).(map[string]interface{})
+	if !ok {
+		if raw == nil {
+			doc = map[string]interface{}{}
+		} else {
+			return nil, fmt.Errorf("intermediate file must be a mapping")
+		}
+	}
+
+	if err := migrateDocument(doc); err != nil {
+		return nil, err
+	}
+
+	var result = new(Construction)
+	if isJSON {
+		b, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		dec := json.NewDecoder(bytes.NewReader(b))
+		if strict {
+			dec.DisallowUnknownFields()
+		}
+		err = dec.Decode(result)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		b, err := yaml.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		if strict {
+			err = yaml.UnmarshalStrict(b, result)
+		} else {
+			err = yaml.Unmarshal(b, result)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// migrateDocument は形式バージョンを確認し、古い形式であれば現在の形式に変換する
+func migrateDocument(doc map[string]interface{}) error {
+	version := 1
+	if v, ok := doc["format_version"]; ok {
+		switch n := v.(type) {
+		case int:
+			version = n
+		case float64:
+			version = int(n)
+		default:
+			return fmt.Errorf("invalid format_version %v", v)
+		}
+	}
+
+	if version < 1 || version > CurrentFormatVersion {
+		return fmt.Errorf("unsupported format_version %d (supported up to %d)", version, CurrentFormatVersion)
+	}
+
+	for ; version < CurrentFormatVersion; version++ {
+		if err := formatMigrations[version-1](doc); err != nil {
+			return fmt.Errorf("failed to migrate format_version %d: %v", version, err)
+		}
+	}
+	doc["format_version"] = CurrentFormatVersion
+
+	return nil
+}
+
+// normalizeDocument はYAMLのマップのキーを文字列に揃える
+func normalizeDocument(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for k, val := range x {
+			m[fmt.Sprint(k)] = normalizeDocument(val)
+		}
+		return m
+	case map[string]interface{}:
+		for k, val := range x {
+			x[k] = normalizeDocument(val)
+		}
+		return x
+	case []interface{}:
+		for i, val := range x {
+			x[i] = normalizeDocument(val)
+		}
+		return x
+	default:
+		return v
+	}
+}
+
+func eachTableDocument(doc map[string]interface{}, f func(table map[string]interface{})) error {
+	tables, ok := doc["tables"]
+	if !ok || tables == nil {
+		return nil
+	}
+	list, ok := tables.([]interface{})
+	if !ok {
+		return fmt.Errorf("tables must be a list")
+	}
+	for _, t := range list {
+		if table, ok := t.(map[string]interface{}); ok {
+			f(table)
+		}
+	}
+	return nil
+}
+
+// fillRelationSources は source のないリレーションに、参照先テーブルへの外部キーがあれば fk、なければ ex_info を設定する
+// バージョン1では外部キーのリレーションに ex_info の設定を追加していたため、参照先テーブルで判断する
+func fillRelationSources(table map[string]interface{}) {
+	fkTables := map[interface{}]bool{}
+	if fks, ok := table["foreign_keys"].([]interface{}); ok {
+		for _, fk := range fks {
+			if m, ok := fk.(map[string]interface{}); ok {
+				fkTables[m["referenced_table_name"]] = true
+			}
+		}
+	}
+	relations, ok := table["ex_relations"].([]interface{})
+	if !ok {
+		return
+	}
+	for _, r := range relations {
+		relation, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, exists := relation["source"]; exists {
+			continue
+		}
+		relation["source"] = RelationSourceExInfo
+		if fkTables[relation["referenced_table_name"]] {
+			relation["source"] = RelationSourceForeignKey
+		}
+	}
+}
+
+func renameDocumentKey(m map[string]interface{}, from, to string) {
+	if v, ok := m[from]; ok {
+		if _, exists := m[to]; !exists {
+			m[to] = v
+		}
+		delete(m, from)
+	}
+}
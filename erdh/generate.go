@@ -0,0 +1,210 @@
+package erdh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/iwot/erdh-go/config"
+)
+
+// Options は Load, Generate の設定
+type Options struct {
+	// Sources は最初の読み込み元の後に読み、マージする読み込み元
+	Sources []config.SourceConfig
+	// MergePolicy はテーブル名が衝突した場合の扱い
+	MergePolicy string
+	// Password はDBの読み込み元で用いるパスワード（DBConfig のパスワードより優先する）
+	Password string
+	// ExInfo は適用する ex_info
+	ExInfo *config.ExtraConfig
+	// ExInfoFiles は読み込んで適用する ex_info ファイル（ExInfo が指定されていれば用いない）
+	ExInfoFiles config.PathList
+	// ExInfoValidation は ex_info の検証で問題が見つかった場合の扱い（ValidationWarn または ValidationFail）
+	ExInfoValidation string
+	// Puml は出力の設定
+	Puml PumlOptions
+	// Format は出力に用いる Writer の名前。省略時は FormatPuml
+	Format string
+	// Output は出力先
+	Output io.Writer
+	// Log は読み込み元や警告の出力先。省略時は出力しない
+	Log io.Writer
+}
+
+// Option は Options を変更する関数
+type Option func(*Options)
+
+// WithConfig は設定ファイルの内容（2つ目以降の読み込み元、merge_policy、group、ex_info、ex_info_validation、theme）を適用する
+// 最初の読み込み元は Load, Generate の引数に conf.GetSources()[0] を渡す
+func WithConfig(conf *config.Config) Option {
+	return func(o *Options) {
+		sources := conf.GetSources()
+		o.Sources = append([]config.SourceConfig{}, sources[1:]...)
+		o.MergePolicy = conf.MergePolicy
+		o.ExInfoFiles = conf.ExInfo
+		o.ExInfoValidation = conf.ExInfoValidation
+		o.Puml = NewPumlOptions(conf)
+	}
+}
+
+// WithSources は最初の読み込み元の後に読む読み込み元を追加する
+func WithSources(sources ...config.SourceConfig) Option {
+	return func(o *Options) {
+		o.Sources = append(o.Sources, sources...)
+	}
+}
+
+// WithMergePolicy はテーブル名が衝突した場合の扱いを指定する
+func WithMergePolicy(policy string) Option {
+	return func(o *Options) {
+		o.MergePolicy = policy
+	}
+}
+
+// WithPassword はDBの読み込み元で用いるパスワードを指定する
+func WithPassword(password string) Option {
+	return func(o *Options) {
+		o.Password = password
+	}
+}
+
+// WithExInfo は適用する ex_info を指定する
+func WithExInfo(exInfo *config.ExtraConfig) Option {
+	return func(o *Options) {
+		o.ExInfo = exInfo
+	}
+}
+
+// WithExInfoFiles は読み込んで適用する ex_info ファイルを指定する
+func WithExInfoFiles(patterns config.PathList) Option {
+	return func(o *Options) {
+		o.ExInfoFiles = patterns
+	}
+}
+
+// WithExInfoValidation は ex_info の検証で問題が見つかった場合の扱いを指定する
+func WithExInfoValidation(mode string) Option {
+	return func(o *Options) {
+		o.ExInfoValidation = mode
+	}
+}
+
+// WithPumlOptions はPlantUML形式の出力の設定を指定する
+func WithPumlOptions(puml PumlOptions) Option {
+	return func(o *Options) {
+		o.Puml = puml
+	}
+}
+
+// WithFormat は出力に用いる Writer の名前を指定する
+func WithFormat(format string) Option {
+	return func(o *Options) {
+		o.Format = format
+	}
+}
+
+// WithOutput は出力先を指定する
+func WithOutput(w io.Writer) Option {
+	return func(o *Options) {
+		o.Output = w
+	}
+}
+
+// WithLog は読み込み元や警告の出力先を指定する
+func WithLog(w io.Writer) Option {
+	return func(o *Options) {
+		o.Log = w
+	}
+}
+
+func newOptions(opts []Option) Options {
+	o := Options{Log: ioutil.Discard}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.Log == nil {
+		o.Log = ioutil.Discard
+	}
+	return o
+}
+
+// Load は source と Options.Sources を読んでマージし、ex_info を検証して適用したConstructionを返す
+// ex_info の検証で問題が見つかった場合、ValidationFail であれば ValidationError を返し、それ以外は Log に警告を出力する
+func Load(ctx context.Context, source config.SourceConfig, opts ...Option) (*Construction, error) {
+	o := newOptions(opts)
+	if !IsValidValidationMode(o.ExInfoValidation) {
+		return nil, fmt.Errorf("invalid ex_info_validation %q (%s or %s)", o.ExInfoValidation, ValidationWarn, ValidationFail)
+	}
+
+	cons := &Construction{}
+	for _, src := range append([]config.SourceConfig{source}, o.Sources...) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		fmt.Fprintln(o.Log, "source from", src.SourceFrom)
+		if len(o.Password) > 0 {
+			src.Password = o.Password
+		}
+		srcCons, err := ReadSource(ctx, src)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", src.SourceFrom, err)
+		}
+		err = cons.Merge(srcCons, o.MergePolicy, src.Prefix)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	exInfo := o.ExInfo
+	if exInfo == nil {
+		var err error
+		exInfo, err = config.NewExtraConfigFromYamlFiles(o.ExInfoFiles)
+		if err != nil {
+			return nil, fmt.Errorf("read ex_info: %w", err)
+		}
+	}
+
+	cons.UpdateExRelationsFromForeignKeys()
+
+	issues := cons.ValidateExInfo(*exInfo, o.Puml.Groups)
+	if len(issues) > 0 {
+		if o.ExInfoValidation == ValidationFail {
+			return nil, ValidationError{Issues: issues}
+		}
+		for _, issue := range issues {
+			fmt.Fprintln(o.Log, "warning:", issue)
+		}
+	}
+
+	cons.ApplyExInfo(*exInfo)
+	return cons, nil
+}
+
+// Generate は Load したConstructionを Options.Format の Writer で Options.Output に出力し、そのConstructionを返す
+func Generate(ctx context.Context, source config.SourceConfig, opts ...Option) (*Construction, error) {
+	o := newOptions(opts)
+	if o.Output == nil {
+		return nil, errors.New("output is not specified")
+	}
+	format := o.Format
+	if len(format) == 0 {
+		format = FormatPuml
+	}
+	writer, ok := LookupWriter(format)
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q (registered: %s)", format, strings.Join(Writers(), ", "))
+	}
+
+	cons, err := Load(ctx, source, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := writer.Write(ctx, o.Output, cons, o.Puml); err != nil {
+		return cons, err
+	}
+	return cons, nil
+}
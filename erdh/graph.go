@@ -0,0 +1,25 @@
+package erdh
+
+import "github.com/iwot/erdh-go/erdh/graph"
+
+// Graph はテーブルをノード、外部キーと ExRelation を参照元から参照先への辺とするグラフを返す
+// 存在しないテーブルへのリレーションは含めない
+func (c *Construction) Graph() *graph.Graph {
+	g := graph.New()
+	for _, t := range c.Tables {
+		g.AddNode(t.Name)
+	}
+	for _, t := range c.Tables {
+		for _, fk := range t.ForeginKeys {
+			if g.HasNode(fk.ReferencedTableName) {
+				g.AddEdge(t.Name, fk.ReferencedTableName)
+			}
+		}
+		for _, exr := range t.ExRelations {
+			if g.HasNode(exr.ReferencedTableName) {
+				g.AddEdge(t.Name, exr.ReferencedTableName)
+			}
+		}
+	}
+	return g
+}
@@ -0,0 +1,107 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// AnalyzeOptions は Analyze の設定
+type AnalyzeOptions struct {
+	// Hubs は出力する参照元の多いノードの最大数。0 であればすべて出力する
+	Hubs int
+	// MaxCycles は出力する循環の最大数。0 であればすべて出力する
+	MaxCycles int
+}
+
+// Analysis はグラフを分析した結果
+type Analysis struct {
+	Tables    int `json:"tables"`
+	Relations int `json:"relations"`
+	// Isolated は他のテーブルとのリレーションがないテーブル
+	Isolated []string `json:"isolated"`
+	// Cycles はリレーションの循環（自己参照を含む）
+	Cycles [][]string `json:"cycles"`
+	// CyclesTruncated は MaxCycles を超えたため出力していない循環があればtrue
+	CyclesTruncated bool `json:"cycles_truncated"`
+	// Hubs は参照元の多いテーブル
+	Hubs []Hub `json:"hubs"`
+	// Components は複数のテーブルからなる強連結成分
+	Components [][]string `json:"components"`
+	// LoadOrder は参照先が先になるテーブルの順。循環するテーブルはひとつの組とする
+	LoadOrder [][]string `json:"load_order"`
+}
+
+// Analyze はグラフの孤立したノード、循環、参照元の多いノード、強連結成分、トポロジカル順序を求める
+// 件数の上限は Graph.Hubs, Graph.Cycles と同じく0以下であれば上限なしとする
+func Analyze(g *Graph, opts AnalyzeOptions) Analysis {
+	a := Analysis{
+		Tables:     len(g.nodes),
+		Relations:  g.EdgeCount(),
+		Isolated:   g.Isolated(),
+		Hubs:       g.Hubs(opts.Hubs),
+		Components: [][]string{},
+		LoadOrder:  g.TopologicalOrder(),
+	}
+	if opts.MaxCycles > 0 {
+		// 上限を超える循環があるかを知るため、ひとつ多く求める
+		a.Cycles = g.Cycles(opts.MaxCycles + 1)
+		if len(a.Cycles) > opts.MaxCycles {
+			a.Cycles = a.Cycles[:opts.MaxCycles]
+			a.CyclesTruncated = true
+		}
+	} else {
+		a.Cycles = g.Cycles(0)
+	}
+	for _, c := range g.StronglyConnectedComponents() {
+		if len(c) > 1 {
+			a.Components = append(a.Components, c)
+		}
+	}
+	return a
+}
+
+// WriteText は分析結果をテキストで書き込む
+func (a Analysis) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d tables, %d relations\n", a.Tables, a.Relations)
+
+	fmt.Fprintf(&b, "\nisolated tables (%d):\n", len(a.Isolated))
+	for _, name := range a.Isolated {
+		fmt.Fprintf(&b, "  %s\n", name)
+	}
+
+	fmt.Fprintf(&b, "\ncycles (%d):\n", len(a.Cycles))
+	for _, c := range a.Cycles {
+		fmt.Fprintf(&b, "  %s -> %s\n", strings.Join(c, " -> "), c[0])
+	}
+	if a.CyclesTruncated {
+		fmt.Fprintf(&b, "  (only the first %d cycles are shown)\n", len(a.Cycles))
+	}
+
+	fmt.Fprintf(&b, "\nhubs:\n")
+	for _, h := range a.Hubs {
+		fmt.Fprintf(&b, "  %s (referenced by %d tables)\n", h.Name, h.ReferencedBy)
+	}
+
+	fmt.Fprintf(&b, "\nstrongly connected components (%d):\n", len(a.Components))
+	for _, c := range a.Components {
+		fmt.Fprintf(&b, "  %s\n", strings.Join(c, ", "))
+	}
+
+	fmt.Fprintf(&b, "\nload order:\n")
+	for i, c := range a.LoadOrder {
+		fmt.Fprintf(&b, "  %d. %s\n", i+1, strings.Join(c, ", "))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON は分析結果をJSONとして書き込む
+func (a Analysis) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(&a)
+}
@@ -0,0 +1,307 @@
+package graph
+
+import (
+	"sort"
+	"strings"
+)
+
+// Graph はテーブルをノード、リレーションを参照元から参照先への辺とする有向グラフ
+// ノードと辺は追加した順に保持し、同じ辺は一度だけ追加する
+type Graph struct {
+	nodes []string
+	index map[string]int
+	out   [][]int
+	in    [][]int
+	edges map[[2]int]bool
+}
+
+// New は空のグラフを返す
+func New() *Graph {
+	return &Graph{index: map[string]int{}, edges: map[[2]int]bool{}}
+}
+
+// AddNode はノードを追加する。すでにあれば何もしない
+func (g *Graph) AddNode(name string) {
+	g.node(name)
+}
+
+func (g *Graph) node(name string) int {
+	if i, ok := g.index[name]; ok {
+		return i
+	}
+	g.index[name] = len(g.nodes)
+	g.nodes = append(g.nodes, name)
+	g.out = append(g.out, nil)
+	g.in = append(g.in, nil)
+	return len(g.nodes) - 1
+}
+
+// AddEdge は from から to への辺を追加する。ノードがなければ追加する
+func (g *Graph) AddEdge(from, to string) {
+	f, t := g.node(from), g.node(to)
+	key := [2]int{f, t}
+	if g.edges[key] {
+		return
+	}
+	g.edges[key] = true
+	g.out[f] = append(g.out[f], t)
+	g.in[t] = append(g.in[t], f)
+}
+
+// HasNode はノードがあればtrueを返す
+func (g *Graph) HasNode(name string) bool {
+	_, ok := g.index[name]
+	return ok
+}
+
+// Nodes はノードを追加した順に返す
+func (g *Graph) Nodes() []string {
+	return append([]string{}, g.nodes...)
+}
+
+// EdgeCount は辺の数を返す
+func (g *Graph) EdgeCount() int {
+	return len(g.edges)
+}
+
+// Successors は name から辺の向かうノード（参照先）を返す
+func (g *Graph) Successors(name string) []string {
+	i, ok := g.index[name]
+	if !ok {
+		return nil
+	}
+	return g.names(g.out[i])
+}
+
+// Predecessors は name へ辺の向かうノード（参照元）を返す
+func (g *Graph) Predecessors(name string) []string {
+	i, ok := g.index[name]
+	if !ok {
+		return nil
+	}
+	return g.names(g.in[i])
+}
+
+func (g *Graph) names(indexes []int) []string {
+	result := []string{}
+	for _, i := range indexes {
+		result = append(result, g.nodes[i])
+	}
+	return result
+}
+
+// Isolated は自身以外のノードとの辺がないノードを名前順に返す
+func (g *Graph) Isolated() []string {
+	result := []string{}
+	for i, name := range g.nodes {
+		if len(g.others(g.out[i], i)) == 0 && len(g.others(g.in[i], i)) == 0 {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// others は indexes から self を除いたものを返す
+func (g *Graph) others(indexes []int, self int) []int {
+	result := []int{}
+	for _, i := range indexes {
+		if i != self {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// Hub は多くのノードから参照されているノード
+type Hub struct {
+	Name string `json:"name"`
+	// ReferencedBy は参照元のノードの数（自身を除く）
+	ReferencedBy int `json:"referenced_by"`
+}
+
+// Hubs は参照元の多いノードを多い順（同数であれば名前順）に最大 n 個返す。n が0以下であればすべて返す
+// 参照元のないノードは含めない
+func (g *Graph) Hubs(n int) []Hub {
+	result := []Hub{}
+	for i, name := range g.nodes {
+		if count := len(g.others(g.in[i], i)); count > 0 {
+			result = append(result, Hub{Name: name, ReferencedBy: count})
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].ReferencedBy != result[j].ReferencedBy {
+			return result[i].ReferencedBy > result[j].ReferencedBy
+		}
+		return result[i].Name < result[j].Name
+	})
+	if n > 0 && len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+// StronglyConnectedComponents は強連結成分をTarjanのアルゴリズムで求め、それぞれ名前順にして返す
+// 成分は参照先の成分が先になる順（辺をたどって到達できる成分が先）に並ぶ
+func (g *Graph) StronglyConnectedComponents() [][]string {
+	result := [][]string{}
+	for _, c := range g.components() {
+		names := g.names(c)
+		sort.Strings(names)
+		result = append(result, names)
+	}
+	return result
+}
+
+func (g *Graph) components() [][]int {
+	index := make([]int, len(g.nodes))
+	lowlink := make([]int, len(g.nodes))
+	onStack := make([]bool, len(g.nodes))
+	for i := range index {
+		index[i] = -1
+	}
+	stack := []int{}
+	next := 0
+	result := [][]int{}
+
+	var visit func(v int)
+	visit = func(v int) {
+		index[v], lowlink[v] = next, next
+		next++
+		stack = append(stack, v)
+		onStack[v] = true
+
+		for _, w := range g.out[v] {
+			if index[w] < 0 {
+				visit(w)
+				if lowlink[w] < lowlink[v] {
+					lowlink[v] = lowlink[w]
+				}
+			} else if onStack[w] && index[w] < lowlink[v] {
+				lowlink[v] = index[w]
+			}
+		}
+
+		if lowlink[v] == index[v] {
+			component := []int{}
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				component = append(component, w)
+				if w == v {
+					break
+				}
+			}
+			result = append(result, component)
+		}
+	}
+	for v := range g.nodes {
+		if index[v] < 0 {
+			visit(v)
+		}
+	}
+	return result
+}
+
+// Cycles はリレーションの循環（自己参照を含む）を、名前の最も小さいノードから始まる経路として名前順に返す
+// 循環は強連結成分の中で列挙し、limit が0より大きければ最大 limit 個とする
+func (g *Graph) Cycles(limit int) [][]string {
+	result := [][]string{}
+	for _, c := range g.components() {
+		inComponent := map[int]bool{}
+		for _, v := range c {
+			inComponent[v] = true
+		}
+		// 始点より後に追加したノードだけをたどることで、同じ循環を一度だけ見つける
+		sort.Ints(c)
+		for _, start := range c {
+			path := []int{start}
+			visited := map[int]bool{start: true}
+			var walk func(v int)
+			walk = func(v int) {
+				for _, w := range g.out[v] {
+					if limit > 0 && len(result) >= limit {
+						return
+					}
+					if w == start {
+						result = append(result, g.rotate(g.names(path)))
+						continue
+					}
+					if !inComponent[w] || w < start || visited[w] {
+						continue
+					}
+					visited[w] = true
+					path = append(path, w)
+					walk(w)
+					path = path[:len(path)-1]
+					visited[w] = false
+				}
+			}
+			walk(start)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return strings.Join(result[i], "\x00") < strings.Join(result[j], "\x00")
+	})
+	return result
+}
+
+// rotate は循環の経路を名前の最も小さいノードから始まるように回転する
+func (g *Graph) rotate(cycle []string) []string {
+	min := 0
+	for i, name := range cycle {
+		if name < cycle[min] {
+			min = i
+		}
+	}
+	return append(append([]string{}, cycle[min:]...), cycle[:min]...)
+}
+
+// TopologicalOrder は参照先が参照元より先になるノードの順を返す（データを投入する順など）
+// 循環するノードはひとつの組（名前順）とし、同時に投入できる組は名前順に並べる
+func (g *Graph) TopologicalOrder() [][]string {
+	components := g.StronglyConnectedComponents()
+	componentOf := map[string]int{}
+	for i, c := range components {
+		for _, name := range c {
+			componentOf[name] = i
+		}
+	}
+
+	// 組ごとに、まだ並べていない参照先の組の数を数える
+	waiting := make([]map[int]bool, len(components))
+	referencedBy := make([]map[int]bool, len(components))
+	for i := range components {
+		waiting[i] = map[int]bool{}
+		referencedBy[i] = map[int]bool{}
+	}
+	for key := range g.edges {
+		from, to := componentOf[g.nodes[key[0]]], componentOf[g.nodes[key[1]]]
+		if from != to {
+			waiting[from][to] = true
+			referencedBy[to][from] = true
+		}
+	}
+
+	ready := []int{}
+	for i := range components {
+		if len(waiting[i]) == 0 {
+			ready = append(ready, i)
+		}
+	}
+	result := [][]string{}
+	for len(ready) > 0 {
+		sort.SliceStable(ready, func(i, j int) bool { return components[ready[i]][0] < components[ready[j]][0] })
+		c := ready[0]
+		ready = ready[1:]
+		result = append(result, components[c])
+		for from := range referencedBy[c] {
+			delete(waiting[from], c)
+			if len(waiting[from]) == 0 {
+				ready = append(ready, from)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,151 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestGraph は以下のグラフを返す
+//   - orders -> members, orders -> items, items -> categories, categories -> categories（自己参照）
+//   - a -> b -> c -> a, b -> a（循環）
+//   - logs（孤立）
+func newTestGraph() *Graph {
+	g := New()
+	for _, name := range []string{"members", "items", "categories", "orders", "logs", "a", "b", "c"} {
+		g.AddNode(name)
+	}
+	g.AddEdge("orders", "members")
+	g.AddEdge("orders", "items")
+	g.AddEdge("orders", "items")
+	g.AddEdge("items", "categories")
+	g.AddEdge("categories", "categories")
+	g.AddEdge("a", "b")
+	g.AddEdge("b", "c")
+	g.AddEdge("c", "a")
+	g.AddEdge("b", "a")
+	g.AddEdge("c", "members")
+	return g
+}
+
+func TestGraph(t *testing.T) {
+	g := newTestGraph()
+	if g.EdgeCount() != 9 {
+		t.Fatalf("failed test EdgeCount %d", g.EdgeCount())
+	}
+	if !reflect.DeepEqual(g.Successors("orders"), []string{"members", "items"}) {
+		t.Fatalf("failed test Successors %#v", g.Successors("orders"))
+	}
+	if !reflect.DeepEqual(g.Predecessors("members"), []string{"orders", "c"}) {
+		t.Fatalf("failed test Predecessors %#v", g.Predecessors("members"))
+	}
+	if g.Successors("unknown") != nil {
+		t.Fatalf("failed test Successors unknown")
+	}
+	if !reflect.DeepEqual(g.Isolated(), []string{"logs"}) {
+		t.Fatalf("failed test Isolated %#v", g.Isolated())
+	}
+
+	hubs := g.Hubs(2)
+	expectedHubs := []Hub{{Name: "a", ReferencedBy: 2}, {Name: "members", ReferencedBy: 2}}
+	if !reflect.DeepEqual(hubs, expectedHubs) {
+		t.Fatalf("failed test Hubs %#v", hubs)
+	}
+	if len(g.Hubs(0)) != 6 {
+		t.Fatalf("failed test Hubs all %#v", g.Hubs(0))
+	}
+}
+
+func TestGraphComponentsAndCycles(t *testing.T) {
+	g := newTestGraph()
+
+	components := g.StronglyConnectedComponents()
+	if len(components) != 6 {
+		t.Fatalf("failed test StronglyConnectedComponents %#v", components)
+	}
+	// 参照先の成分が先になる
+	position := map[string]int{}
+	for i, c := range components {
+		for _, name := range c {
+			position[name] = i
+		}
+	}
+	if !reflect.DeepEqual(components[position["a"]], []string{"a", "b", "c"}) {
+		t.Fatalf("failed test StronglyConnectedComponents cycle %#v", components)
+	}
+	if position["members"] > position["orders"] || position["categories"] > position["items"] || position["members"] > position["a"] {
+		t.Fatalf("failed test StronglyConnectedComponents order %#v", components)
+	}
+
+	expectedCycles := [][]string{{"a", "b"}, {"a", "b", "c"}, {"categories"}}
+	if cycles := g.Cycles(0); !reflect.DeepEqual(cycles, expectedCycles) {
+		t.Fatalf("failed test Cycles %#v", cycles)
+	}
+	if cycles := g.Cycles(1); len(cycles) != 1 {
+		t.Fatalf("failed test Cycles limit %#v", cycles)
+	}
+
+	expectedOrder := [][]string{{"categories"}, {"items"}, {"logs"}, {"members"}, {"a", "b", "c"}, {"orders"}}
+	if order := g.TopologicalOrder(); !reflect.DeepEqual(order, expectedOrder) {
+		t.Fatalf("failed test TopologicalOrder %#v", order)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	a := Analyze(newTestGraph(), AnalyzeOptions{Hubs: 1})
+	if a.Tables != 8 || a.Relations != 9 || len(a.Hubs) != 1 || len(a.Cycles) != 3 ||
+		!reflect.DeepEqual(a.Components, [][]string{{"a", "b", "c"}}) {
+		t.Fatalf("failed test Analyze %#v", a)
+	}
+
+	var buf bytes.Buffer
+	if err := a.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"8 tables, 9 relations\n",
+		"isolated tables (1):\n  logs\n",
+		"  a -> b -> c -> a\n",
+		"  categories -> categories\n",
+		"  a (referenced by 2 tables)\n",
+		"strongly connected components (1):\n  a, b, c\n",
+		"  5. a, b, c\n  6. orders\n",
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Fatalf("failed test WriteText %q\n%s", line, buf.String())
+		}
+	}
+
+	// 上限を超える循環がある場合はその旨を出力する
+	a = Analyze(newTestGraph(), AnalyzeOptions{MaxCycles: 2})
+	if len(a.Cycles) != 2 || !a.CyclesTruncated || len(a.Hubs) != 6 {
+		t.Fatalf("failed test Analyze max cycles %#v", a)
+	}
+	buf.Reset()
+	if err := a.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "cycles (2):\n  a -> b -> a\n  a -> b -> c -> a\n  (only the first 2 cycles are shown)\n") {
+		t.Fatalf("failed test WriteText truncated\n%s", buf.String())
+	}
+	if a = Analyze(newTestGraph(), AnalyzeOptions{MaxCycles: 3}); a.CyclesTruncated {
+		t.Fatalf("failed test Analyze max cycles not truncated %#v", a)
+	}
+
+	buf.Reset()
+	if err := Analyze(New(), AnalyzeOptions{}).WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	// 空のグラフでも配列はnullにしない
+	for _, key := range []string{"isolated", "cycles", "hubs", "components", "load_order"} {
+		if _, ok := decoded[key].([]interface{}); !ok {
+			t.Fatalf("failed test WriteJSON %s\n%s", key, buf.String())
+		}
+	}
+}
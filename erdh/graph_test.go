@@ -0,0 +1,26 @@
+package erdh
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConstructionGraph(t *testing.T) {
+	cons := &Construction{DBName: "shop"}
+	members := Table{Name: "members"}
+	orders := Table{Name: "orders"}
+	orders.AddForeginKey("fk_member", "member_id", "members", "id")
+	orders.AddForeginKey("fk_unknown", "shop_id", "shops", "id")
+	orders.ExRelations = append(orders.ExRelations, ExRelation{ReferencedTableName: "items"})
+	items := Table{Name: "items"}
+	cons.Tables = []Table{members, orders, items}
+
+	g := cons.Graph()
+	if !reflect.DeepEqual(g.Nodes(), []string{"members", "orders", "items"}) {
+		t.Fatalf("failed test Graph nodes %#v", g.Nodes())
+	}
+	// 存在しないテーブル shops へのリレーションは含めない
+	if !reflect.DeepEqual(g.Successors("orders"), []string{"members", "items"}) || g.EdgeCount() != 2 {
+		t.Fatalf("failed test Graph edges %#v", g.Successors("orders"))
+	}
+}
@@ -0,0 +1,82 @@
+package erdh
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// IntegrityResult はリレーションの参照整合性をデータで調べた結果
+type IntegrityResult struct {
+	Table           string             `json:"table"`
+	ReferencedTable string             `json:"referenced_table"`
+	Columns         []ExRelationColumn `json:"columns"`
+	Source          string             `json:"source,omitempty"`
+	// Rows は参照元テーブルの行数
+	Rows int `json:"rows"`
+	// Orphans は参照元のカラムがNULLでなく、参照先に対応する行のない行数
+	Orphans int `json:"orphans"`
+	// Samples は参照先のない参照元の値（Columns の順）の例
+	Samples [][]string `json:"samples,omitempty"`
+}
+
+func (r IntegrityResult) String() string {
+	cols := []string{}
+	for _, col := range r.Columns {
+		cols = append(cols, col.From+"="+col.To)
+	}
+	return fmt.Sprintf("%s -> %s (%s): %d of %d rows have no %s row",
+		r.Table, r.ReferencedTable, strings.Join(cols, ", "), r.Orphans, r.Rows, r.ReferencedTable)
+}
+
+// IntegrityReport は参照整合性の検査結果をまとめたもの
+type IntegrityReport struct {
+	DBName string `json:"db_name"`
+	// Checked は調べたリレーションの数
+	Checked int `json:"checked"`
+	// Violations は参照先のない行があったリレーションの数
+	Violations int `json:"violations"`
+	// Results は参照先のない行があったリレーションの結果
+	Results []IntegrityResult `json:"results"`
+}
+
+// NewIntegrityReport は results のうち参照先のない行があったものをまとめる
+func NewIntegrityReport(dbName string, results []IntegrityResult) IntegrityReport {
+	report := IntegrityReport{DBName: dbName, Checked: len(results), Results: []IntegrityResult{}}
+	for _, r := range results {
+		if r.Orphans > 0 {
+			report.Results = append(report.Results, r)
+		}
+	}
+	report.Violations = len(report.Results)
+	return report
+}
+
+// WriteText はリレーションごとに参照先のない行数と値の例を書き込む
+func (r IntegrityReport) WriteText(w io.Writer) error {
+	for _, result := range r.Results {
+		if _, err := fmt.Fprintln(w, result); err != nil {
+			return err
+		}
+		for _, sample := range result.Samples {
+			values := []string{}
+			for i, col := range result.Columns {
+				if i < len(sample) {
+					values = append(values, col.From+"="+sample[i])
+				}
+			}
+			if _, err := fmt.Fprintln(w, "  "+strings.Join(values, ", ")); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteJSON は検査結果をJSONとして書き込む
+func (r IntegrityReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(&r)
+}
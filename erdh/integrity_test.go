@@ -0,0 +1,61 @@
+package erdh
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestIntegrityReport(t *testing.T) {
+	report := NewIntegrityReport("shop", []IntegrityResult{
+		{
+			Table:           "sales",
+			ReferencedTable: "prices",
+			Columns:         []ExRelationColumn{{From: "shop_id", To: "shop_id"}, {From: "item_code", To: "item_code"}},
+			Source:          RelationSourceExInfo,
+			Rows:            5,
+			Orphans:         2,
+			Samples:         [][]string{{"1", "c"}, {"2", "a"}},
+		},
+		{
+			Table:           "sales",
+			ReferencedTable: "members",
+			Columns:         []ExRelationColumn{{From: "member_id", To: "id"}},
+			Rows:            5,
+		},
+	})
+	if report.Checked != 2 || report.Violations != 1 || len(report.Results) != 1 {
+		t.Fatalf("failed test NewIntegrityReport %#v", report)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := "sales -> prices (shop_id=shop_id, item_code=item_code): 2 of 5 rows have no prices row\n" +
+		"  shop_id=1, item_code=c\n" +
+		"  shop_id=2, item_code=a\n"
+	if buf.String() != expected {
+		t.Fatalf("failed test WriteText\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := report.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded IntegrityReport
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.DBName != "shop" || decoded.Violations != 1 || decoded.Results[0].Samples[1][0] != "2" {
+		t.Fatalf("failed test WriteJSON %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := NewIntegrityReport("shop", nil).WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(`"results": []`)) {
+		t.Fatalf("failed test WriteJSON empty %s", buf.String())
+	}
+}
@@ -0,0 +1,80 @@
+package erdh
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// IsJSONPath は中間形式ファイルのパスがJSON形式を示していればtrueを返す
+func IsJSONPath(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".json"
+}
+
+// NewConstructionFromJSONFile は与えられたJSONファイルパスからConstructionを生成して返す
+func NewConstructionFromJSONFile(path string) (*Construction, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewConstructionFromJSON(buf)
+}
+
+// NewConstructionFromJSON は与えられたJSON文字列からConstructionを生成して返す
+func NewConstructionFromJSON(buf []byte) (*Construction, error) {
+	return decodeConstruction(buf, true, false)
+}
+
+// NewConstructionFromFile は拡張子（.json またはそれ以外はYAML）に従って中間形式ファイルを読む
+func NewConstructionFromFile(path string) (*Construction, error) {
+	if IsJSONPath(path) {
+		return NewConstructionFromJSONFile(path)
+	}
+	return NewConstructionFromYamlFile(path)
+}
+
+// WriteYaml はConstructionを現在の形式バージョンのYAML形式でio.Writerに書き込む
+func (c *Construction) WriteYaml(w io.Writer) error {
+	out := *c
+	out.FormatVersion = CurrentFormatVersion
+	d, err := yaml.Marshal(&out)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(d)
+	return err
+}
+
+// WriteJSON はConstructionを現在の形式バージョンのJSON形式でio.Writerに書き込む
+func (c *Construction) WriteJSON(w io.Writer) error {
+	out := *c
+	out.FormatVersion = CurrentFormatVersion
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(&out)
+}
+
+// SaveToFile は拡張子（.json またはそれ以外はYAML）に従って中間形式ファイルを保存する
+func (c *Construction) SaveToFile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if IsJSONPath(path) {
+		err = c.WriteJSON(file)
+	} else {
+		err = c.WriteYaml(file)
+	}
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,160 @@
+package erdh
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestConstructionJSONRoundTrip(t *testing.T) {
+	cons := newPumlTestConstruction()
+
+	dir, err := ioutil.TempDir("", "erdh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"im.json", "im.yaml"} {
+		path := filepath.Join(dir, name)
+		if err := cons.SaveToFile(path); err != nil {
+			t.Fatalf("failed test SaveToFile %#v", err)
+		}
+		loaded, err := NewConstructionFromFile(path)
+		if err != nil {
+			t.Fatalf("failed test NewConstructionFromFile %#v", err)
+		}
+		var expected, actual bytes.Buffer
+		cons.WriteJSON(&expected)
+		loaded.WriteJSON(&actual)
+		if !strings.Contains(expected.String(), `"ex_relations": [`) {
+			t.Fatalf("failed test json field names\n%s", expected.String())
+		}
+		if !bytes.Equal(bytes.Replace(expected.Bytes(), []byte("null"), []byte("[]"), -1), bytes.Replace(actual.Bytes(), []byte("null"), []byte("[]"), -1)) {
+			t.Fatalf("failed test round trip of %s\n%s\n%s", name, expected.String(), actual.String())
+		}
+	}
+}
+
+// jsonFieldNames は構造体のJSONフィールド名を返す
+func jsonFieldNames(typ reflect.Type) []string {
+	result := []string{}
+	for i := 0; i < typ.NumField(); i++ {
+		name := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+		if len(name) > 0 && name != "-" {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestConstructionJSONSchema(t *testing.T) {
+	buf, err := ioutil.ReadFile(filepath.Join("..", "schema", "construction.schema.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type schemaObject struct {
+		Properties map[string]interface{} `json:"properties"`
+	}
+	var schema struct {
+		schemaObject
+		Definitions map[string]schemaObject `json:"definitions"`
+	}
+	if err := json.Unmarshal(buf, &schema); err != nil {
+		t.Fatalf("failed test schema is not valid JSON %#v", err)
+	}
+
+	propertyNames := func(obj schemaObject) []string {
+		result := []string{}
+		for name := range obj.Properties {
+			result = append(result, name)
+		}
+		sort.Strings(result)
+		return result
+	}
+
+	// スキーマの定義が構造体のフィールドと一致していることを確認する
+	if names := propertyNames(schema.schemaObject); !reflect.DeepEqual(names, jsonFieldNames(reflect.TypeOf(Construction{}))) {
+		t.Fatalf("failed test schema of Construction %#v", names)
+	}
+	for _, v := range []interface{}{Table{}, Column{}, Index{}, ForeginKey{}, ExRelation{}, ExRelationColumn{}} {
+		typ := reflect.TypeOf(v)
+		names := propertyNames(schema.Definitions[typ.Name()])
+		if !reflect.DeepEqual(names, jsonFieldNames(typ)) {
+			t.Fatalf("failed test schema of %s %#v", typ.Name(), names)
+		}
+	}
+}
+
+func TestConstructionFormatMigration(t *testing.T) {
+	v1 := []byte(`db_name: shop
+tables:
+- table: items
+  group: DATA
+  is-master: true
+  foreign_keys:
+  - constraint_name: fk_maker
+    column_name: maker_id
+    referenced_table_name: makers
+    referenced_column_name: id
+  ex-relations:
+  - referenced_table_name: item_types
+    this_conn: many
+    that_conn: onlyone
+  - referenced_table_name: makers
+    columns:
+    - from: maker_id
+      to: id
+    this_conn: one
+    that_conn: one
+`)
+	cons, err := NewConstructionFromYaml(v1)
+	if err != nil {
+		t.Fatalf("failed test load format_version 1 %#v", err)
+	}
+	if cons.FormatVersion != CurrentFormatVersion || !cons.Tables[0].IsMaster || len(cons.Tables[0].ExRelations) != 2 {
+		t.Fatalf("failed test migration %#v", cons)
+	}
+	// source のないリレーションは外部キーの有無で由来を補う
+	if exr := cons.Tables[0].ExRelations; exr[0].Source != RelationSourceExInfo || exr[1].Source != RelationSourceForeignKey {
+		t.Fatalf("failed test migration of relation sources %#v", exr)
+	}
+
+	v1JSON := []byte(`{"db_name": "shop", "tables": [{"table": "items", "is-master": true}]}`)
+	cons, err = NewConstructionFromJSON(v1JSON)
+	if err != nil || !cons.Tables[0].IsMaster {
+		t.Fatalf("failed test load format_version 1 json %#v", err)
+	}
+
+	if _, err := NewConstructionFromYaml([]byte("format_version: 99\n")); err == nil {
+		t.Fatalf("failed test newer format_version")
+	}
+
+	dir, err := ioutil.TempDir("", "erdh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	unknown := filepath.Join(dir, "unknown.yaml")
+	ioutil.WriteFile(unknown, []byte("format_version: 2\ntables:\n- table: items\n  colums: []\n"), 0644)
+	if _, err := NewConstructionFromFile(unknown); err != nil {
+		t.Fatalf("failed test lenient load %#v", err)
+	}
+	if _, err := NewConstructionFromFileStrict(unknown); err == nil {
+		t.Fatalf("failed test strict load")
+	}
+	old := filepath.Join(dir, "old.json")
+	ioutil.WriteFile(old, v1JSON, 0644)
+	if _, err := NewConstructionFromFileStrict(old); err != nil {
+		t.Fatalf("failed test strict load of format_version 1 %#v", err)
+	}
+}
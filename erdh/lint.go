@@ -0,0 +1,74 @@
+package erdh
+
+import (
+	"fmt"
+	"sort"
+)
+
+// LintIssue はスキーマの検査で見つかった問題
+type LintIssue struct {
+	Table   string
+	Message string
+}
+
+func (i LintIssue) String() string {
+	return fmt.Sprintf("table %s: %s", i.Table, i.Message)
+}
+
+// Lint はスキーマを検査し、設計上の問題をテーブル名順に返す
+//   - カラムのないテーブル（ex_info にのみ書かれたテーブルなど）
+//   - 主キーのないテーブル
+//   - インデックスの先頭にない外部キーのカラム
+//   - 存在しないテーブルへのリレーション
+func (c *Construction) Lint() []LintIssue {
+	issues := []LintIssue{}
+
+	tables := map[string]bool{}
+	for _, t := range c.Tables {
+		tables[t.Name] = true
+	}
+
+	sorted := make([]Table, len(c.Tables))
+	copy(sorted, c.Tables)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	for _, t := range sorted {
+		add := func(format string, args ...interface{}) {
+			issues = append(issues, LintIssue{Table: t.Name, Message: fmt.Sprintf(format, args...)})
+		}
+
+		if len(t.Columns) == 0 {
+			add("no columns")
+		} else if len(t.PrimaryKeyColumns()) == 0 {
+			add("no primary key")
+		}
+
+		indexed := map[string]bool{}
+		seenIndex := map[string]bool{}
+		for _, idx := range t.Indexes {
+			if !seenIndex[idx.Name] {
+				seenIndex[idx.Name] = true
+				indexed[idx.ColumnName] = true
+			}
+		}
+		if pk := t.PrimaryKeyColumns(); len(pk) > 0 {
+			indexed[pk[0]] = true
+		}
+		reported := map[string]bool{}
+		for _, fk := range t.ForeginKeys {
+			if len(fk.ReferencedTableName) == 0 || indexed[fk.ColumnName] || reported[fk.ColumnName] {
+				continue
+			}
+			reported[fk.ColumnName] = true
+			add("foreign key column %s is not indexed", fk.ColumnName)
+		}
+
+		for _, exr := range t.ExRelations {
+			if !tables[exr.ReferencedTableName] {
+				add("relation to unknown table %s", exr.ReferencedTableName)
+			}
+		}
+	}
+
+	return issues
+}
@@ -0,0 +1,40 @@
+package erdh
+
+import (
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	var cons = &Construction{}
+	items := Table{Name: "items", Group: "DATA"}
+	items.AddColumn("id", "int", "PRI", "", "", true, true)
+	memberItems := Table{Name: "member_items", Group: "DATA"}
+	memberItems.AddColumn("member_id", "int", "PRI", "", "", true, true)
+	memberItems.AddColumn("item_id", "int", "PRI", "", "", true, true)
+	memberItems.AddColumn("coupon_id", "int", "", "", "", false, false)
+	memberItems.AddForeginKey("fk_member", "member_id", "members", "id")
+	memberItems.AddForeginKey("fk_item", "item_id", "items", "id")
+	memberItems.AddForeginKey("fk_coupon", "coupon_id", "coupons", "id")
+	memberItems.AddIndex("idx_coupon", "coupon_id")
+	logs := Table{Name: "logs", Group: "LOG"}
+	logs.AddColumn("message", "text", "", "", "", false, false)
+	cons.Tables = []Table{memberItems, items, logs}
+	cons.UpdateExRelationsFromForeignKeys()
+	cons.GetTableMut("members")
+
+	expected := []string{
+		"table logs: no primary key",
+		"table member_items: foreign key column item_id is not indexed",
+		"table member_items: relation to unknown table coupons",
+		"table members: no columns",
+	}
+	issues := cons.Lint()
+	if len(issues) != len(expected) {
+		t.Fatalf("failed test Lint %#v", issues)
+	}
+	for i, issue := range issues {
+		if issue.String() != expected[i] {
+			t.Fatalf("failed test Lint[%d] %#v", i, issue.String())
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package erdh
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// WriteMarkdown はテーブル定義書をMarkdownとしてio.Writerに書き込む
+// グループ、テーブルの順に名前順で並べ、テーブルごとにカラムとリレーション（ラベル、役割名、線の種類を含む）の表を出力する
+// opts.Groups を指定した場合は、そのグループのテーブルを出力する
+func WriteMarkdown(w io.Writer, cons *Construction, opts PumlOptions) error {
+	groups := []string{}
+	byGroup := map[string][]Table{}
+	for _, tbl := range cons.Tables {
+		if len(opts.Groups) > 0 && !contains(opts.Groups, tbl.Group) {
+			continue
+		}
+		if _, ok := byGroup[tbl.Group]; !ok {
+			groups = append(groups, tbl.Group)
+		}
+		byGroup[tbl.Group] = append(byGroup[tbl.Group], tbl)
+	}
+	sort.Strings(groups)
+
+	var b strings.Builder
+	if len(cons.DBName) > 0 {
+		fmt.Fprintf(&b, "# %s\n", markdownText(cons.DBName))
+	}
+	for _, group := range groups {
+		fmt.Fprintf(&b, "\n## %s\n", markdownText(group))
+		tables := byGroup[group]
+		sort.SliceStable(tables, func(i, j int) bool { return tables[i].Name < tables[j].Name })
+		for _, tbl := range tables {
+			writeMarkdownTable(&b, tbl)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeMarkdownTable(b *strings.Builder, tbl Table) {
+	fmt.Fprintf(b, "\n### %s\n", markdownText(tbl.Name))
+	if len(tbl.Module) > 0 {
+		fmt.Fprintf(b, "\nvirtual table using %s\n", markdownText(tbl.Module))
+	}
+
+	fmt.Fprintln(b)
+	fmt.Fprintln(b, "| column | type | key | not null | default | extra |")
+	fmt.Fprintln(b, "| --- | --- | --- | --- | --- | --- |")
+	for _, c := range tbl.Columns {
+		notNull := ""
+		if c.NotNull {
+			notNull = "yes"
+		}
+		extra := c.Extra
+		if len(c.Generated) > 0 {
+			extra = strings.TrimSpace(extra + " " + c.Generated + " generated")
+		}
+		fmt.Fprintf(b, "| %s | %s | %s | %s | %s | %s |\n",
+			markdownCell(c.Name), markdownCell(c.ColumnType), markdownCell(c.Key), notNull, markdownCell(c.Default), markdownCell(extra))
+	}
+
+	if len(tbl.ExRelations) == 0 {
+		return
+	}
+	fmt.Fprintln(b)
+	fmt.Fprintln(b, "| referenced table | columns | this_conn | that_conn | label | this_role | that_role | style | source |")
+	fmt.Fprintln(b, "| --- | --- | --- | --- | --- | --- | --- | --- | --- |")
+	for _, exr := range tbl.ExRelations {
+		style := exr.Style
+		if len(style) == 0 {
+			style = RelationStyleSolid
+		}
+		// 外部キーの制約ごとにカラムの対応を「;」で区切る
+		groups := []string{}
+		for _, columns := range exr.ColumnGroups() {
+			pairs := []string{}
+			for _, col := range columns {
+				pairs = append(pairs, col.From+" -> "+col.To)
+			}
+			groups = append(groups, strings.Join(pairs, ", "))
+		}
+		fmt.Fprintf(b, "| %s | %s | %s | %s | %s | %s | %s | %s | %s |\n",
+			markdownCell(exr.ReferencedTableName), markdownCell(strings.Join(groups, "; ")),
+			markdownCell(exr.ThisConn), markdownCell(exr.ThatConn), markdownCell(exr.Label),
+			markdownCell(exr.ThisRole), markdownCell(exr.ThatRole), style, markdownCell(exr.Source))
+	}
+}
+
+// markdownText は見出しなどの1行のテキストとして使えるように s の改行を空白に置き換える
+func markdownText(s string) string {
+	s = strings.Replace(s, "\r", " ", -1)
+	return strings.Replace(s, "\n", " ", -1)
+}
+
+// markdownCell は表のセルとして使えるように s の「|」をエスケープし、改行を空白に置き換える
+func markdownCell(s string) string {
+	return strings.Replace(markdownText(s), "|", "\\|", -1)
+}
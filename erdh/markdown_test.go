@@ -0,0 +1,40 @@
+package erdh
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteMarkdown(t *testing.T) {
+	cons := newRelationLabelTestConstruction()
+
+	var b bytes.Buffer
+	if err := WriteMarkdown(&b, cons, PumlOptions{}); err != nil {
+		t.Fatalf("failed test WriteMarkdown %#v", err)
+	}
+	out := b.String()
+	for _, line := range []string{
+		"# shop\n\n## DATA\n\n### members\n",
+		"| id | int | PRI | yes |  |  |\n",
+		"### order items\n",
+		"| members | member_id -> id; reviewer_id -> id | zero-many | only-one | placed \"by\" | order | buyer | dashed | fk |\n",
+		"## LOG\n\n### logs\n",
+		"| members | message -> id |  |  |  |  |  | solid | ex_info |\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Fatalf("failed test WriteMarkdown %q\n%s", line, out)
+		}
+	}
+	if strings.Index(out, "### members") > strings.Index(out, "### order items") {
+		t.Fatalf("failed test WriteMarkdown order\n%s", out)
+	}
+
+	b.Reset()
+	if err := WriteMarkdown(&b, cons, PumlOptions{Groups: []string{"LOG"}}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(b.String(), "## DATA") || !strings.Contains(b.String(), "### logs") {
+		t.Fatalf("failed test WriteMarkdown groups\n%s", b.String())
+	}
+}
@@ -0,0 +1,98 @@
+package erdh
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 複数の読み込み元をマージする際、テーブル名が衝突した場合の扱い
+const (
+	// MergePolicyError は衝突をエラーとする
+	MergePolicyError = "error"
+	// MergePolicyLastWins は後から読んだテーブルで上書きする
+	MergePolicyLastWins = "last-wins"
+	// MergePolicyPrefix は後から読んだテーブル名に接頭辞を付けて両方残す
+	MergePolicyPrefix = "prefix"
+)
+
+// Merge は other のテーブルを c に追加する
+// テーブル名が衝突した場合は policy に従う（空文字列は MergePolicyError と同じ）
+func (c *Construction) Merge(other *Construction, policy, prefix string) error {
+	switch policy {
+	case "", MergePolicyError, MergePolicyLastWins, MergePolicyPrefix:
+	default:
+		return errors.New("invalid merge policy " + policy)
+	}
+
+	if len(c.DBName) == 0 {
+		c.DBName = other.DBName
+	}
+
+	exists := map[string]int{}
+	for i, t := range c.Tables {
+		exists[t.Name] = i
+	}
+
+	// 接頭辞付きへのリネームは other 内の参照にも反映する
+	renamed := map[string]string{}
+	if policy == MergePolicyPrefix {
+		for _, t := range other.Tables {
+			if _, ok := exists[t.Name]; !ok {
+				continue
+			}
+			if len(prefix) == 0 {
+				return fmt.Errorf("table %s conflicts but no prefix is given", t.Name)
+			}
+			renamed[t.Name] = prefix + t.Name
+		}
+	}
+
+	for _, t := range other.Tables {
+		t.renameReferences(renamed)
+		if newName, ok := renamed[t.Name]; ok {
+			t.Name = newName
+		}
+
+		idx, ok := exists[t.Name]
+		if !ok {
+			exists[t.Name] = len(c.Tables)
+			c.Tables = append(c.Tables, t)
+			continue
+		}
+
+		switch policy {
+		case MergePolicyLastWins:
+			c.Tables[idx] = t
+		case MergePolicyPrefix:
+			return fmt.Errorf("table %s conflicts even after prefixing", t.Name)
+		default:
+			return fmt.Errorf("table %s is defined in multiple sources", t.Name)
+		}
+	}
+
+	return nil
+}
+
+// renameReferences はテーブルからの参照先テーブル名を renamed に従って置き換える
+func (t *Table) renameReferences(renamed map[string]string) {
+	if len(renamed) == 0 {
+		return
+	}
+	fkeys := make([]ForeginKey, len(t.ForeginKeys))
+	for i, f := range t.ForeginKeys {
+		if newName, ok := renamed[f.ReferencedTableName]; ok {
+			f.ReferencedTableName = newName
+		}
+		fkeys[i] = f
+	}
+	t.ForeginKeys = fkeys
+
+	exRels := make([]ExRelation, len(t.ExRelations))
+	for i, e := range t.ExRelations {
+		if newName, ok := renamed[e.ReferencedTableName]; ok {
+			e.ReferencedTableName = newName
+		}
+		exRels[i] = e
+	}
+	t.ExRelations = exRels
+}
@@ -0,0 +1,40 @@
+package erdh
+
+import "testing"
+
+func newMergeTestConstruction(dbName string) *Construction {
+	var cons = &Construction{DBName: dbName}
+	cons.Tables = []Table{{Name: "items", Group: dbName}, {Name: "item_logs", Group: dbName}}
+	cons.Tables[1].AddForeginKey("", "item_id", "items", "id")
+	return cons
+}
+
+func TestMergePolicies(t *testing.T) {
+	base := newMergeTestConstruction("core")
+
+	if err := base.Merge(newMergeTestConstruction("cache"), MergePolicyError, ""); err == nil {
+		t.Fatalf("failed test merge error policy")
+	}
+
+	base = newMergeTestConstruction("core")
+	if err := base.Merge(newMergeTestConstruction("cache"), MergePolicyLastWins, ""); err != nil {
+		t.Fatalf("failed test merge last-wins %#v", err)
+	}
+	if len(base.Tables) != 2 || base.Tables[0].Group != "cache" {
+		t.Fatalf("failed test merge last-wins %#v", base.Tables)
+	}
+
+	base = newMergeTestConstruction("core")
+	if err := base.Merge(newMergeTestConstruction("cache"), MergePolicyPrefix, "cache_"); err != nil {
+		t.Fatalf("failed test merge prefix %#v", err)
+	}
+	if len(base.Tables) != 4 || base.Tables[3].Name != "cache_item_logs" {
+		t.Fatalf("failed test merge prefix %#v", base.Tables)
+	}
+	if base.Tables[3].ForeginKeys[0].ReferencedTableName != "cache_items" {
+		t.Fatalf("failed test merge prefix reference %#v", base.Tables[3].ForeginKeys)
+	}
+	if base.Tables[1].ForeginKeys[0].ReferencedTableName != "items" {
+		t.Fatalf("failed test merge prefix base reference %#v", base.Tables[1].ForeginKeys)
+	}
+}
@@ -0,0 +1,169 @@
+package erdh
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MermaidReservedWords はMermaidの erDiagram で別名として使えない語
+var MermaidReservedWords = []string{"erDiagram", "end", "title", "direction", "style", "classDef", "class"}
+
+// mermaidWordReg はMermaidの属性の型と名前に使えない文字
+var mermaidWordReg = regexp.MustCompile(`[^A-Za-z0-9_\-\[\]\(\)]`)
+
+// WriteMermaid はMermaidの erDiagram をio.Writerに書き込む
+// opts.Groups を指定した場合は、そのグループのテーブルと、そのグループのテーブル同士のリレーションを出力する
+// theme の edge_style が column, label であれば外部キーの制約ごとにリレーションを出力し、カラムの対応をラベルに加える
+func WriteMermaid(w io.Writer, cons *Construction, opts PumlOptions) error {
+	theme, err := opts.Theme.Resolve()
+	if err != nil {
+		return err
+	}
+
+	isTargetGroup := func(group string) bool {
+		return len(opts.Groups) == 0 || contains(opts.Groups, group)
+	}
+	table2group := map[string]string{}
+	tables := []Table{}
+	for _, tbl := range cons.Tables {
+		table2group[tbl.Name] = tbl.Group
+		if isTargetGroup(tbl.Group) {
+			tables = append(tables, tbl)
+		}
+	}
+	sort.SliceStable(tables, func(i, j int) bool { return tables[i].Name < tables[j].Name })
+
+	aliases := NewAliases(MermaidReservedWords)
+	for _, tbl := range tables {
+		aliases.Get(tbl.Name)
+	}
+
+	fmt.Fprintln(w, "erDiagram")
+	for _, tbl := range tables {
+		alias := aliases.Get(tbl.Name)
+		if alias == tbl.Name {
+			fmt.Fprintf(w, "    %s {\n", alias)
+		} else {
+			fmt.Fprintf(w, "    %s[\"%s\"] {\n", alias, QuoteMermaid(tbl.Name))
+		}
+		fkColumns := map[string]bool{}
+		for _, fk := range tbl.ForeginKeys {
+			fkColumns[fk.ColumnName] = true
+		}
+		for _, column := range tbl.Columns {
+			keys := []string{}
+			if column.IsPrimary {
+				keys = append(keys, "PK")
+			}
+			if fkColumns[column.Name] {
+				keys = append(keys, "FK")
+			}
+			name := mermaidWord(column.Name, "column")
+			fmt.Fprintf(w, "        %s %s", mermaidWord(column.ColumnType, "unknown"), name)
+			if len(keys) > 0 {
+				fmt.Fprintf(w, " %s", strings.Join(keys, ", "))
+			}
+			// 名前を置き換えたカラムは元の名前をコメントとする
+			if name != column.Name {
+				fmt.Fprintf(w, " \"%s\"", QuoteMermaid(column.Name))
+			}
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, "    }")
+	}
+
+	for _, tbl := range tables {
+		for _, exr := range tbl.ExRelations {
+			if _, ok := table2group[exr.ReferencedTableName]; !ok || !isTargetGroup(table2group[exr.ReferencedTableName]) {
+				continue
+			}
+			line := "--"
+			if exr.Style == RelationStyleDashed {
+				line = ".."
+			}
+			edge := mermaidThisCardinality(exr.ThisConn) + line + mermaidThatCardinality(exr.ThatConn)
+			from, to := aliases.Get(tbl.Name), aliases.Get(exr.ReferencedTableName)
+
+			if (theme.EdgeStyle != "column" && theme.EdgeStyle != "label") || len(exr.Columns) == 0 {
+				fmt.Fprintf(w, "    %s %s %s : \"%s\"\n", from, edge, to, mermaidRelationLabel(exr, false))
+				continue
+			}
+			for _, columns := range exr.ColumnGroups() {
+				fmt.Fprintf(w, "    %s %s %s : \"%s\"\n", from, edge, to, mermaidRelationLabel(exr.withColumns(columns), true))
+			}
+		}
+	}
+	return nil
+}
+
+// mermaidRelationLabel はリレーションのラベルを返す
+// 役割名は「(this_role / that_role)」の形式で加え、withColumns がtrueであればカラムの対応も加える
+func mermaidRelationLabel(exr ExRelation, withColumns bool) string {
+	parts := []string{}
+	if len(exr.Label) > 0 {
+		parts = append(parts, exr.Label)
+	}
+	if len(exr.ThisRole) > 0 || len(exr.ThatRole) > 0 {
+		parts = append(parts, "("+exr.ThisRole+" / "+exr.ThatRole+")")
+	}
+	if withColumns {
+		columns := []string{}
+		for _, col := range exr.Columns {
+			columns = append(columns, col.From+" -> "+col.To)
+		}
+		parts = append(parts, strings.Join(columns, ", "))
+	}
+	return QuoteMermaid(strings.Join(parts, " "))
+}
+
+// mermaidWord は name をMermaidの属性の型または名前として使える語に変換する。空であれば def を返す
+func mermaidWord(name, def string) string {
+	word := mermaidWordReg.ReplaceAllString(name, "_")
+	if len(word) == 0 {
+		return def
+	}
+	if !('A' <= word[0] && word[0] <= 'Z' || 'a' <= word[0] && word[0] <= 'z' || word[0] == '_') {
+		word = "_" + word
+	}
+	return word
+}
+
+// QuoteMermaid はMermaidのダブルクォートで囲む文字列として使えるように name を変換する
+// ダブルクォートは #quot; で表し、改行は空白に置き換える
+func QuoteMermaid(name string) string {
+	name = strings.Replace(name, "\"", "#quot;", -1)
+	name = strings.Replace(name, "\r", " ", -1)
+	return strings.Replace(name, "\n", " ", -1)
+}
+
+// mermaidThisCardinality は左側のカーディナリティを返す
+// Mermaidではカーディナリティを省略できないため、one（既定値）は only-one、many は zero-many とする
+func mermaidThisCardinality(this string) string {
+	switch this {
+	case "zero-or-one", "zeroorone":
+		return "|o"
+	case "many", "zero-many", "zeromany":
+		return "}o"
+	case "one-more", "onemore":
+		return "}|"
+	default:
+		return "||"
+	}
+}
+
+// mermaidThatCardinality は右側のカーディナリティを返す
+func mermaidThatCardinality(that string) string {
+	switch that {
+	case "zero-or-one", "zeroorone":
+		return "o|"
+	case "many", "zero-many", "zeromany":
+		return "o{"
+	case "one-more", "onemore":
+		return "|{"
+	default:
+		return "||"
+	}
+}
@@ -0,0 +1,75 @@
+package erdh
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/iwot/erdh-go/config"
+)
+
+// newRelationLabelTestConstruction はラベル、役割名、破線を指定したリレーションを持つConstructionを返す
+func newRelationLabelTestConstruction() *Construction {
+	var cons = &Construction{DBName: "shop"}
+	members := Table{Name: "members", Group: "DATA"}
+	members.AddColumn("id", "int", "PRI", "", "", true, true)
+	members.AddColumn("会員番号", "varchar(20)", "", "", "", false, false)
+	orders := Table{Name: "order items", Group: "DATA"}
+	orders.AddColumn("id", "int unsigned", "PRI", "", "", true, true)
+	orders.AddColumn("member_id", "int", "", "", "", true, false)
+	orders.AddColumn("reviewer_id", "int", "", "", "", false, false)
+	orders.AddForeginKey("fk_member", "member_id", "members", "id")
+	orders.AddForeginKey("fk_reviewer", "reviewer_id", "members", "id")
+	logs := Table{Name: "logs", Group: "LOG"}
+	logs.AddColumn("message", "text", "", "", "", false, false)
+	cons.Tables = []Table{members, orders, logs}
+	cons.UpdateExRelationsFromForeignKeys()
+	cons.ApplyExInfo(config.ExtraConfig{Tables: []config.Table{
+		{Name: "order items", Group: "DATA", Relations: []config.ExRelation{{
+			ReferencedTableName: "members",
+			ThisConnection:      "zero-many",
+			ThatConnection:      "only-one",
+			Label:               `placed "by"`,
+			ThisRole:            "order",
+			ThatRole:            "buyer",
+			Style:               RelationStyleDashed,
+		}}},
+		{Name: "logs", Group: "LOG", Relations: []config.ExRelation{{
+			ReferencedTableName: "members",
+			Columns:             []config.ColumnRelation{{From: "message", To: "id"}},
+		}}},
+	}})
+	return cons
+}
+
+func TestWriteMermaid(t *testing.T) {
+	cons := newRelationLabelTestConstruction()
+
+	render := func(opts PumlOptions) string {
+		var b bytes.Buffer
+		if err := WriteMermaid(&b, cons, opts); err != nil {
+			t.Fatalf("failed test WriteMermaid %#v", err)
+		}
+		return b.String()
+	}
+
+	out := render(PumlOptions{})
+	for _, line := range []string{
+		"erDiagram\n",
+		"    members {\n        int id PK\n        varchar(20) ____ \"会員番号\"\n    }\n",
+		"    order_items[\"order items\"] {\n        int_unsigned id PK\n        int member_id FK\n",
+		`    order_items }o..|| members : "placed #quot;by#quot; (order / buyer)"` + "\n",
+		`    logs ||--|| members : ""` + "\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Fatalf("failed test WriteMermaid %q\n%s", line, out)
+		}
+	}
+
+	// 外部キーの制約ごとにカラムの対応をラベルに加える
+	out = render(PumlOptions{Groups: []string{"DATA"}, Theme: config.Theme{EdgeStyle: "label"}})
+	if strings.Contains(out, "logs") || strings.Count(out, "order_items }o..|| members") != 2 ||
+		!strings.Contains(out, `: "placed #quot;by#quot; (order / buyer) reviewer_id -> id"`) {
+		t.Fatalf("failed test WriteMermaid edge_style label\n%s", out)
+	}
+}
@@ -3,38 +3,76 @@ package erdh
 import (
 	"fmt"
 	"io"
+	"regexp"
 	"sort"
+	"strings"
 
 	"github.com/iwot/erdh-go/config"
 )
 
-// WritePuml はPlantUML形式のファイルの@startumlから@endumlをio.Writerに書き込む
-func WritePuml(w io.Writer, cons *Construction, conf *config.Config, centerGroup string) error {
+// PumlOptions はPlantUML形式の出力の設定
+type PumlOptions struct {
+	// Groups は出力するグループ。空であればすべてのグループを出力する
+	Groups []string
+	// Theme は図の見た目の定義
+	Theme config.Theme
+}
 
-	// ファイル名を対象グループ名とする。
-	if len(centerGroup) > 0 {
-		fmt.Fprintln(w, "@startuml " + centerGroup)
-	} else {
-		fmt.Fprintln(w, "@startuml")
+// NewPumlOptions は設定ファイルの group と theme から PumlOptions を返す
+func NewPumlOptions(conf *config.Config) PumlOptions {
+	return PumlOptions{Groups: conf.Group, Theme: conf.Theme}
+}
+
+// WritePuml はPlantUML形式のファイルの@startumlから@endumlをio.Writerに書き込む
+func WritePuml(w io.Writer, cons *Construction, opts PumlOptions, centerGroup string) error {
+	theme, err := opts.Theme.Resolve()
+	if err != nil {
+		return err
 	}
 
 	// グループ一覧
 	groups := []string{}
 	encountered := map[string]bool{}
 	table2group := map[string]string{}
+	tableNames := []string{}
 	for _, tbl := range cons.Tables {
 		encountered[tbl.Group] = true
 		table2group[tbl.Name] = tbl.Group
+		tableNames = append(tableNames, tbl.Name)
 	}
 	for key := range encountered {
 		groups = append(groups, key)
 	}
+	sort.Strings(groups)
+	sort.Strings(tableNames)
+
+	// 別名はグループ、テーブルの順に名前順で割り当てる
+	aliases := NewPumlAliases()
+	for _, group := range groups {
+		aliases.GetScoped("package", group)
+	}
+	for _, name := range tableNames {
+		aliases.Get(name)
+	}
+
+	// ファイル名を対象グループ名とする。
+	if len(centerGroup) > 0 {
+		fmt.Fprintln(w, "@startuml "+aliases.GetScoped("package", centerGroup))
+	} else {
+		fmt.Fprintln(w, "@startuml")
+	}
+
+	writePumlThemeHeader(w, theme)
+
+	// テーブルの種類ごとの背景色
+	tableKinds := theme.GetTableKinds()
+	writePumlTableKindSkinparam(w, tableKinds)
 
 	isTargetGroup := func(group string) bool {
-		if len(conf.Group) == 0 {
+		if len(opts.Groups) == 0 {
 			return true
 		}
-		for _, g := range conf.Group {
+		for _, g := range opts.Groups {
 			if g == group {
 				return true
 			}
@@ -49,9 +87,33 @@ func WritePuml(w io.Writer, cons *Construction, conf *config.Config, centerGroup
 				result = append(result, tbl)
 			}
 		}
+		sort.SliceStable(result, func(i, j int) bool { return result[i].Name < result[j].Name })
 		return result
 	}
 
+	// カラム同士を結ぶ場合、線の端になるカラムは省略せずに出力する
+	edgeColumns := map[string]map[string]bool{}
+	if theme.EdgeStyle == "column" {
+		for _, tbl := range cons.Tables {
+			if !isTargetGroup(tbl.Group) {
+				continue
+			}
+			for _, exr := range tbl.ExRelations {
+				if !isTargetGroup(table2group[exr.ReferencedTableName]) {
+					continue
+				}
+				for _, columns := range exr.ColumnGroups() {
+					if !canUseColumnPorts(cons, tbl, exr.withColumns(columns)) {
+						continue
+					}
+					addEdgeColumn(edgeColumns, tbl.Name, columns[0].From)
+					addEdgeColumn(edgeColumns, exr.ReferencedTableName, columns[0].To)
+				}
+			}
+		}
+	}
+
+	usedKinds := map[string]config.TableKind{}
 	for _, group := range groups {
 		if !isTargetGroup(group) {
 			continue
@@ -63,36 +125,55 @@ func WritePuml(w io.Writer, cons *Construction, conf *config.Config, centerGroup
 		if len(groupTables) > 0 {
 			if group == centerGroup {
 				// 中心となるグループに色を付ける
-				fmt.Fprintf(w, "package \"%s\" as %s #DDDDDD {\n", group, group)
+				fmt.Fprintf(w, "package \"%s\" as %s %s {\n", QuotePuml(group), aliases.GetScoped("package", group), theme.CenterGroupColor)
+			} else if color, ok := theme.GroupColors[group]; ok {
+				fmt.Fprintf(w, "package \"%s\" as %s %s {\n", QuotePuml(group), aliases.GetScoped("package", group), color)
 			} else {
-				fmt.Fprintf(w, "package \"%s\" as %s {\n", group, group)
+				fmt.Fprintf(w, "package \"%s\" as %s {\n", QuotePuml(group), aliases.GetScoped("package", group))
 			}
 		}
 
 		for _, table := range groupTables {
 			// entity start
 			fmt.Fprint(w, "  ")
-			fmt.Fprintf(w, "entity \"%s\" as %s <<D,TRANSACTION_MARK_COLOR>> {\n", table.Name, table.Name)
+			kind := theme.GetTableKind(table.GetKind())
+			usedKinds[kind.Name] = kind
+			// 行数に応じた色
+			color := ""
+			if table.Stats != nil {
+				if c := theme.RowColorFor(table.Stats.Rows); len(c) > 0 {
+					color = " " + c
+				}
+			}
+			fmt.Fprintf(w, "entity \"%s\" as %s <<(%s,%s) %s>>%s {\n", QuotePuml(table.Name), aliases.Get(table.Name), kind.Mark, kind.MarkColor, kind.Name, color)
+
+			// 仮想テーブルはモジュール名を示す
+			if len(table.Module) > 0 {
+				fmt.Fprintf(w, "    .. USING %s ..\n", QuotePuml(table.Module))
+			}
+			if theme.Stats && table.Stats != nil {
+				fmt.Fprintf(w, "    .. %s ..\n", table.Stats)
+			}
 
 			maxColumnShowCount := 3
 			absentColumnCount := 0
 			columnCount := 0
 			for _, column := range table.Columns {
 				columnCount++
-				if columnCount > maxColumnShowCount {
+				if columnCount > maxColumnShowCount && !edgeColumns[table.Name][column.Name] {
 					absentColumnCount++
 					continue
 				}
 				fmt.Fprint(w, "    ")
 				if column.IsPrimary {
 					fmt.Fprint(w, "+ ")
-					fmt.Fprint(w, column.Name)
+					fmt.Fprint(w, QuotePuml(column.Name))
 					fmt.Fprintln(w, " [PK]")
 
 					fmt.Fprint(w, "    ")
 					fmt.Fprintln(w, "--")
 				} else {
-					fmt.Fprintln(w, column.Name)
+					fmt.Fprintln(w, QuotePuml(column.Name))
 				}
 			}
 
@@ -121,21 +202,188 @@ func WritePuml(w io.Writer, cons *Construction, conf *config.Config, centerGroup
 			if !isTargetGroup(table2group[exr.ReferencedTableName]) {
 				continue
 			}
-			fmt.Fprint(w, tbl.Name)
-			fmt.Fprint(w, "  ")
-			fmt.Fprint(w, GetThisCardinality(exr.ThisConn))
-			fmt.Fprint(w, "--")
-			fmt.Fprint(w, GetThatCardinality(exr.ThatConn))
-			fmt.Fprint(w, "  ")
-			fmt.Fprintln(w, exr.ReferencedTableName)
+			thisCardinality, thatCardinality := GetThisCardinality(exr.ThisConn), GetThatCardinality(exr.ThatConn)
+			if exr.Style == RelationStyleDashed {
+				thisCardinality = strings.Replace(thisCardinality, "-", ".", -1)
+				thatCardinality = strings.Replace(thatCardinality, "-", ".", -1)
+			}
+			edge := thisCardinality + pumlEdgeLine(theme, exr) + thatCardinality
+			if len(exr.ThisRole) > 0 {
+				edge = "\"" + QuotePuml(exr.ThisRole) + "\" " + edge
+			}
+			if len(exr.ThatRole) > 0 {
+				edge += " \"" + QuotePuml(exr.ThatRole) + "\""
+			}
+			from := aliases.Get(tbl.Name)
+			to := aliases.Get(exr.ReferencedTableName)
+
+			labels := []string{}
+			if len(exr.Label) > 0 {
+				labels = append(labels, QuotePuml(exr.Label))
+			}
+			if (theme.EdgeStyle != "column" && theme.EdgeStyle != "label") || len(exr.Columns) == 0 {
+				fmt.Fprintf(w, "%s  %s  %s%s\n", from, edge, to, pumlEdgeLabelSuffix(labels))
+				continue
+			}
+
+			// 制約（外部キー）ごとに線を引き、同じテーブルへの複数の外部キーと複合外部キーを区別する
+			for _, columns := range exr.ColumnGroups() {
+				sub := exr.withColumns(columns)
+				if theme.EdgeStyle == "column" && canUseColumnPorts(cons, tbl, sub) {
+					// table::column の形式でカラム同士を結ぶ
+					fmt.Fprintf(w, "%s::%s  %s  %s::%s%s\n", from, columns[0].From, edge, to, columns[0].To, pumlEdgeLabelSuffix(labels))
+				} else {
+					fmt.Fprintf(w, "%s  %s  %s%s\n", from, edge, to, pumlEdgeLabelSuffix(append(labels, pumlEdgeLabel(sub))))
+				}
+			}
 		}
 	}
 
+	if theme.Legend {
+		writePumlTableKindLegend(w, tableKinds, usedKinds)
+	}
+
 	fmt.Fprintln(w, "@enduml")
 
 	return nil
 }
 
+// writePumlThemeHeader はテーマの !include、レイアウト、skinparam を書き込む
+func writePumlThemeHeader(w io.Writer, theme config.Theme) {
+	for _, include := range theme.Includes {
+		fmt.Fprintf(w, "!include %s\n", include)
+	}
+
+	switch theme.Direction {
+	case "left-to-right":
+		fmt.Fprintln(w, "left to right direction")
+	case "top-to-bottom":
+		fmt.Fprintln(w, "top to bottom direction")
+	}
+
+	if len(theme.LineType) > 0 {
+		fmt.Fprintf(w, "skinparam linetype %s\n", theme.LineType)
+	}
+
+	keys := []string{}
+	for key := range theme.Skinparams {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "skinparam %s %s\n", key, theme.Skinparams[key])
+	}
+}
+
+// pumlEdgeLine はリレーションの由来に応じて色を付けた線の中央部分を返す
+// style が dashed であれば破線とする
+func pumlEdgeLine(theme config.Theme, exr ExRelation) string {
+	color := theme.EdgeColors.ExInfo
+	if exr.Source == RelationSourceForeignKey {
+		color = theme.EdgeColors.ForeignKey
+	}
+	line := "-"
+	if exr.Style == RelationStyleDashed {
+		line = "."
+	}
+	if len(color) == 0 {
+		return line + line
+	}
+	return line + "[" + color + "]" + line
+}
+
+// pumlPortNameReg は table::column の形式で指定できるカラム名
+var pumlPortNameReg = regexp.MustCompile(`^\w+$`)
+
+// canUseColumnPorts はリレーションのカラムがひとつで両端のテーブルに存在し、table::column の形式で指定できればtrueを返す
+// 複合外部キーは線を1本にするため、カラム同士を結ばない
+func canUseColumnPorts(cons *Construction, tbl Table, exr ExRelation) bool {
+	ref := cons.GetTableMut(exr.ReferencedTableName)
+	if len(exr.Columns) != 1 || ref == nil {
+		return false
+	}
+	for _, col := range exr.Columns {
+		if !pumlPortNameReg.MatchString(col.From) || !pumlPortNameReg.MatchString(col.To) {
+			return false
+		}
+		if tbl.GetColumn(col.From) == nil || ref.GetColumn(col.To) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func addEdgeColumn(edgeColumns map[string]map[string]bool, table, column string) {
+	if _, ok := edgeColumns[table]; !ok {
+		edgeColumns[table] = map[string]bool{}
+	}
+	edgeColumns[table][column] = true
+}
+
+// pumlEdgeLabelSuffix は線のラベルを改行でつないだ「 : ラベル」を返す。ラベルがなければ空文字列を返す
+func pumlEdgeLabelSuffix(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	return " : " + strings.Join(labels, "\\n")
+}
+
+// pumlEdgeLabel はリレーションのカラムの対応を「from -> to」の形式で1行ずつ並べたラベルを返す
+func pumlEdgeLabel(exr ExRelation) string {
+	lines := []string{}
+	for _, col := range exr.Columns {
+		lines = append(lines, QuotePuml(col.From)+" -> "+QuotePuml(col.To))
+	}
+	return strings.Join(lines, "\\n")
+}
+
+// writePumlTableKindSkinparam はテーブルの種類ごとの背景色をskinparamとして書き込む
+func writePumlTableKindSkinparam(w io.Writer, kinds []config.TableKind) {
+	found := false
+	for _, kind := range kinds {
+		if len(kind.BackgroundColor) > 0 {
+			found = true
+		}
+	}
+	if !found {
+		return
+	}
+
+	fmt.Fprintln(w, "skinparam class {")
+	for _, kind := range kinds {
+		if len(kind.BackgroundColor) > 0 {
+			fmt.Fprintf(w, "  BackgroundColor<<%s>> %s\n", kind.Name, kind.BackgroundColor)
+		}
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// writePumlTableKindLegend は出力したテーブルの種類の凡例を書き込む
+func writePumlTableKindLegend(w io.Writer, kinds []config.TableKind, usedKinds map[string]config.TableKind) {
+	// テーマに定義された順、その後に未定義の種類を名前順に並べる
+	legendKinds := []config.TableKind{}
+	for _, kind := range kinds {
+		if _, ok := usedKinds[kind.Name]; ok {
+			legendKinds = append(legendKinds, kind)
+			delete(usedKinds, kind.Name)
+		}
+	}
+	names := []string{}
+	for name := range usedKinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		legendKinds = append(legendKinds, usedKinds[name])
+	}
+
+	fmt.Fprintln(w, "legend right")
+	for _, kind := range legendKinds {
+		fmt.Fprintf(w, "  <back:%s> %s </back> %s\n", kind.MarkColor, kind.Mark, kind.Label)
+	}
+	fmt.Fprintln(w, "endlegend")
+}
+
 func contains(s []string, test string) bool {
 	for _, v := range s {
 		if test == v {
@@ -173,7 +421,7 @@ func removeOtherGroupRelation(tbl *Table, cons *Construction, relationGroups []s
 }
 
 // WritePumlByGroup はWritePumlをグループごとに適用する
-func WritePumlByGroup(w io.Writer, cons *Construction, conf *config.Config) error {
+func WritePumlByGroup(w io.Writer, cons *Construction, opts PumlOptions) error {
 	// グループ一覧
 	groups := []string{}
 	// centerGroupTables := []string{}
@@ -185,80 +433,44 @@ func WritePumlByGroup(w io.Writer, cons *Construction, conf *config.Config) erro
 	}
 	sort.SliceStable(groups, func(i, j int) bool { return groups[i] < groups[j] })
 
-	// テーブルから参照しているテーブルを集めるための関数
-	addReferenceTableToCons := func (refInfo ReferencedTableInfo, cons *Construction, tables *[]Table) []string {
-		relationGroups := []string{}
-		for _, tbl1 := range *tables {
-			if refInfo.GetReferencedTableName() == tbl1.Name {
-				cons.AddTable(tbl1)
-				relationGroups = append(relationGroups, tbl1.Group)
-				// tbl1が属するグループも集める
-				for _, tbl2 := range *tables {
-					if tbl1.Group == tbl2.Group {
-						cons.AddTable(tbl2)
-					}
-				}
+	// tableName のテーブルと、そのテーブルが属するグループのテーブルを集め、グループを返す
+	tables := map[string]Table{}
+	for _, t := range cons.Tables {
+		if _, ok := tables[t.Name]; !ok {
+			tables[t.Name] = t
+		}
+	}
+	addTableAndGroup := func(tableName string, thisCons *Construction) string {
+		tbl := tables[tableName]
+		thisCons.AddTable(tbl)
+		for _, t := range cons.Tables {
+			if tbl.Group == t.Group {
+				thisCons.AddTable(t)
 			}
 		}
-		return relationGroups
+		return tbl.Group
 	}
 
+	g := cons.Graph()
+
 	// グループごとにページ書き出し
 	for _, centerGroup := range groups {
-		thisCons := &Construction{cons.DBName, []Table{}}
+		thisCons := &Construction{FormatVersion: cons.FormatVersion, DBName: cons.DBName, Tables: []Table{}}
 		relationGroups := []string{}
 		relationGroups = append(relationGroups, centerGroup)
 		for _, t := range cons.Tables {
-			if centerGroup == t.Group {
-				thisCons.AddTable(t)
-
-				//  このテーブルから参照しているテーブルを取得
-				for _, t2 := range t.ForeginKeys {
-					t := addReferenceTableToCons(t2, thisCons, &cons.Tables)
-					if len(t) > 0 {
-						relationGroups = append(relationGroups, t...)
-					}
-				}
-				for _, t2 := range t.ExRelations {
-					t := addReferenceTableToCons(t2, thisCons, &cons.Tables)
-					if len(t) > 0 {
-						relationGroups = append(relationGroups, t...)
-					}
-				}
-
-				// このテーブルを参照しているテーブルを取得
-				for _, t2 := range cons.Tables {
-					if centerGroup == t2.Group {
-						continue
-					}
-					found := false
-					if !found {
-						for _, ex := range t2.ForeginKeys {
-							if ex.ReferencedTableName == t.Name {
-								found = true
-								break
-							}
-						}
-					}
-					if !found {
-						for _, ex := range t2.ExRelations {
-							if ex.ReferencedTableName == t.Name {
-								found = true
-								break
-							}
-						}
-					}
+			if centerGroup != t.Group {
+				continue
+			}
+			thisCons.AddTable(t)
 
-					if found {
-						thisCons.AddTable(t2)
-						// t2が属するグループも集める
-						for _, t3 := range cons.Tables {
-							if t2.Group == t3.Group {
-								thisCons.AddTable(t3)
-								relationGroups = append(relationGroups, t3.Group)
-							}
-						}
-					}
+			// このテーブルから参照しているテーブルと、このテーブルを参照している他のグループのテーブルを取得
+			for _, ref := range g.Successors(t.Name) {
+				relationGroups = append(relationGroups, addTableAndGroup(ref, thisCons))
+			}
+			for _, ref := range g.Predecessors(t.Name) {
+				if tables[ref].Group != centerGroup {
+					relationGroups = append(relationGroups, addTableAndGroup(ref, thisCons))
 				}
 			}
 		}
@@ -269,8 +481,8 @@ func WritePumlByGroup(w io.Writer, cons *Construction, conf *config.Config) erro
 
 		// Tablesをソート
 		sort.SliceStable(thisCons.Tables, func(i, j int) bool { return thisCons.Tables[i].Name < thisCons.Tables[j].Name })
-		
-		err := WritePuml(w, thisCons, conf, centerGroup)
+
+		err := WritePuml(w, thisCons, opts, centerGroup)
 		if err != nil {
 			return err
 		}
@@ -279,6 +491,17 @@ func WritePumlByGroup(w io.Writer, cons *Construction, conf *config.Config) erro
 	return nil
 }
 
+// IsValidConnection は this_conn, that_conn に指定できる文字列であればtrueを返す
+func IsValidConnection(conn string) bool {
+	switch conn {
+	case "one", "only-one", "onlyone", "zero-or-one", "zeroorone", "many",
+		"onemore", "one-more", "zeromany", "zero-many":
+		return true
+	default:
+		return false
+	}
+}
+
 // GetThisCardinality は左側のカーディナリティを返す
 func GetThisCardinality(this string) string {
 	switch this {
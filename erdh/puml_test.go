@@ -0,0 +1,316 @@
+package erdh
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/iwot/erdh-go/config"
+	"gopkg.in/yaml.v2"
+)
+
+func newPumlTestConstruction() *Construction {
+	var cons = &Construction{DBName: "shop"}
+	for _, group := range []string{"DATA", "MASTER", "LOG", "EXTRA"} {
+		for _, name := range []string{"a", "b", "c", "d"} {
+			tbl := Table{Name: group + "_" + name, Group: group}
+			tbl.AddColumn("id", "int", "PRI", "", "", true, true)
+			tbl.AddColumn("member_id", "int", "", "", "", true, false)
+			tbl.AddColumn("item_id", "int", "", "", "", true, false)
+			tbl.AddForeginKey("fk_member", "member_id", "DATA_a", "id")
+			tbl.AddForeginKey("fk_item", "item_id", "MASTER_b", "id")
+			tbl.AddForeginKey("fk_log", "item_id", "LOG_c", "id")
+			cons.Tables = append(cons.Tables, tbl)
+		}
+	}
+	cons.UpdateExRelationsFromForeignKeys()
+	return cons
+}
+
+func TestWritePumlIsDeterministic(t *testing.T) {
+	opts := PumlOptions{}
+
+	render := func() ([]byte, []byte) {
+		cons := newPumlTestConstruction()
+		var puml bytes.Buffer
+		if err := WritePumlByGroup(&puml, cons, opts); err != nil {
+			t.Fatalf("failed test WritePumlByGroup %#v", err)
+		}
+		if err := WritePuml(&puml, cons, opts, ""); err != nil {
+			t.Fatalf("failed test WritePuml %#v", err)
+		}
+		im, err := yaml.Marshal(cons)
+		if err != nil {
+			t.Fatalf("failed test yaml.Marshal %#v", err)
+		}
+		return puml.Bytes(), im
+	}
+
+	firstPuml, firstIm := render()
+	for i := 0; i < 20; i++ {
+		puml, im := render()
+		if !bytes.Equal(firstPuml, puml) {
+			t.Fatalf("failed test puml output differs between runs\n%s\n%s", firstPuml, puml)
+		}
+		if !bytes.Equal(firstIm, im) {
+			t.Fatalf("failed test intermediate output differs between runs\n%s\n%s", firstIm, im)
+		}
+	}
+}
+
+func TestUpdateExRelationsFromForeignKeys(t *testing.T) {
+	var cons = &Construction{}
+	tbl := Table{Name: "member_items"}
+	tbl.AddForeginKey("fk_member", "member_id", "members", "id")
+	tbl.AddForeginKey("fk_item", "item_id", "items", "id")
+	tbl.AddForeginKey("fk_item", "item_type", "items", "type")
+	cons.Tables = append(cons.Tables, tbl)
+
+	cons.UpdateExRelationsFromForeignKeys()
+
+	exr := cons.Tables[0].ExRelations
+	if len(exr) != 2 || exr[0].ReferencedTableName != "members" || exr[1].ReferencedTableName != "items" {
+		t.Fatalf("failed test ExRelations order %#v", exr)
+	}
+	if len(exr[1].Columns) != 2 || exr[1].Columns[1] != (ExRelationColumn{From: "item_type", To: "type", Constraint: "fk_item"}) {
+		t.Fatalf("failed test ExRelations columns %#v", exr[1].Columns)
+	}
+}
+
+func TestWritePumlTableKinds(t *testing.T) {
+	var cons = &Construction{}
+	cons.Tables = []Table{
+		{Name: "items", Group: "DATA", IsMaster: true},
+		{Name: "orders", Group: "DATA"},
+		{Name: "order_logs", Group: "DATA", Kind: "log"},
+	}
+	opts := PumlOptions{Theme: config.Theme{
+		Legend:     true,
+		TableKinds: []config.TableKind{{Name: "log", Mark: "L", MarkColor: "#999999", Label: "log"}},
+	}}
+
+	var puml bytes.Buffer
+	WritePuml(&puml, cons, opts, "")
+	out := puml.String()
+
+	for _, expected := range []string{
+		`entity "items" as items <<(M,#88CCFF) master>> {`,
+		`entity "orders" as orders <<(T,#FFAA44) transaction>> {`,
+		`entity "order_logs" as order_logs <<(L,#999999) log>> {`,
+		"  BackgroundColor<<master>> #F0F8FF\n",
+		"legend right\n  <back:#88CCFF> M </back> master\n  <back:#FFAA44> T </back> transaction\n  <back:#999999> L </back> log\nendlegend\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("failed test table kinds %#v not in\n%s", expected, out)
+		}
+	}
+}
+
+func TestWritePumlTheme(t *testing.T) {
+	var cons = &Construction{}
+	items := Table{Name: "items", Group: "MASTER"}
+	orders := Table{Name: "orders", Group: "DATA"}
+	orders.AddForeginKey("fk_item", "item_id", "items", "id")
+	cons.Tables = []Table{items, orders}
+	cons.UpdateExRelationsFromForeignKeys()
+	cons.Tables[1].GetExRelationOfReferencedTableMut("members")
+	cons.Tables = append(cons.Tables, Table{Name: "members", Group: "DATA"})
+
+	opts := PumlOptions{Theme: config.Theme{
+		Name:        "blueprint",
+		Includes:    []string{"style/erd.iuml"},
+		Direction:   "left-to-right",
+		GroupColors: map[string]string{"MASTER": "#FFEEDD"},
+		Skinparams:  map[string]string{"shadowing": "true"},
+	}}
+
+	var puml bytes.Buffer
+	if err := WritePuml(&puml, cons, opts, "DATA"); err != nil {
+		t.Fatalf("failed test WritePuml %#v", err)
+	}
+	out := puml.String()
+
+	for _, expected := range []string{
+		"@startuml DATA\n!include style/erd.iuml\nleft to right direction\nskinparam linetype ortho\n",
+		"skinparam ArrowColor #1F4E79\n",
+		"skinparam shadowing true\n",
+		`package "DATA" as DATA #DCE9F7 {`,
+		`package "MASTER" as MASTER #FFEEDD {`,
+		"orders  ---[#1F4E79]---  items\n",
+		"orders  ---[#7F7F7F]---  members\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("failed test theme %#v not in\n%s", expected, out)
+		}
+	}
+
+	opts.Theme.Name = "unknown"
+	if err := WritePuml(&puml, cons, opts, ""); err == nil {
+		t.Fatalf("failed test unknown theme")
+	}
+}
+
+func TestWritePumlVirtualTable(t *testing.T) {
+	var cons = &Construction{}
+	docs := Table{Name: "docs", Group: "DATA", Module: "fts5"}
+	docs.AddColumn("title", "", "", "", "", false, false)
+	cons.Tables = []Table{docs}
+
+	var puml bytes.Buffer
+	if err := WritePuml(&puml, cons, PumlOptions{}, ""); err != nil {
+		t.Fatal(err)
+	}
+	checkPumlDocument(t, puml.String())
+	if !strings.Contains(puml.String(), "{\n    .. USING fts5 ..\n    title\n  }\n") {
+		t.Fatalf("failed test virtual table module\n%s", puml.String())
+	}
+}
+
+func TestWritePumlEdgeStyle(t *testing.T) {
+	var cons = &Construction{}
+	members := Table{Name: "members", Group: "DATA"}
+	members.AddColumn("id", "int", "PRI", "", "", true, true)
+	orders := Table{Name: "orders", Group: "DATA"}
+	for _, name := range []string{"id", "a", "b", "c", "member_id", "reviewer_id"} {
+		orders.AddColumn(name, "int", "", "", "", true, name == "id")
+	}
+	orders.AddForeginKey("fk_member", "member_id", "members", "id")
+	orders.AddForeginKey("fk_reviewer", "reviewer_id", "members", "id")
+	prices := Table{Name: "prices", Group: "DATA"}
+	prices.AddColumn("shop_id", "int", "PRI", "", "", true, true)
+	prices.AddColumn("item_code", "varchar(10)", "PRI", "", "", true, true)
+	sales := Table{Name: "sales", Group: "DATA"}
+	sales.AddColumn("shop_id", "int", "", "", "", true, false)
+	sales.AddColumn("item_code", "varchar(10)", "", "", "", true, false)
+	sales.AddForeginKey("fk_price", "shop_id", "prices", "shop_id")
+	sales.AddForeginKey("fk_price", "item_code", "prices", "item_code")
+	cons.Tables = []Table{members, orders, {Name: "notes", Group: "DATA"}, prices, sales}
+	cons.UpdateExRelationsFromForeignKeys()
+	cons.GetTableMut("notes").AddExRelations("members", []ExRelationColumn{{From: "member_id", To: "id"}}, "zero-many", "only-one")
+
+	render := func(style string) string {
+		var puml bytes.Buffer
+		if err := WritePuml(&puml, cons, PumlOptions{Theme: config.Theme{EdgeStyle: style}}, ""); err != nil {
+			t.Fatalf("failed test WritePuml %#v", err)
+		}
+		checkPumlDocument(t, puml.String())
+		return puml.String()
+	}
+
+	out := render("column")
+	for _, expected := range []string{
+		"    member_id\n    reviewer_id\n    .. 1 more ..\n  }\n",
+		"orders::member_id  ------  members::id\n",
+		"orders::reviewer_id  ------  members::id\n",
+		// カラムが存在しない場合はラベルで示す
+		"notes  }o--||  members : member_id -> id\n",
+		// 複合外部キーは1本の線とし、カラムの対応をラベルで示す
+		"sales  ------  prices : shop_id -> shop_id\\nitem_code -> item_code\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("failed test edge_style column %#v not in\n%s", expected, out)
+		}
+	}
+	if strings.Contains(out, "sales::") {
+		t.Fatalf("failed test edge_style column composite foreign key\n%s", out)
+	}
+
+	// 同じテーブルへの2つの外部キーは別の線とする
+	out = render("label")
+	for _, expected := range []string{
+		"orders  ------  members : member_id -> id\n",
+		"orders  ------  members : reviewer_id -> id\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("failed test edge_style label %#v not in\n%s", expected, out)
+		}
+	}
+	if !strings.Contains(out, "    .. 3 more ..\n") {
+		t.Fatalf("failed test edge_style label omits columns\n%s", out)
+	}
+
+	if out := render(""); !strings.Contains(out, "orders  ------  members\n") {
+		t.Fatalf("failed test default edge_style\n%s", out)
+	}
+
+	var puml bytes.Buffer
+	if err := WritePuml(&puml, cons, PumlOptions{Theme: config.Theme{EdgeStyle: "unknown"}}, ""); err == nil {
+		t.Fatalf("failed test invalid edge_style")
+	}
+}
+
+func TestWritePumlRelationLabel(t *testing.T) {
+	var cons = &Construction{}
+	members := Table{Name: "members", Group: "DATA"}
+	members.AddColumn("id", "int", "PRI", "", "", true, true)
+	orders := Table{Name: "orders", Group: "DATA"}
+	orders.AddColumn("member_id", "int", "", "", "", true, false)
+	orders.AddForeginKey("fk_member", "member_id", "members", "id")
+	cons.Tables = []Table{members, orders}
+	cons.UpdateExRelationsFromForeignKeys()
+	cons.ApplyExInfo(config.ExtraConfig{Tables: []config.Table{
+		{Name: "orders", Group: "DATA", Relations: []config.ExRelation{{
+			ReferencedTableName: "members",
+			ThisConnection:      "zero-many",
+			ThatConnection:      "only-one",
+			Label:               "placed by",
+			ThisRole:            "order",
+			ThatRole:            "buyer",
+			Style:               RelationStyleDashed,
+		}}},
+	}})
+
+	render := func(theme config.Theme) string {
+		var puml bytes.Buffer
+		if err := WritePuml(&puml, cons, PumlOptions{Theme: theme}, ""); err != nil {
+			t.Fatalf("failed test WritePuml %#v", err)
+		}
+		checkPumlDocument(t, puml.String())
+		return puml.String()
+	}
+
+	if out := render(config.Theme{}); !strings.Contains(out, `orders  "order" }o..|| "buyer"  members : placed by`+"\n") {
+		t.Fatalf("failed test relation label\n%s", out)
+	}
+	out := render(config.Theme{EdgeStyle: "label", EdgeColors: config.EdgeColors{ForeignKey: "#FF0000"}})
+	if !strings.Contains(out, `orders  "order" }o.[#FF0000].|| "buyer"  members : placed by\nmember_id -> id`+"\n") {
+		t.Fatalf("failed test relation label with edge_style label\n%s", out)
+	}
+}
+
+func TestWritePumlStats(t *testing.T) {
+	var cons = &Construction{}
+	for _, s := range []struct {
+		name string
+		rows int64
+	}{{"logs", 2500000}, {"members", 12000}, {"settings", 5}} {
+		tbl := Table{Name: s.name, Group: "DATA", Stats: &TableStats{Rows: s.rows}}
+		tbl.AddColumn("id", "int", "PRI", "", "", true, true)
+		cons.Tables = append(cons.Tables, tbl)
+	}
+	cons.Tables = append(cons.Tables, Table{Name: "unknown", Group: "DATA"})
+
+	opts := PumlOptions{Theme: config.Theme{
+		Stats: true,
+		RowColors: []config.RowColor{
+			{MinRows: 1000000, Color: "#FFCDD2"},
+			{MinRows: 10000, Color: "#FFF9C4"},
+		},
+	}}
+	var puml bytes.Buffer
+	if err := WritePuml(&puml, cons, opts, ""); err != nil {
+		t.Fatalf("failed test WritePuml %#v", err)
+	}
+	out := puml.String()
+	checkPumlDocument(t, out)
+	for _, expected := range []string{
+		"<<(T,#FFAA44) transaction>> #FFCDD2 {\n    .. 2,500,000 rows ..\n",
+		"<<(T,#FFAA44) transaction>> #FFF9C4 {\n    .. 12,000 rows ..\n",
+		"entity \"settings\" as settings <<(T,#FFAA44) transaction>> {\n    .. 5 rows ..\n",
+		"entity \"unknown\" as unknown <<(T,#FFAA44) transaction>> {\n  }\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("failed test stats %#v not in\n%s", expected, out)
+		}
+	}
+}
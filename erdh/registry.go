@@ -0,0 +1,155 @@
+package erdh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/iwot/erdh-go/config"
+)
+
+// Reader は読み込み元からConstructionを読む
+type Reader interface {
+	Read(ctx context.Context, src config.SourceConfig) (*Construction, error)
+}
+
+// ReaderFunc は関数を Reader として扱うための型
+type ReaderFunc func(ctx context.Context, src config.SourceConfig) (*Construction, error)
+
+// Read は f(ctx, src) を呼ぶ
+func (f ReaderFunc) Read(ctx context.Context, src config.SourceConfig) (*Construction, error) {
+	return f(ctx, src)
+}
+
+// Writer はConstructionを出力する
+type Writer interface {
+	Write(ctx context.Context, w io.Writer, cons *Construction, opts PumlOptions) error
+}
+
+// WriterFunc は関数を Writer として扱うための型
+type WriterFunc func(ctx context.Context, w io.Writer, cons *Construction, opts PumlOptions) error
+
+// Write は f(ctx, w, cons, opts) を呼ぶ
+func (f WriterFunc) Write(ctx context.Context, w io.Writer, cons *Construction, opts PumlOptions) error {
+	return f(ctx, w, cons, opts)
+}
+
+// 組み込みの Writer の名前
+const (
+	// FormatPuml は全体をひとつの図として出力する
+	FormatPuml = "puml"
+	// FormatPumlByGroup はグループごとの図を出力する
+	FormatPumlByGroup = "puml-by-group"
+	// FormatYAML はYAMLの中間形式で出力する
+	FormatYAML = "yaml"
+	// FormatJSON はJSONの中間形式で出力する
+	FormatJSON = "json"
+	// FormatMermaid はMermaidの erDiagram として出力する
+	FormatMermaid = "mermaid"
+	// FormatMarkdown はMarkdownのテーブル定義書として出力する
+	FormatMarkdown = "markdown"
+)
+
+var (
+	registryMu sync.RWMutex
+	readers    = map[string]Reader{}
+	writers    = map[string]Writer{}
+)
+
+func init() {
+	intermediate := ReaderFunc(func(ctx context.Context, src config.SourceConfig) (*Construction, error) {
+		if src.Strict {
+			return NewConstructionFromFileStrict(src.SourceFrom)
+		}
+		return NewConstructionFromFile(src.SourceFrom)
+	})
+	RegisterReader("yaml", intermediate)
+	RegisterReader("json", intermediate)
+
+	RegisterWriter(FormatPuml, WriterFunc(func(ctx context.Context, w io.Writer, cons *Construction, opts PumlOptions) error {
+		return WritePuml(w, cons, opts, "")
+	}))
+	RegisterWriter(FormatPumlByGroup, WriterFunc(func(ctx context.Context, w io.Writer, cons *Construction, opts PumlOptions) error {
+		return WritePumlByGroup(w, cons, opts)
+	}))
+	RegisterWriter(FormatYAML, WriterFunc(func(ctx context.Context, w io.Writer, cons *Construction, opts PumlOptions) error {
+		return cons.WriteYaml(w)
+	}))
+	RegisterWriter(FormatJSON, WriterFunc(func(ctx context.Context, w io.Writer, cons *Construction, opts PumlOptions) error {
+		return cons.WriteJSON(w)
+	}))
+	RegisterWriter(FormatMermaid, WriterFunc(func(ctx context.Context, w io.Writer, cons *Construction, opts PumlOptions) error {
+		return WriteMermaid(w, cons, opts)
+	}))
+	RegisterWriter(FormatMarkdown, WriterFunc(func(ctx context.Context, w io.Writer, cons *Construction, opts PumlOptions) error {
+		return WriteMarkdown(w, cons, opts)
+	}))
+}
+
+// RegisterReader は source に name（大文字小文字を区別しない）を指定したときに用いる Reader を登録する
+// 同じ名前で登録済みの Reader は置き換える
+func RegisterReader(name string, r Reader) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	readers[strings.ToLower(name)] = r
+}
+
+// LookupReader は name で登録された Reader を返す
+func LookupReader(name string) (Reader, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	r, ok := readers[strings.ToLower(name)]
+	return r, ok
+}
+
+// RegisterWriter は出力形式 name（大文字小文字を区別しない）の Writer を登録する
+// 同じ名前で登録済みの Writer は置き換える
+func RegisterWriter(name string, w Writer) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	writers[strings.ToLower(name)] = w
+}
+
+// LookupWriter は name で登録された Writer を返す
+func LookupWriter(name string) (Writer, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	w, ok := writers[strings.ToLower(name)]
+	return w, ok
+}
+
+// Readers は登録されている Reader の名前を名前順に返す
+func Readers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	result := []string{}
+	for name := range readers {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Writers は登録されている Writer の名前を名前順に返す
+func Writers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	result := []string{}
+	for name := range writers {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// ReadSource は src.Source で登録された Reader で読み込み元を読む
+func ReadSource(ctx context.Context, src config.SourceConfig) (*Construction, error) {
+	r, ok := LookupReader(src.Source)
+	if !ok {
+		return nil, fmt.Errorf("unknown source %q (registered: %s)", src.Source, strings.Join(Readers(), ", "))
+	}
+	return r.Read(ctx, src)
+}
@@ -0,0 +1,89 @@
+package erdh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/iwot/erdh-go/config"
+)
+
+func TestGenerateWithCustomReaderAndWriter(t *testing.T) {
+	RegisterReader("test-memory", ReaderFunc(func(ctx context.Context, src config.SourceConfig) (*Construction, error) {
+		var cons = &Construction{DBName: src.SourceFrom}
+		items := Table{Name: src.SourceFrom + "_items", Group: "DATA"}
+		items.AddColumn("id", "int", "PRI", "", "", true, true)
+		members := Table{Name: src.SourceFrom + "_members", Group: "DATA"}
+		members.AddColumn("id", "int", "PRI", "", "", true, true)
+		members.AddColumn("item_id", "int", "", "", "", true, false)
+		members.AddForeginKey("fk_item", "item_id", src.SourceFrom+"_items", "id")
+		cons.Tables = []Table{items, members}
+		return cons, nil
+	}))
+	RegisterWriter("test-names", WriterFunc(func(ctx context.Context, w io.Writer, cons *Construction, opts PumlOptions) error {
+		for _, t := range cons.Tables {
+			fmt.Fprintf(w, "%s %s %s %d\n", t.Name, t.Group, t.GetKind(), len(t.ExRelations))
+		}
+		return nil
+	}))
+
+	exInfo, err := config.NewExtraConfigFromYaml([]byte(`
+tables:
+- table: a_items
+  group: MASTER
+  is_master: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	_, err = Generate(context.Background(), config.SourceConfig{Source: "TEST-MEMORY", SourceFrom: "a"},
+		WithSources(config.SourceConfig{Source: "test-memory", SourceFrom: "b"}),
+		WithExInfo(exInfo),
+		WithFormat("test-names"),
+		WithOutput(&out))
+	if err != nil {
+		t.Fatalf("failed test Generate %#v", err)
+	}
+	expected := "a_items MASTER master 0\na_members DATA transaction 1\nb_items DATA transaction 0\nb_members DATA transaction 1\n"
+	if out.String() != expected {
+		t.Fatalf("failed test Generate output %#v", out.String())
+	}
+
+	// ex_info の問題は ValidationFail であればエラーとなる
+	exInfo.Tables[0].Name = "c_items"
+	_, err = Load(context.Background(), config.SourceConfig{Source: "test-memory", SourceFrom: "a"},
+		WithExInfo(exInfo), WithExInfoValidation(ValidationFail))
+	var validationErr ValidationError
+	if !errors.As(err, &validationErr) || len(validationErr.Issues) != 1 {
+		t.Fatalf("failed test Load validation %#v", err)
+	}
+
+	// ValidationWarn であれば警告を出力し、存在しないテーブルは追加しない
+	var log bytes.Buffer
+	cons, err := Load(context.Background(), config.SourceConfig{Source: "test-memory", SourceFrom: "a"},
+		WithExInfo(exInfo), WithLog(&log))
+	if err != nil || !strings.Contains(log.String(), "warning:") || cons.findTable("c_items") != nil {
+		t.Fatalf("failed test Load validation warn %#v %s", err, log.String())
+	}
+
+	_, err = Load(context.Background(), config.SourceConfig{Source: "test-memory", SourceFrom: "a"},
+		WithExInfo(exInfo), WithExInfoValidation("Fail"))
+	if err == nil || !strings.Contains(err.Error(), `invalid ex_info_validation "Fail"`) {
+		t.Fatalf("failed test invalid ex_info_validation %#v", err)
+	}
+
+	_, err = Load(context.Background(), config.SourceConfig{Source: "unknown", SourceFrom: "a"})
+	if err == nil || !strings.Contains(err.Error(), `unknown source "unknown"`) {
+		t.Fatalf("failed test unknown source %#v", err)
+	}
+	_, err = Generate(context.Background(), config.SourceConfig{Source: "test-memory", SourceFrom: "a"}, WithFormat("unknown"), WithOutput(&out))
+	if err == nil || !strings.Contains(err.Error(), `unknown format "unknown"`) {
+		t.Fatalf("failed test unknown format %#v", err)
+	}
+}
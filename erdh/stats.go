@@ -0,0 +1,109 @@
+package erdh
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Size はデータとインデックスのサイズの合計（バイト）を返す
+func (s TableStats) Size() int64 {
+	return s.DataLength + s.IndexLength
+}
+
+// String は「1,234 rows / 1.5 MB」の形式で行数とサイズを返す。サイズが不明であれば行数のみを返す
+func (s TableStats) String() string {
+	if s.Size() == 0 {
+		return formatCount(s.Rows) + " rows"
+	}
+	return formatCount(s.Rows) + " rows / " + formatBytes(s.Size())
+}
+
+// TableGrowth は2つのConstructionの間のテーブルの行数とサイズの変化
+type TableGrowth struct {
+	Table string
+	Old   TableStats
+	New   TableStats
+}
+
+func (g TableGrowth) String() string {
+	return g.Table + ": " + g.Detail()
+}
+
+// Detail は「rows 1,200 -> 3,400 (+2,200, +183.3%), size 1.0 MB -> 2.0 MB」の形式で変化を返す。サイズが変わらなければ行数のみを返す
+func (g TableGrowth) Detail() string {
+	result := fmt.Sprintf("rows %s -> %s (%s)", formatCount(g.Old.Rows), formatCount(g.New.Rows), formatChange(g.Old.Rows, g.New.Rows))
+	if g.Old.Size() != g.New.Size() {
+		result += fmt.Sprintf(", size %s -> %s", formatBytes(g.Old.Size()), formatBytes(g.New.Size()))
+	}
+	return result
+}
+
+// Changed は行数またはサイズが変化していればtrueを返す
+func (g TableGrowth) Changed() bool {
+	return g.Old.Rows != g.New.Rows || g.Old.Size() != g.New.Size()
+}
+
+// Growth は old と new の両方に統計情報のあるテーブルのうち、行数またはサイズが変化したものをテーブル名順に返す
+func Growth(old, new *Construction) []TableGrowth {
+	oldStats := map[string]*TableStats{}
+	for _, t := range old.Tables {
+		if t.Stats != nil {
+			oldStats[t.Name] = t.Stats
+		}
+	}
+
+	result := []TableGrowth{}
+	for _, t := range new.Tables {
+		o, ok := oldStats[t.Name]
+		if !ok || t.Stats == nil {
+			continue
+		}
+		if g := (TableGrowth{Table: t.Name, Old: *o, New: *t.Stats}); g.Changed() {
+			result = append(result, g)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Table < result[j].Table })
+	return result
+}
+
+// formatCount は3桁ごとにカンマで区切った数を返す
+func formatCount(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	sign := ""
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return sign + s
+}
+
+// formatBytes はバイト数を KB, MB, GB などの単位で返す
+func formatBytes(n int64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	value := float64(n)
+	for _, unit := range []string{"KB", "MB", "GB", "TB"} {
+		value /= 1024
+		if value < 1024 || unit == "TB" {
+			return fmt.Sprintf("%.1f %s", value, unit)
+		}
+	}
+	return ""
+}
+
+// formatChange は増減を「+50, +25.0%」の形式で返す
+func formatChange(old, new int64) string {
+	diff := new - old
+	sign := "+"
+	if diff < 0 {
+		sign = ""
+	}
+	if old == 0 {
+		return sign + formatCount(diff)
+	}
+	return fmt.Sprintf("%s%s, %s%.1f%%", sign, formatCount(diff), sign, float64(diff)/float64(old)*100)
+}
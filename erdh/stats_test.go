@@ -0,0 +1,54 @@
+package erdh
+
+import (
+	"testing"
+)
+
+func TestTableStatsString(t *testing.T) {
+	for _, c := range []struct {
+		stats    TableStats
+		expected string
+	}{
+		{TableStats{Rows: 0}, "0 rows"},
+		{TableStats{Rows: 1234567}, "1,234,567 rows"},
+		{TableStats{Rows: 999, DataLength: 1000}, "999 rows / 1000 B"},
+		{TableStats{Rows: 1000, DataLength: 1024 * 1024, IndexLength: 512 * 1024}, "1,000 rows / 1.5 MB"},
+	} {
+		if s := c.stats.String(); s != c.expected {
+			t.Fatalf("failed test TableStats.String %s != %s", s, c.expected)
+		}
+	}
+}
+
+func TestGrowth(t *testing.T) {
+	old := &Construction{Tables: []Table{
+		{Name: "orders", Stats: &TableStats{Rows: 1000, DataLength: 2048}},
+		{Name: "members", Stats: &TableStats{Rows: 10}},
+		{Name: "logs", Stats: &TableStats{Rows: 50}},
+		{Name: "items"},
+		{Name: "removed", Stats: &TableStats{Rows: 1}},
+	}}
+	new := &Construction{Tables: []Table{
+		{Name: "orders", Stats: &TableStats{Rows: 1500, DataLength: 4096}},
+		{Name: "members", Stats: &TableStats{Rows: 10}},
+		{Name: "logs", Stats: &TableStats{Rows: 25}},
+		{Name: "items", Stats: &TableStats{Rows: 3}},
+	}}
+
+	growth := Growth(old, new)
+	expected := []string{
+		"logs: rows 50 -> 25 (-25, -50.0%)",
+		"orders: rows 1,000 -> 1,500 (+500, +50.0%), size 2.0 KB -> 4.0 KB",
+	}
+	if len(growth) != len(expected) {
+		t.Fatalf("failed test Growth %#v", growth)
+	}
+	for i := range expected {
+		if growth[i].String() != expected[i] {
+			t.Fatalf("failed test Growth %s", growth[i])
+		}
+	}
+	if diffs := Diff(old, new); len(diffs) != 3 || diffs[2].Table != "removed" || !diffs[0].IsStats() || diffs[2].IsStats() {
+		t.Fatalf("failed test stats differences %#v", diffs)
+	}
+}
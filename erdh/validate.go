@@ -0,0 +1,108 @@
+package erdh
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iwot/erdh-go/config"
+)
+
+// ex_info の検証で問題が見つかった場合の扱い
+const (
+	// ValidationWarn は問題を警告として出力して処理を続ける
+	ValidationWarn = "warn"
+	// ValidationFail は問題があれば処理を中断する
+	ValidationFail = "fail"
+)
+
+// IsValidValidationMode は ex_info_validation に指定できる文字列（空は ValidationWarn とみなす）であればtrueを返す
+func IsValidValidationMode(mode string) bool {
+	return mode == "" || mode == ValidationWarn || mode == ValidationFail
+}
+
+// ValidationIssue は ex_info の検証で見つかった問題
+type ValidationIssue struct {
+	Table   string
+	Message string
+}
+
+func (i ValidationIssue) String() string {
+	return fmt.Sprintf("ex_info: table %s: %s", i.Table, i.Message)
+}
+
+// ValidationError は ex_info の検証で見つかった問題をまとめたエラー
+type ValidationError struct {
+	Issues []ValidationIssue
+}
+
+func (e ValidationError) Error() string {
+	messages := []string{}
+	for _, i := range e.Issues {
+		messages = append(messages, i.String())
+	}
+	return strings.Join(messages, "\n")
+}
+
+// ValidateExInfo は ex_info を読み込んだスキーマに対して検証する
+// groups が空でなければ、ex_info のグループがその中に含まれることも確認する
+func (c *Construction) ValidateExInfo(exInfo config.ExtraConfig, groups []string) []ValidationIssue {
+	issues := []ValidationIssue{}
+	add := func(table, format string, args ...interface{}) {
+		issues = append(issues, ValidationIssue{Table: table, Message: fmt.Sprintf(format, args...)})
+	}
+
+	tables := map[string]*Table{}
+	for i := range c.Tables {
+		tables[c.Tables[i].Name] = &c.Tables[i]
+	}
+	hasColumn := func(t *Table, name string) bool {
+		for _, col := range t.Columns {
+			if col.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	seen := map[string]bool{}
+	for _, ex := range exInfo.Tables {
+		if seen[ex.Name] {
+			add(ex.Name, "duplicate table entry")
+		}
+		seen[ex.Name] = true
+
+		table, ok := tables[ex.Name]
+		if !ok {
+			add(ex.Name, "unknown table")
+		}
+		if len(groups) > 0 && len(ex.Group) > 0 && !contains(groups, ex.Group) {
+			add(ex.Name, "group %s is not listed in config", ex.Group)
+		}
+
+		for _, exr := range ex.Relations {
+			referenced, ok := tables[exr.ReferencedTableName]
+			if !ok {
+				add(ex.Name, "unknown referenced table %s", exr.ReferencedTableName)
+			}
+			for _, col := range exr.Columns {
+				if table != nil && !hasColumn(table, col.From) {
+					add(ex.Name, "unknown column %s in columns.from", col.From)
+				}
+				if referenced != nil && !hasColumn(referenced, col.To) {
+					add(ex.Name, "unknown column %s.%s in columns.to", exr.ReferencedTableName, col.To)
+				}
+			}
+			if len(exr.ThisConnection) > 0 && !IsValidConnection(exr.ThisConnection) {
+				add(ex.Name, "invalid this_conn %s for %s", exr.ThisConnection, exr.ReferencedTableName)
+			}
+			if len(exr.ThatConnection) > 0 && !IsValidConnection(exr.ThatConnection) {
+				add(ex.Name, "invalid that_conn %s for %s", exr.ThatConnection, exr.ReferencedTableName)
+			}
+			if len(exr.Style) > 0 && !IsValidRelationStyle(exr.Style) {
+				add(ex.Name, "invalid style %s for %s", exr.Style, exr.ReferencedTableName)
+			}
+		}
+	}
+
+	return issues
+}
@@ -0,0 +1,80 @@
+package erdh
+
+import (
+	"testing"
+
+	"github.com/iwot/erdh-go/config"
+)
+
+func TestValidateExInfo(t *testing.T) {
+	var cons = &Construction{}
+	items := Table{Name: "items", Group: "DATA"}
+	items.AddColumn("id", "int", "PRI", "", "", true, true)
+	memberItems := Table{Name: "member_items", Group: "DATA"}
+	memberItems.AddColumn("id", "int", "PRI", "", "", true, true)
+	memberItems.AddColumn("item_id", "int", "", "", "", true, false)
+	cons.Tables = []Table{items, memberItems}
+
+	exInfo, err := config.NewExtraConfigFromYaml([]byte(`
+tables:
+- table: member_items
+  group: DATA
+  relations:
+  - referenced_table_name: items
+    columns:
+    - from: item_id
+      to: id
+    this_conn: many
+    that_conn: onlyone
+  - referenced_table_name: item
+    columns:
+    - from: itemid
+      to: id
+    this_conn: lots
+    style: dotted
+- table: items
+  group: MASTR
+  relations:
+  - referenced_table_name: member_items
+    columns:
+    - from: id
+      to: items_id
+- table: members
+  group: DATA
+- table: items
+  group: MASTER
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issues := cons.ValidateExInfo(*exInfo, []string{"DATA", "MASTER"})
+	expected := []string{
+		"ex_info: table member_items: unknown referenced table item",
+		"ex_info: table member_items: unknown column itemid in columns.from",
+		"ex_info: table member_items: invalid this_conn lots for item",
+		"ex_info: table member_items: invalid style dotted for item",
+		"ex_info: table items: group MASTR is not listed in config",
+		"ex_info: table items: unknown column member_items.items_id in columns.to",
+		"ex_info: table members: unknown table",
+		"ex_info: table items: duplicate table entry",
+	}
+	if len(issues) != len(expected) {
+		t.Fatalf("failed test ValidateExInfo %#v", issues)
+	}
+	for i, issue := range issues {
+		if issue.String() != expected[i] {
+			t.Fatalf("failed test ValidateExInfo %#v", issue.String())
+		}
+	}
+
+	// 警告の後に適用しても、存在しないテーブルとそのテーブルへのリレーションは追加しない
+	cons.ApplyExInfo(*exInfo)
+	if len(cons.Tables) != 2 || cons.findTable("members") != nil {
+		t.Fatalf("failed test ApplyExInfo unknown table %#v", cons.Tables)
+	}
+	mi := cons.findTable("member_items")
+	if len(mi.ExRelations) != 1 || mi.ExRelations[0].ReferencedTableName != "items" {
+		t.Fatalf("failed test ApplyExInfo unknown referenced table %#v", mi.ExRelations)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/iwot/erdh-go/erdh"
+)
+
+// runInitExInfo は読み込み元から ex_info の雛形を生成する
+func runInitExInfo(fs *flag.FlagSet, args []string) error {
+	cf := newConfigFlags(fs)
+	o := fs.String("out", "", "output ex_info file path (default stdout)")
+	u := fs.Bool("update", false, "append tables missing from the existing ex_info file (-out or ex_info in config)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	conf, err := cf.load()
+	if err != nil {
+		return err
+	}
+	password, err := cf.password()
+	if err != nil {
+		return err
+	}
+
+	cons, err := readSources(context.Background(), conf, password)
+	if err != nil {
+		return err
+	}
+
+	if *u {
+		path := *o
+		if len(path) == 0 {
+			paths, err := conf.ExInfo.Expand()
+			if err != nil {
+				return err
+			}
+			if len(paths) != 1 {
+				return usageError{"-update requires -out when ex_info is not a single file"}
+			}
+			path = paths[0]
+		}
+		existing, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		updated, err := erdh.UpdateExInfoSkeleton(existing, cons)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(path, updated, 0644)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "ex_info updated", path)
+		return nil
+	}
+
+	out, err := createOutput(*o)
+	if err != nil {
+		return err
+	}
+	err = erdh.WriteExInfoSkeleton(out, cons)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -1,76 +1,299 @@
 package main
 
 import (
+	"bufio"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	"github.com/iwot/erdh-go/config"
-	"github.com/iwot/erdh-go/db"
-	"github.com/iwot/erdh-go/erdh"
-	"gopkg.in/yaml.v2"
 )
 
+// version はビルド時に -ldflags "-X main.version=..." で設定する
+var version = "dev"
+
+// command はサブコマンドの定義
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(fs *flag.FlagSet, args []string) error
+}
+
+var commands = []command{
+	{"generate", "[flags]", "read sources and write the PlantUML diagram (default command)", runGenerate},
+	{"snapshot", "[flags]", "read sources and write the intermediate file", runSnapshot},
+	{"diff", "[flags] OLD [NEW]", "show differences between two intermediate files (or OLD and the configured sources)", runDiff},
+	{"lint", "[flags]", "report schema design issues such as tables without primary key", runLint},
+	{"analyze", "[flags]", "report isolated tables, relation cycles, hub tables and a load order", runAnalyze},
+	{"validate", "[flags]", "check the config and ex_info against the sources", runValidate},
+	{"init-exinfo", "[flags]", "write an ex_info skeleton from the sources", runInitExInfo},
+	{"discover", "[flags]", "sample DB data to propose relations as an ex_info fragment", runDiscover},
+	{"verify", "[flags]", "compare declared relation cardinalities with the DB data", runVerify},
+	{"check", "[flags]", "report rows of logical relations that have no referenced row in the DB data", runCheck},
+	{"version", "", "print the version", runVersion},
+}
+
+// 終了コード
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// exitStatus はメッセージを出さずに終了コードだけを返すためのエラー（diff や lint で差分、問題があった場合など）
+type exitStatus int
+
+func (e exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+// usageError はコマンドの使い方の誤り
+type usageError struct {
+	message string
+}
+
+func (e usageError) Error() string {
+	return e.message
+}
+
 func main() {
-	var (
-		c = flag.String("config", "", "config yaml file path")
-		o = flag.String("out", "", "output puml file path")
-	)
-	flag.Parse()
-	fmt.Println("read from", *c)
-	fmt.Println("output to", *o)
-
-	conf, err := config.NewConfigFromYamlFile(*c)
-	if err != nil {
-		panic(err)
-	}
-
-	fmt.Println("conf.SourceFrom", conf.SourceFrom)
-	var cons *erdh.Construction
-	if conf.IsDBSource() {
-		dbConf, err := config.NewDBConfigFromYamlFile(conf.SourceFrom)
-		if err != nil {
-			panic(err)
+	os.Exit(run(os.Args[1:]))
+}
+
+// run はサブコマンドを実行し、終了コードを返す
+// サブコマンドを省略した場合は generate として扱う
+func run(args []string) int {
+	name := "generate"
+	switch {
+	case len(args) > 0 && isHelpFlag(args[0]):
+		printUsage(os.Stdout)
+		return exitOK
+	case len(args) > 0 && args[0] == "help":
+		if len(args) == 1 {
+			printUsage(os.Stdout)
+			return exitOK
 		}
+		name, args = args[1], []string{"-help"}
+	case len(args) > 0 && !strings.HasPrefix(args[0], "-"):
+		name, args = args[0], args[1:]
+	}
 
-		cons, err = db.ReadDB(conf.Source, *dbConf)
-		if err != nil {
-			panic(err)
+	cmd, ok := findCommand(name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "erdh-go: unknown command %q\n\n", name)
+		printUsage(os.Stderr)
+		return exitUsage
+	}
+
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: erdh-go %s %s\n\n%s\n\nflags:\n", cmd.name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+
+	err := cmd.run(fs, args)
+	var status exitStatus
+	var usage usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.As(err, &status):
+		return int(status)
+	case errors.As(err, &usage):
+		fmt.Fprintf(os.Stderr, "erdh-go %s: %s\n", cmd.name, usage.message)
+		fs.Usage()
+		return exitUsage
+	default:
+		fmt.Fprintf(os.Stderr, "erdh-go %s: %s\n", cmd.name, err)
+		return exitError
+	}
+}
+
+// parseFlags はフラグを解析する
+// 誤りは FlagSet が使い方とともに出力するため、終了コードだけを返す
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		return exitStatus(exitUsage)
+	}
+	return err
+}
+
+func isHelpFlag(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
 		}
-	} else if conf.IsYAMLSource() {
-		cons, err = db.ReadYAML(conf.SourceFrom)
+	}
+	return command{}, false
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: erdh-go <command> [flags]")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Run 'erdh-go <command> -help' for the flags of each command.")
+}
+
+// configFlags は設定ファイルを読むコマンドに共通のフラグ
+type configFlags struct {
+	fs            *flag.FlagSet
+	path          string
+	overrides     []string
+	passwordStdin bool
+	strict        bool
+}
+
+// configKeyFlags はフラグ名と上書きする設定ファイルのキー
+var configKeyFlags = []struct {
+	flag  string
+	key   string
+	usage string
+}{
+	{"source", "source", "source type (mysql, sqlite, yaml, json, ddl); overrides source in config"},
+	{"source-from", "source_from", "source file path; overrides source_from in config"},
+	{"group", "group", "comma separated groups; overrides group in config"},
+	{"ex-info", "ex_info", "comma separated ex_info files or globs; overrides ex_info in config"},
+}
+
+// newConfigFlags は fs に共通のフラグを登録する
+func newConfigFlags(fs *flag.FlagSet) *configFlags {
+	f := &configFlags{fs: fs}
+	fs.StringVar(&f.path, "config", "", "config yaml file path (optional when -source and -source-from are given)")
+	for _, k := range configKeyFlags {
+		fs.String(k.flag, "", k.usage)
+	}
+	fs.Var((*overrideList)(&f.overrides), "set", "override a config key as key=value (e.g. theme.direction=left-to-right); can be repeated")
+	fs.BoolVar(&f.passwordStdin, "password-stdin", false, "read DB password from stdin")
+	fs.BoolVar(&f.strict, "strict", false, "reject unknown fields in yaml/json intermediate sources")
+	return f
+}
+
+// load は設定ファイルを読み、フラグによる上書きを適用した設定を返す
+func (f *configFlags) load() (*config.Config, error) {
+	conf := &config.Config{}
+	if len(f.path) > 0 {
+		var err error
+		conf, err = config.NewConfigFromYamlFile(f.path)
 		if err != nil {
-			panic(err)
+			return nil, fmt.Errorf("read config %s: %w", f.path, err)
 		}
-	} else {
-		panic(errors.New("source error"))
 	}
 
-	exInfo, err := config.NewExtraConfigFromYamlFile(conf.ExInfo)
-	if err != nil {
-		panic(err)
+	// -source, -source-from を指定した場合は sources の代わりにその読み込み元だけを読む
+	if isFlagSet(f.fs, "source") || isFlagSet(f.fs, "source-from") {
+		conf.Sources = nil
+	}
+	for _, k := range configKeyFlags {
+		fl := f.fs.Lookup(k.flag)
+		if isFlagSet(f.fs, k.flag) {
+			if err := conf.Set(k.key, fl.Value.String()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, o := range f.overrides {
+		kv := strings.SplitN(o, "=", 2)
+		if err := conf.Set(kv[0], kv[1]); err != nil {
+			return nil, err
+		}
 	}
 
-	cons.UpdateExRelationsFromForeignKeys()
+	if f.strict {
+		conf.Strict = true
+		for i := range conf.Sources {
+			conf.Sources[i].Strict = true
+		}
+	}
 
-	cons.ApplyExInfo(*exInfo)
+	for _, src := range conf.GetSources() {
+		if len(src.Source) == 0 || len(src.SourceFrom) == 0 {
+			if len(f.path) == 0 {
+				return nil, usageError{"-config or both -source and -source-from are required"}
+			}
+			return nil, fmt.Errorf("config %s: source and source_from are required", f.path)
+		}
+	}
+	return conf, nil
+}
 
-	// 中間形式ファイルを保存
-	if len(conf.Im.SaveTo) > 0 {
-		fmt.Println("intermediate yaml saving to", conf.Im.SaveTo)
-		d, err := yaml.Marshal(&cons)
-		if err != nil {
-			panic(err)
+// password は -password-stdin が指定されていれば標準入力からパスワードを読む
+func (f *configFlags) password() (string, error) {
+	if !f.passwordStdin {
+		return "", nil
+	}
+	return readStdinPassword()
+}
+
+// overrideList は繰り返し指定できる key=value 形式のフラグ
+type overrideList []string
+
+func (l *overrideList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *overrideList) Set(s string) error {
+	if !strings.Contains(s, "=") {
+		return errors.New("expected key=value")
+	}
+	*l = append(*l, s)
+	return nil
+}
+
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
 		}
-		file, _ := os.Create(conf.Im.SaveTo)
-		fmt.Fprintln(file, string(d))
+	})
+	return set
+}
+
+// readStdinPassword は標準入力の1行目をパスワードとして読む
+func readStdinPassword() (string, error) {
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
 	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// createOutput は path が空であれば標準出力を、そうでなければ作成したファイルを返す
+func createOutput(path string) (io.WriteCloser, error) {
+	if len(path) == 0 {
+		return nopCloser{os.Stdout}, nil
+	}
+	return os.Create(path)
+}
 
-	if len(*o) > 0 {
-		file, _ := os.Create(*o)
-		erdh.WritePumlByGroup(file, cons, conf)
-	} else {
-		erdh.WritePuml(os.Stdout, cons, conf, "")
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// splitList はカンマ区切りの文字列を前後の空白を除いて分割する。空の要素は除く
+func splitList(value string) []string {
+	result := []string{}
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); len(s) > 0 {
+			result = append(result, s)
+		}
 	}
+	return result
 }
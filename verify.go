@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/iwot/erdh-go/config"
+	"github.com/iwot/erdh-go/db"
+	"github.com/iwot/erdh-go/erdh"
+)
+
+// runVerify はリレーションのカーディナリティを最初の読み込み元（mysql または sqlite）のデータと比べ、食い違いを出力する
+// 食い違いがあれば終了コード1を返す
+func runVerify(fs *flag.FlagSet, args []string) error {
+	cf := newConfigFlags(fs)
+	propose := fs.String("propose", "", "write ex_info with cardinalities corrected from the data to this file")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	conf, err := cf.load()
+	if err != nil {
+		return err
+	}
+	password, err := cf.password()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	cons, err := buildConstruction(ctx, conf, password)
+	if err != nil {
+		return err
+	}
+	src := conf.GetSources()[0]
+	if len(password) > 0 {
+		src.Password = password
+	}
+	checks, err := db.MeasureSourceCardinalities(ctx, src, cons)
+	if err != nil {
+		return err
+	}
+
+	disagreements := 0
+	for _, c := range checks {
+		problems := c.Problems()
+		if len(problems) == 0 {
+			continue
+		}
+		disagreements++
+		fmt.Println(c)
+		for _, p := range problems {
+			fmt.Println("  " + p)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d relations checked, %d disagree with the data\n", len(checks), disagreements)
+
+	if len(*propose) > 0 {
+		exInfo, err := config.NewExtraConfigFromYamlFiles(conf.ExInfo)
+		if err != nil {
+			return fmt.Errorf("read ex_info: %w", err)
+		}
+		out, err := createOutput(*propose)
+		if err != nil {
+			return err
+		}
+		err = erdh.WriteExInfo(out, erdh.ProposeExInfo(*exInfo, cons, checks))
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "ex_info proposal saved to", *propose)
+	}
+
+	if disagreements > 0 {
+		return exitStatus(exitError)
+	}
+	return nil
+}